@@ -5,13 +5,18 @@ import (
 	"flag"
 	"fmt"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/caarlos0/env/v6"
+	"github.com/cezarmathe/stevebot/internal/audit"
 	botv2i "github.com/cezarmathe/stevebot/internal/bot/v2"
+	"github.com/cezarmathe/stevebot/internal/deadletter"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"github.com/cezarmathe/stevebot/internal/links"
+	"github.com/cezarmathe/stevebot/internal/mclog"
 	stevev2i "github.com/cezarmathe/stevebot/internal/steve/v2"
-	"github.com/gorcon/rcon"
 	"go.uber.org/zap"
 )
 
@@ -44,11 +49,86 @@ func init() {
 }
 
 type Config struct {
-	DiscordToken string                         `env:"DISCORD_TOKEN"`
-	RconAddress  string                         `env:"RCON_ADDRESS"`
-	RconPassword string                         `env:"RCON_PASSWORD"`
-	Bot          botv2i.Config                  `envPrefix:"BOT_"`
-	Steve        stevev2i.StandardServiceConfig `envPrefix:"STEVE_"`
+	DiscordToken  string                         `env:"DISCORD_TOKEN"`
+	RconAddress   string                         `env:"RCON_ADDRESS"`
+	RconPassword  string                         `env:"RCON_PASSWORD"`
+	StatusAddress string                         `env:"STATUS_ADDRESS"`
+	QueryAddress  string                         `env:"QUERY_ADDRESS"`
+	LogPath       string                         `env:"LOG_PATH"`
+	Bot           botv2i.Config                  `envPrefix:"BOT_"`
+	Steve         stevev2i.StandardServiceConfig `envPrefix:"STEVE_"`
+
+	// Names of the servers to connect to. Each server is configured with
+	// variables prefixed by SERVER_<NAME>_, e.g. SERVER_CREATIVE_RCON_ADDRESS.
+	// If empty, a single server named "default" is configured from
+	// RCON_ADDRESS, RCON_PASSWORD, STATUS_ADDRESS, QUERY_ADDRESS, LOG_PATH
+	// and STEVE_*. Servers are put in groups with SERVER_<NAME>_GROUPS, commands
+	// sent to a group run on all of its servers.
+	Servers       []string `env:"SERVERS"`
+	DefaultServer string   `env:"DEFAULT_SERVER"`
+
+	// Path to the audit log database. If empty, commands are not audited.
+	AuditDB string `env:"AUDIT_DB"`
+	// Path to the dead letter queue database. If empty, late command results
+	// are only logged.
+	DeadLetterDB string `env:"DEAD_LETTER_DB"`
+	// Path to the database of the links between Discord users and Minecraft
+	// accounts. If empty, accounts can't be linked.
+	LinksDB string `env:"LINKS_DB"`
+}
+
+// loadServerConfigs loads the configuration of every server, by name.
+func loadServerConfigs(mainConfig *Config) (map[string]*stevev2i.ServerConfig, error) {
+	if len(mainConfig.Servers) == 0 {
+		return map[string]*stevev2i.ServerConfig{
+			"default": {
+				RconAddress:   mainConfig.RconAddress,
+				RconPassword:  mainConfig.RconPassword,
+				Steve:         mainConfig.Steve,
+				StatusAddress: mainConfig.StatusAddress,
+				QueryAddress:  mainConfig.QueryAddress,
+				LogPath:       mainConfig.LogPath,
+			},
+		}, nil
+	}
+	configs := make(map[string]*stevev2i.ServerConfig, len(mainConfig.Servers))
+	for _, name := range mainConfig.Servers {
+		var config stevev2i.ServerConfig
+		prefix := fmt.Sprintf("SERVER_%s_", strings.ToUpper(name))
+		if err := env.Parse(&config, env.Options{Prefix: prefix}); err != nil {
+			return nil, fmt.Errorf("server %s: %w", name, err)
+		}
+		configs[name] = &config
+	}
+	return configs, nil
+}
+
+// deadLetterHandler returns a handler that pushes late command results of a
+// server to the dead letter queue.
+func deadLetterHandler(deadLetters *deadletter.Queue, logger *zap.Logger, server string) stevev2i.DeadLetterHandler {
+	return func(ctx context.Context, cmd, out string, err error) {
+		l := &deadletter.Letter{
+			Server:  server,
+			Command: cmd,
+			Output:  out,
+		}
+		l.Origin, _ = audit.OriginFrom(ctx)
+		if err != nil {
+			l.Error = err.Error()
+		}
+		if err := deadLetters.Push(l); err != nil {
+			logger.Error("push dead letter", zap.String("cmd", cmd), zap.Error(err))
+			return
+		}
+		logger.Warn("dead letter", zap.Uint64("id", l.ID), zap.String("cmd", cmd))
+	}
+}
+
+// logEvents logs the events of the log of a server until events is closed.
+func logEvents(logger *zap.Logger, events <-chan mclog.Event) {
+	for event := range events {
+		logger.Debug("log event", zap.String("type", fmt.Sprintf("%T", event)), zap.String("text", event.Log().Text))
+	}
 }
 
 func main() {
@@ -68,19 +148,142 @@ func main() {
 		logger.Panic("create discord session", zap.Error(err))
 	}
 	defer dSess.Close()
+	dClient := discord.NewSession(dSess)
+
+	var auditLog *audit.Log
+	if mainConfig.AuditDB != "" {
+		auditLog, err = audit.Open(mainConfig.AuditDB)
+		if err != nil {
+			logger.Panic("open audit log", zap.Error(err))
+		}
+		defer auditLog.Close()
+	}
+
+	var deadLetters *deadletter.Queue
+	if mainConfig.DeadLetterDB != "" {
+		deadLetters, err = deadletter.Open(mainConfig.DeadLetterDB)
+		if err != nil {
+			logger.Panic("open dead letter queue", zap.Error(err))
+		}
+		defer deadLetters.Close()
+	}
+
+	var linkStore *links.Store
+	if mainConfig.LinksDB != "" {
+		linkStore, err = links.Open(mainConfig.LinksDB)
+		if err != nil {
+			logger.Panic("open link store", zap.Error(err))
+		}
+		defer linkStore.Close()
+	}
 
-	rc, err := rcon.Dial(mainConfig.RconAddress, mainConfig.RconPassword)
+	serverConfigs, err := loadServerConfigs(&mainConfig)
 	if err != nil {
-		logger.Panic("dial rcon", zap.Error(err))
+		logger.Panic("load server configs", zap.Error(err))
+	}
+	defaultServer := mainConfig.DefaultServer
+	if defaultServer == "" {
+		if len(mainConfig.Servers) > 0 {
+			defaultServer = mainConfig.Servers[0]
+		} else {
+			defaultServer = "default"
+		}
+	}
+	servers := stevev2i.NewRegistry(defaultServer)
+	pools := make([]*stevev2i.Pool, 0, len(serverConfigs))
+	tailers := make(map[string]*mclog.Tailer)
+	mainConfig.Bot.StatusAddresses = make(map[string]string, len(serverConfigs))
+	mainConfig.Bot.QueryAddresses = make(map[string]string, len(serverConfigs))
+	for name, config := range serverConfigs {
+		mainConfig.Bot.StatusAddresses[name] = config.StatusAddr()
+		if config.QueryAddress != "" {
+			mainConfig.Bot.QueryAddresses[name] = config.QueryAddress
+		}
+		serverLogger := logger.With(zap.String("server", name))
+		policy, err := config.Steve.Policy()
+		if err != nil {
+			logger.Panic("load command policy", zap.String("server", name), zap.Error(err))
+		}
+		pool := stevev2i.NewPool(&config.Steve, serverLogger, config.RconAddress, config.RconPassword)
+		pools = append(pools, pool)
+		steve := stevev2i.NewStandard(name, &config.Steve, serverLogger, policy, auditLog, pool)
+		if deadLetters != nil {
+			steve.OnDeadLetter(deadLetterHandler(deadLetters, serverLogger, name))
+		}
+		if err := servers.Add(name, &steve); err != nil {
+			logger.Panic("register server", zap.Error(err))
+		}
+		if config.LogPath != "" {
+			tailers[name] = mclog.NewTailer(config.LogPath, 0, serverLogger)
+		}
+	}
+	for name, config := range serverConfigs {
+		for _, group := range config.Groups {
+			if err := servers.AddToGroup(group, name); err != nil {
+				logger.Panic("register server group", zap.Error(err))
+			}
+		}
+	}
+	if _, err := servers.Get(defaultServer); err != nil {
+		logger.Panic("default server", zap.Error(err))
 	}
-	defer rc.Close()
 
-	steve := stevev2i.NewStandard(&mainConfig.Steve, logger, rc)
-	bot := botv2i.New(&mainConfig.Bot, logger, &steve)
+	if err := mainConfig.Bot.Validate(); err != nil {
+		logger.Panic("bot config", zap.Error(err))
+	}
+	permissions, err := mainConfig.Bot.Permissions()
+	if err != nil {
+		logger.Panic("load permissions", zap.Error(err))
+	}
+	bot := botv2i.New(&mainConfig.Bot, logger, permissions, auditLog, deadLetters, linkStore, servers)
+	if deadLetters != nil {
+		deadLetters.Subscribe(func(l deadletter.Letter) {
+			bot.NotifyDeadLetter(dClient, l)
+		})
+	}
 
-	dSess.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
-		bot.HandleCommand(ctx, s, m)
+	// prefix commands and the chat bridge need to read the content of
+	// messages, slash commands only need the guilds intent
+	dSess.Identify.Intents = discordgo.IntentsGuilds
+	if mainConfig.Bot.CommandPrefix != "" || len(mainConfig.Bot.ChatChannels) > 0 {
+		dSess.Identify.Intents |= discordgo.IntentsGuildMessages | discordgo.IntentsMessageContent
+		dSess.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
+			bot.HandleCommand(ctx, dClient, m)
+		})
+	}
+	if commands := bot.ApplicationCommands(); len(commands) > 0 {
+		dSess.AddHandler(func(s *discordgo.Session, r *discordgo.Ready) {
+			_, err := s.ApplicationCommandBulkOverwrite(r.User.ID, mainConfig.Bot.SlashCommandGuild, commands)
+			if err != nil {
+				logger.Error("register slash commands", zap.Error(err))
+			}
+		})
+	}
+	dSess.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		bot.HandleInteraction(ctx, dClient, i)
 	})
+	// the whitelist follows role changes, which need the privileged members
+	// intent
+	if mainConfig.Bot.WhitelistRole != "" {
+		dSess.Identify.Intents |= discordgo.IntentsGuildMembers
+		dSess.AddHandler(func(s *discordgo.Session, m *discordgo.GuildMemberUpdate) {
+			bot.HandleMemberUpdate(ctx, dClient, m)
+		})
+		dSess.AddHandler(func(s *discordgo.Session, m *discordgo.GuildMemberRemove) {
+			bot.HandleMemberRemove(ctx, dClient, m)
+		})
+	}
+	for name, tailer := range tailers {
+		go logEvents(logger.With(zap.String("server", name)), tailer.Subscribe())
+	}
+	if err := dSess.Open(); err != nil {
+		logger.Panic("open discord session", zap.Error(err))
+	}
+
+	for name, tailer := range tailers {
+		go bot.HandleLogEvents(ctx, dClient, name, tailer.Subscribe())
+	}
+	go bot.RunWhitelistSync(ctx, dClient)
 
 	logger.Info("running")
 	<-ctx.Done()
@@ -90,8 +293,15 @@ func main() {
 	if err := dSess.Close(); err != nil {
 		logger.Error("close discord session", zap.Error(err))
 	}
-	if err := rc.Close(); err != nil {
-		logger.Error("close rcon client", zap.Error(err))
+	for _, pool := range pools {
+		if err := pool.Close(); err != nil {
+			logger.Error("close rcon pool", zap.Error(err))
+		}
+	}
+	for _, tailer := range tailers {
+		if err := tailer.Close(); err != nil {
+			logger.Error("close log tailer", zap.Error(err))
+		}
 	}
 
 	logger.Info("bye bye")
@@ -3,18 +3,17 @@ module github.com/cezarmathe/stevebot
 go 1.18
 
 require (
-	github.com/bearbin/mcgorcon v0.0.0-20141104170123-f611ad04551a
-	github.com/bwmarrin/discordgo v0.22.0
+	github.com/bwmarrin/discordgo v0.27.1
 	github.com/caarlos0/env/v6 v6.9.1
-	github.com/gorcon/rcon v1.3.1
 	github.com/joho/godotenv v1.3.0
-	go.uber.org/multierr v1.8.0
+	go.etcd.io/bbolt v1.3.7
 	go.uber.org/zap v1.21.0
 )
 
 require (
-	github.com/gorilla/websocket v1.4.0 // indirect
+	github.com/gorilla/websocket v1.4.2 // indirect
 	go.uber.org/atomic v1.9.0 // indirect
-	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550 // indirect
-	golang.org/x/sys v0.0.0-20210510120138-977fb7262007 // indirect
+	go.uber.org/multierr v1.8.0 // indirect
+	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b // indirect
+	golang.org/x/sys v0.4.0 // indirect
 )
@@ -0,0 +1,197 @@
+// Package audit records every command sent to a Minecraft server, along with
+// where it came from and what happened to it, in a durable local store.
+package audit
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	entriesBucket = []byte("entries")
+)
+
+// Origin describes where a command came from.
+type Origin struct {
+	UserID    string `json:"user_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	GuildID   string `json:"guild_id,omitempty"`
+	ChannelID string `json:"channel_id,omitempty"`
+	MessageID string `json:"message_id,omitempty"`
+}
+
+type originKey struct{}
+
+// WithOrigin returns a copy of ctx carrying the origin of a command.
+func WithOrigin(ctx context.Context, origin Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// OriginFrom returns the origin carried by ctx, if any.
+func OriginFrom(ctx context.Context) (Origin, bool) {
+	origin, ok := ctx.Value(originKey{}).(Origin)
+	return origin, ok
+}
+
+// Approval records who approved, or rejected, a command that needed the
+// approval of a second person.
+type Approval struct {
+	UserID   string    `json:"user_id"`
+	Username string    `json:"username,omitempty"`
+	Time     time.Time `json:"time"`
+	Rejected bool      `json:"rejected,omitempty"`
+}
+
+type approvalKey struct{}
+
+// WithApproval returns a copy of ctx carrying the approval of a command.
+func WithApproval(ctx context.Context, approval Approval) context.Context {
+	return context.WithValue(ctx, approvalKey{}, approval)
+}
+
+// ApprovalFrom returns the approval carried by ctx, if any.
+func ApprovalFrom(ctx context.Context) (Approval, bool) {
+	approval, ok := ctx.Value(approvalKey{}).(Approval)
+	return approval, ok
+}
+
+// Entry is a single audited command.
+type Entry struct {
+	ID       uint64        `json:"id"`
+	Time     time.Time     `json:"time"`
+	Origin   Origin        `json:"origin"`
+	Approval *Approval     `json:"approval,omitempty"`
+	Server   string        `json:"server,omitempty"`
+	Command  string        `json:"command"`
+	Allowed  bool          `json:"allowed"`
+	Decision string        `json:"decision"`
+	Output   string        `json:"output,omitempty"`
+	Latency  time.Duration `json:"latency"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Query selects entries. Zero fields match everything.
+type Query struct {
+	UserID string
+	// Command matches entries whose command starts with these words.
+	Command string
+	Since   time.Time
+	Until   time.Time
+	// Limit is the maximum number of entries returned, newest first.
+	Limit int
+}
+
+// Log is an audit log backed by a bbolt database. A nil log records nothing.
+type Log struct {
+	db *bolt.DB
+}
+
+// Open opens (or creates) the audit log stored at path.
+func Open(path string) (*Log, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(entriesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	return &Log{db}, nil
+}
+
+// Close closes the audit log.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.db.Close()
+}
+
+// Record appends an entry to the log and sets its id.
+func (l *Log) Record(e *Entry) error {
+	if l == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	return l.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(entriesBucket)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		e.ID = id
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return b.Put(idKey(id), data)
+	})
+}
+
+// Query returns the entries matching q, newest first.
+func (l *Log) Query(q Query) ([]Entry, error) {
+	if l == nil {
+		return nil, nil
+	}
+	words := strings.Fields(q.Command)
+	entries := make([]Entry, 0)
+	err := l.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(entriesBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if !q.Since.IsZero() && e.Time.Before(q.Since) {
+				// entries are ordered by time, the rest are older
+				break
+			}
+			if !q.matches(&e, words) {
+				continue
+			}
+			entries = append(entries, e)
+			if q.Limit > 0 && len(entries) >= q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func (q *Query) matches(e *Entry, words []string) bool {
+	if q.UserID != "" && e.Origin.UserID != q.UserID {
+		return false
+	}
+	if !q.Until.IsZero() && e.Time.After(q.Until) {
+		return false
+	}
+	command := strings.Fields(e.Command)
+	if len(command) < len(words) {
+		return false
+	}
+	for i, word := range words {
+		if command[i] != word {
+			return false
+		}
+	}
+	return true
+}
+
+func idKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
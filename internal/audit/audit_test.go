@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestLog(t *testing.T) *Log {
+	t.Helper()
+
+	l, err := Open(filepath.Join(t.TempDir(), "audit.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestRecord(t *testing.T) {
+	l := newTestLog(t)
+
+	e := &Entry{Command: "list"}
+	if err := l.Record(e); err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != 1 || e.Time.IsZero() {
+		t.Errorf("got entry %+v, want the id and the time set", e)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	l := newTestLog(t)
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	for i, e := range []Entry{
+		{Origin: Origin{UserID: "alex"}, Command: "list"},
+		{Origin: Origin{UserID: "steve"}, Command: "op steve"},
+		{Origin: Origin{UserID: "alex"}, Command: "op alex"},
+		{Origin: Origin{UserID: "alex"}, Command: "say hi"},
+	} {
+		e.Time = start.Add(time.Duration(i) * time.Hour)
+		if err := l.Record(&e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []uint64
+	}{
+		{"everything", Query{}, []uint64{4, 3, 2, 1}},
+		{"user", Query{UserID: "alex"}, []uint64{4, 3, 1}},
+		{"unknown user", Query{UserID: "herobrine"}, nil},
+		{"command", Query{Command: "op"}, []uint64{3, 2}},
+		{"command words", Query{Command: "op steve"}, []uint64{2}},
+		{"partial word", Query{Command: "o"}, nil},
+		{"longer than the command", Query{Command: "list uuids"}, nil},
+		{"since", Query{Since: start.Add(time.Hour)}, []uint64{4, 3, 2}},
+		{"since after the last", Query{Since: start.Add(4 * time.Hour)}, nil},
+		{"until", Query{Until: start.Add(time.Hour)}, []uint64{2, 1}},
+		{"since and until", Query{Since: start.Add(time.Hour), Until: start.Add(2 * time.Hour)}, []uint64{3, 2}},
+		{"limit", Query{Limit: 2}, []uint64{4, 3}},
+		{"all filters", Query{UserID: "alex", Command: "op", Since: start, Until: start.Add(3 * time.Hour), Limit: 1}, []uint64{3}},
+	}
+	for _, test := range tests {
+		entries, err := l.Query(test.query)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		var got []uint64
+		for _, e := range entries {
+			got = append(got, e.ID)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got ids %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNilLog(t *testing.T) {
+	var l *Log
+
+	if err := l.Record(&Entry{Command: "list"}); err != nil {
+		t.Errorf("record: %v", err)
+	}
+	if entries, err := l.Query(Query{}); err != nil || len(entries) != 0 {
+		t.Errorf("got %v (%v), want no entries", entries, err)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("close: %v", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/discord"
 )
 
 // Bot is a component that handles the interaction with stevebot via Discord.
@@ -21,7 +22,7 @@ type Bot interface {
 	gracefulDisconnect(context.Context, *sync.WaitGroup)
 
 	// handleCommand handles a command received.
-	handleCommand(context.Context, *discordgo.Session, *discordgo.MessageCreate)
+	handleCommand(context.Context, discord.Client, *discordgo.MessageCreate)
 }
 
 // NewBot creates a new bot instance.
@@ -5,11 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/audit"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"github.com/cezarmathe/stevebot/internal/mcformat"
 	"github.com/cezarmathe/stevebot/internal/steve"
 )
 
@@ -57,6 +61,34 @@ func newBot() error {
 		shouldExit = true
 	}
 
+	// note 18/10/2026: output formats are optional, the default renders
+	// formatting codes as colours
+	if value, ok := os.LookupEnv(outputFormatKey); ok {
+		mode, err := mcformat.ParseMode(value)
+		if err != nil {
+			log.Warnf("new bot: %s: %v", outputFormatKey, err)
+			shouldExit = true
+		}
+		outputFormat = mode
+	}
+	if value, ok := os.LookupEnv(channelOutputFormatsKey); ok {
+		formats, err := parseChannelOutputFormats(value)
+		if err != nil {
+			log.Warnf("new bot: %s: %v", channelOutputFormatsKey, err)
+			shouldExit = true
+		}
+		channelOutputFormats = formats
+	}
+
+	if value, ok := os.LookupEnv(attachmentThresholdKey); ok {
+		threshold, err := strconv.Atoi(value)
+		if err != nil {
+			log.Warnf("new bot: %s: %v", attachmentThresholdKey, err)
+			shouldExit = true
+		}
+		attachmentThreshold = threshold
+	}
+
 	if shouldExit {
 		return errors.New("new bot: failed to load configuration from env")
 	}
@@ -84,7 +116,7 @@ func (b *botImpl) Start(ctx context.Context, wg *sync.WaitGroup) error {
 	}
 
 	dg.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
-		b.handleCommand(ctx, s, m)
+		b.handleCommand(ctx, discord.NewSession(s), m)
 	})
 	dg.Identify.Intents = discordgo.MakeIntent(discordgo.IntentsGuildMessages)
 
@@ -102,9 +134,11 @@ func (b *botImpl) Start(ctx context.Context, wg *sync.WaitGroup) error {
 	return nil
 }
 
-func (b *botImpl) handleCommand(ctx context.Context, s *discordgo.Session, m *discordgo.MessageCreate) {
+func (b *botImpl) handleCommand(ctx context.Context, dc discord.Client,
+	m *discordgo.MessageCreate) {
+
 	// do not process messages sent by the bot
-	if m.Author.ID == s.State.User.ID {
+	if m.Author.ID == dc.UserID() {
 		return
 	}
 
@@ -117,6 +151,13 @@ func (b *botImpl) handleCommand(ctx context.Context, s *discordgo.Session, m *di
 	command := strings.Fields(strings.TrimPrefix(m.Content, commandPrefix))
 
 	ctx, cancel := context.WithTimeout(ctx, COMMAND_TIMEOUT)
+	ctx = audit.WithOrigin(ctx, audit.Origin{
+		UserID:    m.Author.ID,
+		Username:  m.Author.String(),
+		GuildID:   m.GuildID,
+		ChannelID: m.ChannelID,
+		MessageID: m.ID,
+	})
 
 	done := make(chan error, 1)
 	go func() {
@@ -124,7 +165,7 @@ func (b *botImpl) handleCommand(ctx context.Context, s *discordgo.Session, m *di
 		// working on it
 		wipMsg := fmt.Sprintf("%s working on it.. (\"%s\" by %s)",
 			CMD_WIP_EMOJI, strings.Join(command, " "), m.Author.Mention())
-		msg, err := s.ChannelMessageSend(m.ChannelID, wipMsg)
+		msg, err := dc.SendMessage(m.ChannelID, wipMsg)
 		if err != nil {
 			done <- err
 			cancel()
@@ -140,7 +181,7 @@ func (b *botImpl) handleCommand(ctx context.Context, s *discordgo.Session, m *di
 				steveOut.Error(),
 				strings.Join(command, " "),
 				m.Author.Mention())
-			_, err = s.ChannelMessageEdit(m.ChannelID, msg.ID, errMsg)
+			_, err = dc.EditMessage(m.ChannelID, msg.ID, errMsg)
 			if err != nil {
 				log.Warnf("bot: handle command: %w", err)
 				errMsg = fmt.Sprintf("%s  %s (\"%s\" by %s)",
@@ -148,7 +189,7 @@ func (b *botImpl) handleCommand(ctx context.Context, s *discordgo.Session, m *di
 					"can't update discord message with command output",
 					strings.Join(command, " "),
 					m.Author.Mention())
-				_, _ = s.ChannelMessageEdit(m.ChannelID, msg.ID, errMsg)
+				_, _ = dc.EditMessage(m.ChannelID, msg.ID, errMsg)
 			}
 			done <- err
 			cancel()
@@ -162,10 +203,10 @@ func (b *botImpl) handleCommand(ctx context.Context, s *discordgo.Session, m *di
 		if rconOut.Success() {
 			okMsg := fmt.Sprintf("%s  %s (\"%s\" by %s)",
 				CMD_OK_EMOJI,
-				rconOut.Out(),
+				mcformat.Format(rconOut.Out(), channelOutputFormat(m.ChannelID)),
 				strings.Join(command, " "),
 				m.Author.Mention())
-			_, err = s.ChannelMessageEdit(m.ChannelID, msg.ID, okMsg)
+			err = editOutput(dc, m.ChannelID, msg.ID, okMsg)
 			if err != nil {
 				log.Warnf("bot: handle command: %w", err)
 				errMsg := fmt.Sprintf("%s  %s (\"%s\" by %s)",
@@ -173,7 +214,7 @@ func (b *botImpl) handleCommand(ctx context.Context, s *discordgo.Session, m *di
 					"can't update discord message with command output",
 					strings.Join(command, " "),
 					m.Author.Mention())
-				_, _ = s.ChannelMessageEdit(m.ChannelID, msg.ID, errMsg)
+				_, _ = dc.EditMessage(m.ChannelID, msg.ID, errMsg)
 			}
 		} else {
 			errMsg := fmt.Sprintf("%s  %s (\"%s\" by %s)",
@@ -181,7 +222,7 @@ func (b *botImpl) handleCommand(ctx context.Context, s *discordgo.Session, m *di
 				rconOut.Error(),
 				strings.Join(command, " "),
 				m.Author.Mention())
-			_, err = s.ChannelMessageEdit(m.ChannelID, msg.ID, errMsg)
+			_, err = dc.EditMessage(m.ChannelID, msg.ID, errMsg)
 			if err != nil {
 				log.Warnf("bot: handle command: %w", err)
 				errMsg = fmt.Sprintf("%s  %s (\"%s\" by %s)",
@@ -189,7 +230,7 @@ func (b *botImpl) handleCommand(ctx context.Context, s *discordgo.Session, m *di
 					"can't update discord message with command output",
 					strings.Join(command, " "),
 					m.Author.Mention())
-				_, _ = s.ChannelMessageEdit(m.ChannelID, msg.ID, errMsg)
+				_, _ = dc.EditMessage(m.ChannelID, msg.ID, errMsg)
 			}
 		}
 		done <- err
@@ -209,6 +250,69 @@ func (b *botImpl) handleCommand(ctx context.Context, s *discordgo.Session, m *di
 	}
 }
 
+// editOutput replaces the content of a message with the output of a command.
+// Output too long for a single message is attached as a text file if it is
+// longer than the attachment threshold, or split across the message and
+// follow-up messages otherwise.
+func editOutput(dc discord.Client, channelID, messageID, content string) error {
+	if len(content) <= discord.MessageLimit {
+		_, err := dc.EditMessage(channelID, messageID, content)
+		return err
+	}
+	if attachmentThreshold > 0 && len(content) > attachmentThreshold {
+		text := discord.PlainText(content)
+		edit := discordgo.NewMessageEdit(channelID, messageID)
+		edit.SetContent(fmt.Sprintf("%s  the output is too long, it is attached as output.txt (%d characters)",
+			CMD_OK_EMOJI, len(text)))
+		edit.Files = []*discordgo.File{{
+			Name:        "output.txt",
+			ContentType: "text/plain",
+			Reader:      strings.NewReader(text),
+		}}
+		_, err := dc.EditMessageComplex(edit)
+		return err
+	}
+	pages := discord.Split(content, discord.MessageLimit)
+	if _, err := dc.EditMessage(channelID, messageID, pages[0]); err != nil {
+		return err
+	}
+	for _, page := range pages[1:] {
+		if _, err := dc.SendMessage(channelID, page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseChannelOutputFormats parses output formats by channel, written as
+// "channel=format,channel=format".
+func parseChannelOutputFormats(value string) (map[string]mcformat.Mode, error) {
+	formats := make(map[string]mcformat.Mode)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		channelID, format, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad channel output format %q", pair)
+		}
+		mode, err := mcformat.ParseMode(strings.TrimSpace(format))
+		if err != nil {
+			return nil, err
+		}
+		formats[strings.TrimSpace(channelID)] = mode
+	}
+	return formats, nil
+}
+
+// channelOutputFormat returns how formatting codes are rendered in a channel.
+func channelOutputFormat(channelID string) mcformat.Mode {
+	if mode, ok := channelOutputFormats[channelID]; ok {
+		return mode
+	}
+	return outputFormat
+}
+
 func (b *botImpl) gracefulDisconnect(ctx context.Context, wg *sync.WaitGroup) {
 	locked := make(chan struct{}, 1)
 
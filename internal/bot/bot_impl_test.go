@@ -0,0 +1,64 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"github.com/cezarmathe/stevebot/internal/discord/discordtest"
+)
+
+// editTestOutput sends a message and replaces its content with content.
+func editTestOutput(t *testing.T, content string) []discordtest.Event {
+	t.Helper()
+
+	dc := discordtest.NewClient("bot")
+	m, err := dc.SendMessage("channel", "Working on it..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := editOutput(dc, "channel", m.ID, content); err != nil {
+		t.Fatalf("edit output: %v", err)
+	}
+	return dc.Timeline()[1:]
+}
+
+func TestEditOutputShort(t *testing.T) {
+	got := editTestOutput(t, CMD_OK_EMOJI+"done")
+	if len(got) != 1 || got[0].Kind != discordtest.Edit || got[0].Content != CMD_OK_EMOJI+"done" {
+		t.Errorf("got timeline %v, want the message edited", got)
+	}
+}
+
+func TestEditOutputSplit(t *testing.T) {
+	content := CMD_OK_EMOJI + "\n```ansi\n" + strings.Repeat("é output line\n", 300) + "```"
+	got := editTestOutput(t, content)
+	if len(got) < 2 || got[0].Kind != discordtest.Edit {
+		t.Fatalf("got timeline %v, want the message edited and follow-ups sent", got)
+	}
+	for i, event := range got {
+		if i > 0 && event.Kind != discordtest.Send {
+			t.Errorf("event %d: got %v, want a follow-up message", i, event)
+		}
+		if len(event.Content) > discord.MessageLimit {
+			t.Errorf("event %d: %d bytes long", i, len(event.Content))
+		}
+		if i > 0 && !strings.HasPrefix(event.Content, "```ansi\n") {
+			t.Errorf("event %d does not reopen the code block", i)
+		}
+	}
+}
+
+func TestEditOutputAttached(t *testing.T) {
+	content := CMD_OK_EMOJI + "\n```\n" + strings.Repeat("output line\n", attachmentThreshold/10) + "```"
+	got := editTestOutput(t, content)
+	if len(got) != 1 || got[0].Kind != discordtest.Edit || len(got[0].Files) != 1 {
+		t.Fatalf("got timeline %v, want the output attached", got)
+	}
+	if !strings.Contains(got[0].Content, "attached as output.txt") {
+		t.Errorf("got %q, want a note about the attachment", got[0].Content)
+	}
+	if got[0].Files[0].Name != "output.txt" {
+		t.Errorf("got file %q, want output.txt", got[0].Files[0].Name)
+	}
+}
@@ -6,12 +6,18 @@ import (
 	"regexp"
 
 	"github.com/cezarmathe/stevebot/internal/common"
+	"github.com/cezarmathe/stevebot/internal/mcformat"
 	"go.uber.org/zap"
 )
 
 var (
 	discordTokenKey  = fmt.Sprintf("%s_DISCORD_TOKEN", common.EnvVarKeyPrefix)
 	commandPrefixKey = fmt.Sprintf("%s_COMMAND_PREFIX", common.EnvVarKeyPrefix)
+
+	outputFormatKey         = fmt.Sprintf("%s_OUTPUT_FORMAT", common.EnvVarKeyPrefix)
+	channelOutputFormatsKey = fmt.Sprintf("%s_CHANNEL_OUTPUT_FORMATS", common.EnvVarKeyPrefix)
+
+	attachmentThresholdKey = fmt.Sprintf("%s_ATTACHMENT_THRESHOLD", common.EnvVarKeyPrefix)
 )
 
 var (
@@ -20,6 +26,15 @@ var (
 	discordToken  string
 	commandPrefix string
 
+	// how minecraft formatting codes in command output are rendered, by
+	// default and by channel id
+	outputFormat         mcformat.Mode = mcformat.ModeANSI
+	channelOutputFormats map[string]mcformat.Mode
+
+	// output longer than this is attached as a text file instead of being
+	// split across messages, 0 to never attach output
+	attachmentThreshold = 8000
+
 	// this regex is used to check whether a message starts like a command
 	commandStartRegex *regexp.Regexp
 )
@@ -0,0 +1,280 @@
+package botv2i
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/audit"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"go.uber.org/zap"
+)
+
+const (
+	approveButtonPrefix = "approve:"
+	rejectButtonPrefix  = "reject:"
+)
+
+var (
+	ErrApprovalNotConfigured = errors.New("this command needs approval, but no approvals channel is configured")
+	ErrApprovalNotFound      = errors.New("this approval request has expired")
+	ErrNotApprover           = errors.New("only approvers may approve commands")
+	ErrSelfApproval          = errors.New("you can't approve your own command")
+)
+
+// approval is a privileged command parked until an approver approves or
+// rejects it.
+type approval struct {
+	id     string
+	server string
+	cmd    string
+	origin audit.Origin
+	// reply replaces the feedback message the requester sees.
+	reply replyFunc
+	// channelID and messageID locate the message in the approvals channel.
+	channelID string
+	messageID string
+	timer     *time.Timer
+}
+
+// approvals holds the pending approvals, by id. Pending approvals only live in
+// memory, they are lost when the bot restarts.
+type approvals struct {
+	mu      sync.Mutex
+	pending map[string]*approval
+}
+
+func newApprovals() *approvals {
+	return &approvals{pending: make(map[string]*approval)}
+}
+
+// add a pending approval that expires after timeout, if positive.
+func (a *approvals) add(pending *approval, timeout time.Duration, expire func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pending[pending.id] = pending
+	if timeout > 0 {
+		pending.timer = time.AfterFunc(timeout, expire)
+	}
+}
+
+// peek returns a pending approval without removing it.
+func (a *approvals) peek(id string) (*approval, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	pending, ok := a.pending[id]
+	return pending, ok
+}
+
+// take removes a pending approval, so that only one approver, or the expiry,
+// gets to decide on it.
+func (a *approvals) take(id string) (*approval, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	pending, ok := a.pending[id]
+	if ok {
+		delete(a.pending, id)
+		if pending.timer != nil {
+			pending.timer.Stop()
+		}
+	}
+	return pending, ok
+}
+
+// needsApproval returns whether a command needs the approval of a second
+// person.
+func (svc *Service) needsApproval(cmd string) bool {
+	// privileged commands are the ones denied by the list, which sees through
+	// "/op", "minecraft:op" and "execute ... run op" like the server
+	return !svc.privileged.Evaluate(cmd).Allowed
+}
+
+// isApprover returns whether a user holding the given roles may approve
+// commands.
+func (svc *Service) isApprover(roles []string) bool {
+	for _, id := range svc.config.ApproverRoles {
+		for _, role := range roles {
+			if id == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requestApproval parks a command and posts it to the approvals channel. The
+// command runs once an approver approves it, and its result is passed to
+// reply, along with who approved it.
+func (svc *Service) requestApproval(ctx context.Context, dc discord.Client, server, cmd string, reply replyFunc) {
+	if svc.config.ApprovalChannel == "" {
+		reply(fmt.Sprintf("Error: %s", ErrApprovalNotConfigured.Error()))
+		return
+	}
+	origin, _ := audit.OriginFrom(ctx)
+	pending := &approval{
+		id:     origin.MessageID,
+		server: server,
+		cmd:    cmd,
+		origin: origin,
+		reply:  reply,
+	}
+	content := fmt.Sprintf("<@%s> wants to run `%s` on %s.", origin.UserID, cmd, server)
+	if len(svc.config.ApproverRoles) > 0 {
+		mentions := make([]string, 0, len(svc.config.ApproverRoles))
+		for _, role := range svc.config.ApproverRoles {
+			mentions = append(mentions, fmt.Sprintf("<@&%s>", role))
+		}
+		content += " Waiting for the approval of " + strings.Join(mentions, ", ") + "."
+	}
+	reply(fmt.Sprintf("`%s` needs the approval of a moderator, waiting for it in <#%s>.", cmd, svc.config.ApprovalChannel))
+	amsg, err := dc.SendMessageComplex(svc.config.ApprovalChannel, &discordgo.MessageSend{
+		Content: content,
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Approve",
+					Style:    discordgo.SuccessButton,
+					CustomID: approveButtonPrefix + pending.id,
+				},
+				discordgo.Button{
+					Label:    "Reject",
+					Style:    discordgo.DangerButton,
+					CustomID: rejectButtonPrefix + pending.id,
+				},
+			}},
+		},
+	})
+	if err != nil {
+		svc.logger.Error("send approval request", zap.Error(err))
+		reply("Error: can't post the approval request")
+		return
+	}
+	pending.channelID, pending.messageID = amsg.ChannelID, amsg.ID
+	svc.logger.Info("approval requested",
+		zap.String("id", pending.id),
+		zap.String("server", server),
+		zap.String("cmd", cmd),
+		zap.String("author", origin.UserID))
+	svc.approvals.add(pending, svc.config.ApprovalTimeout, func() {
+		svc.expireApproval(dc, pending.id)
+	})
+}
+
+func (svc *Service) expireApproval(dc discord.Client, id string) {
+	pending, ok := svc.approvals.take(id)
+	if !ok {
+		return
+	}
+	svc.logger.Info("approval expired", zap.String("id", id))
+	svc.recordUnapproved(pending, "approval expired", nil)
+	svc.editApprovalMessage(dc, pending, fmt.Sprintf("Expired: <@%s> wanted to run `%s` on %s.",
+		pending.origin.UserID, pending.cmd, pending.server))
+	pending.reply(fmt.Sprintf("Error: %s", ErrApprovalNotFound.Error()))
+}
+
+// handleApprovalButton handles clicks on the buttons of an approval request,
+// and returns whether the interaction was one.
+func (svc *Service) handleApprovalButton(ctx context.Context, dc discord.Client, i *discordgo.Interaction) bool {
+	customID := i.MessageComponentData().CustomID
+	var id string
+	var approved bool
+	switch {
+	case strings.HasPrefix(customID, approveButtonPrefix):
+		id, approved = strings.TrimPrefix(customID, approveButtonPrefix), true
+	case strings.HasPrefix(customID, rejectButtonPrefix):
+		id, approved = strings.TrimPrefix(customID, rejectButtonPrefix), false
+	default:
+		return false
+	}
+	user, roles := interactionUser(i)
+	pending, ok := svc.approvals.peek(id)
+	switch {
+	case !ok:
+		svc.respondError(dc, i, ErrApprovalNotFound)
+		return true
+	case !svc.isApprover(roles):
+		svc.respondError(dc, i, ErrNotApprover)
+		return true
+	case approved && user.ID == pending.origin.UserID:
+		svc.respondError(dc, i, ErrSelfApproval)
+		return true
+	}
+	if pending, ok = svc.approvals.take(id); !ok {
+		svc.respondError(dc, i, ErrApprovalNotFound)
+		return true
+	}
+	err := dc.RespondInteraction(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		svc.logger.Error("acknowledge approval button", zap.Error(err))
+	}
+
+	request := fmt.Sprintf("<@%s> wanted to run `%s` on %s", pending.origin.UserID, pending.cmd, pending.server)
+	if !approved {
+		svc.logger.Info("approval rejected", zap.String("id", id), zap.String("approver", user.ID))
+		svc.recordUnapproved(pending, "rejected by approver", &audit.Approval{
+			UserID:   user.ID,
+			Username: user.String(),
+			Time:     time.Now(),
+			Rejected: true,
+		})
+		svc.editApprovalMessage(dc, pending, fmt.Sprintf("Rejected by <@%s>: %s.", user.ID, request))
+		pending.reply(fmt.Sprintf("Rejected by <@%s>.", user.ID))
+		return true
+	}
+
+	svc.logger.Info("approval granted", zap.String("id", id), zap.String("approver", user.ID))
+	svc.editApprovalMessage(dc, pending, fmt.Sprintf("Approved by <@%s>: %s. Working on it..", user.ID, request))
+	ctx = audit.WithOrigin(ctx, pending.origin)
+	ctx = audit.WithApproval(ctx, audit.Approval{
+		UserID:   user.ID,
+		Username: user.String(),
+		Time:     time.Now(),
+	})
+	ctx, cancel := svc.commandContext(ctx)
+	defer cancel()
+	content, embeds := svc.run(ctx, pending.origin.ChannelID, pending.server, pending.cmd)
+	result := fmt.Sprintf("Approved by <@%s>: %s.\n%s", user.ID, request, content)
+	if len(result) > discord.MessageLimit {
+		// the requester gets the whole output
+		result = fmt.Sprintf("Approved by <@%s>: %s. The output was sent to the requester.", user.ID, request)
+	}
+	svc.editApprovalMessage(dc, pending, result, embeds...)
+	pending.reply(fmt.Sprintf("Approved by <@%s>:\n%s", user.ID, content), embeds...)
+	return true
+}
+
+// recordUnapproved records a command that never ran because its approval
+// request was rejected or expired. Approved commands are recorded when they
+// run.
+func (svc *Service) recordUnapproved(pending *approval, decision string, approval *audit.Approval) {
+	entry := &audit.Entry{
+		Origin:   pending.origin,
+		Approval: approval,
+		Server:   pending.server,
+		Command:  pending.cmd,
+		Decision: decision,
+	}
+	if err := svc.auditLog.Record(entry); err != nil {
+		svc.logger.Error("record audit entry", zap.String("id", pending.id), zap.Error(err))
+	}
+}
+
+// editApprovalMessage replaces the content and embeds of an approval request
+// and removes its buttons.
+func (svc *Service) editApprovalMessage(dc discord.Client, pending *approval, content string, embeds ...*discordgo.MessageEmbed) {
+	edit := discordgo.NewMessageEdit(pending.channelID, pending.messageID).SetContent(content)
+	edit.Components = []discordgo.MessageComponent{}
+	edit.Embeds = embeds
+	if _, err := dc.EditMessageComplex(edit); err != nil {
+		svc.logger.Error("edit approval request", zap.String("id", pending.id), zap.Error(err))
+	}
+}
@@ -0,0 +1,220 @@
+package botv2i
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/audit"
+	"github.com/cezarmathe/stevebot/internal/discord/discordtest"
+)
+
+const (
+	testApprovalChannel = "approvals"
+	testApproverRole    = "moderators"
+)
+
+func newApprovalConfig() *Config {
+	return &Config{
+		ApprovalCommands: []string{"op", "whitelist remove"},
+		ApprovalChannel:  testApprovalChannel,
+		ApproverRoles:    []string{testApproverRole},
+		ApprovalTimeout:  time.Second,
+	}
+}
+
+// newTestAuditLog opens an audit log in a temporary directory.
+func newTestAuditLog(t *testing.T) *audit.Log {
+	t.Helper()
+
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { auditLog.Close() })
+	return auditLog
+}
+
+// auditEntries returns every entry of an audit log, newest first.
+func auditEntries(t *testing.T, auditLog *audit.Log) []audit.Entry {
+	t.Helper()
+
+	entries, err := auditLog.Query(audit.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+// requestApproval sends a command that needs approval and returns the
+// approval request.
+func requestApproval(t *testing.T, svc Service, dc *discordtest.Client, content string) *discordgo.Message {
+	t.Helper()
+
+	svc.HandleCommand(context.Background(), dc, newMessage(content))
+	for _, event := range dc.Timeline() {
+		if event.Kind == discordtest.Send && event.ChannelID == testApprovalChannel {
+			message, _ := dc.Message(event.MessageID)
+			return message
+		}
+	}
+	t.Fatalf("no approval request in timeline %v", dc.Timeline())
+	return nil
+}
+
+func TestApprovalApproved(t *testing.T) {
+	steve := &fakeSteve{out: "Made steve a server operator"}
+	svc := newTestService(t, newApprovalConfig(), nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	request := requestApproval(t, svc, dc, "~op steve")
+	feedback, _ := dc.Message("1")
+	if !strings.Contains(feedback.Content, "needs the approval") {
+		t.Errorf("got feedback %q, want a pending approval", feedback.Content)
+	}
+	if cmds := steve.commands(); len(cmds) != 0 {
+		t.Fatalf("steve received %q before the approval", cmds)
+	}
+
+	// the author can't approve their own command, even as an approver
+	svc.HandleInteraction(context.Background(), dc, click(request, "user", 0, testApproverRole))
+	// nor can someone who is not an approver
+	svc.HandleInteraction(context.Background(), dc, click(request, "someone", 0))
+	svc.HandleInteraction(context.Background(), dc, click(request, "moderator", 0, testApproverRole))
+
+	var rejections []string
+	for _, event := range dc.Timeline() {
+		if event.Kind == discordtest.Respond && event.Content != "" {
+			rejections = append(rejections, event.Content)
+		}
+	}
+	if len(rejections) != 2 || !strings.Contains(rejections[0], ErrSelfApproval.Error()) ||
+		!strings.Contains(rejections[1], ErrNotApprover.Error()) {
+		t.Errorf("got rejections %q", rejections)
+	}
+	if cmds := steve.commands(); len(cmds) != 1 || cmds[0] != "op steve" {
+		t.Errorf("steve received %q", cmds)
+	}
+	feedback, _ = dc.Message("1")
+	if !strings.Contains(feedback.Content, "Approved by <@moderator>") ||
+		!strings.Contains(feedback.Content, "Made steve a server operator") {
+		t.Errorf("got feedback %q, want the approved result", feedback.Content)
+	}
+	request, _ = dc.Message(request.ID)
+	if len(request.Components) != 0 || !strings.Contains(request.Content, "Made steve a server operator") {
+		t.Errorf("got approval request %q, want the result without buttons", request.Content)
+	}
+}
+
+func TestApprovalRejected(t *testing.T) {
+	steve := &fakeSteve{}
+	svc := newTestService(t, newApprovalConfig(), nil, map[string]*fakeSteve{"default": steve})
+	svc.auditLog = newTestAuditLog(t)
+	dc := discordtest.NewClient(testBotUserID)
+
+	request := requestApproval(t, svc, dc, "~whitelist remove alex")
+	svc.HandleInteraction(context.Background(), dc, click(request, "moderator", 1, testApproverRole))
+	// a second decision on the same request
+	svc.HandleInteraction(context.Background(), dc, click(request, "other-moderator", 0, testApproverRole))
+
+	if cmds := steve.commands(); len(cmds) != 0 {
+		t.Errorf("steve received %q", cmds)
+	}
+	feedback, _ := dc.Message("1")
+	if feedback.Content != "Rejected by <@moderator>." {
+		t.Errorf("got feedback %q, want a rejection", feedback.Content)
+	}
+	got := dc.Timeline()
+	if last := got[len(got)-1]; !strings.Contains(last.Content, ErrApprovalNotFound.Error()) {
+		t.Errorf("got %v, want the second decision to fail", last)
+	}
+	entries := auditEntries(t, svc.auditLog)
+	if len(entries) != 1 || entries[0].Command != "whitelist remove alex" || entries[0].Allowed ||
+		entries[0].Origin.UserID != "user" || entries[0].Approval == nil ||
+		!entries[0].Approval.Rejected || entries[0].Approval.UserID != "moderator" {
+		t.Errorf("got audit entries %+v, want the rejection recorded", entries)
+	}
+	if got := formatAuditEntry(&entries[0]); !strings.Contains(got, "(rejected by ") {
+		t.Errorf("got %q, want the rejection shown", got)
+	}
+}
+
+func TestApprovalExpired(t *testing.T) {
+	steve := &fakeSteve{}
+	config := newApprovalConfig()
+	config.ApprovalTimeout = 10 * time.Millisecond
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": steve})
+	svc.auditLog = newTestAuditLog(t)
+	dc := discordtest.NewClient(testBotUserID)
+
+	requestApproval(t, svc, dc, "~op steve")
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		feedback, _ := dc.Message("1")
+		if strings.Contains(feedback.Content, ErrApprovalNotFound.Error()) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got feedback %q, want an expired approval", feedback.Content)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if cmds := steve.commands(); len(cmds) != 0 {
+		t.Errorf("steve received %q", cmds)
+	}
+	entries := auditEntries(t, svc.auditLog)
+	if len(entries) != 1 || entries[0].Command != "op steve" || entries[0].Allowed ||
+		entries[0].Decision != "approval expired" || entries[0].Approval != nil {
+		t.Errorf("got audit entries %+v, want the expiry recorded", entries)
+	}
+}
+
+func TestNeedsApproval(t *testing.T) {
+	svc := newTestService(t, newApprovalConfig(), nil, map[string]*fakeSteve{"default": {}})
+
+	tests := []struct {
+		cmd  string
+		want bool
+	}{
+		{"op steve", true},
+		{"/op steve", true},
+		{"minecraft:op steve", true},
+		{"/minecraft:whitelist remove alex", true},
+		{"execute as @a run op @s", true},
+		{"whitelist add alex", false},
+		{"/list", false},
+	}
+	for _, test := range tests {
+		if got := svc.needsApproval(test.cmd); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.cmd, got, test.want)
+		}
+	}
+}
+
+func TestApprovalPrefixed(t *testing.T) {
+	steve := &fakeSteve{}
+	svc := newTestService(t, newApprovalConfig(), nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	requestApproval(t, svc, dc, "~minecraft:op steve")
+
+	if cmds := steve.commands(); len(cmds) != 0 {
+		t.Errorf("steve received %q before the approval", cmds)
+	}
+}
+
+func TestValidateApprovers(t *testing.T) {
+	config := newApprovalConfig()
+	config.OutputFormat = "ansi"
+	if err := config.Validate(); err != nil {
+		t.Errorf("got %v, want a valid config", err)
+	}
+	config.ApproverRoles = nil
+	if err := config.Validate(); err == nil {
+		t.Error("got no error for approval commands without approvers")
+	}
+}
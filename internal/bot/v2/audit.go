@@ -0,0 +1,121 @@
+package botv2i
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/audit"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"go.uber.org/zap"
+)
+
+const (
+	auditDefaultLimit = 20
+	auditMaxLimit     = 50
+)
+
+// auditCommand queries the audit log.
+//
+// Usage: audit [user:<id|mention>] [since:<duration|date>] [until:<duration|date>] [limit:<n>] [command...]
+func (svc *Service) auditCommand(ctx context.Context, dc discord.Client, m *discordgo.MessageCreate, args []string) string {
+	q, err := parseAuditQuery(args, time.Now())
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err.Error())
+	}
+	entries, err := svc.auditLog.Query(q)
+	if err != nil {
+		svc.logger.Error("query audit log", zap.Error(err))
+		return "Error: can't query the audit log"
+	}
+	if len(entries) == 0 {
+		return "No audit entries found."
+	}
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteString(formatAuditEntry(&e))
+		b.WriteString("\n")
+	}
+	return codeBlock(b.String())
+}
+
+// parseAuditQuery parses the arguments of the audit command.
+func parseAuditQuery(args []string, now time.Time) (audit.Query, error) {
+	q := audit.Query{Limit: auditDefaultLimit}
+	command := make([]string, 0)
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, ":")
+		if !ok {
+			command = append(command, arg)
+			continue
+		}
+		var err error
+		switch key {
+		case "user":
+			q.UserID = strings.Trim(value, "<@!>")
+		case "since":
+			q.Since, err = parseAuditTime(value, now)
+		case "until":
+			q.Until, err = parseAuditTime(value, now)
+		case "limit":
+			q.Limit, err = strconv.Atoi(value)
+			if err == nil && (q.Limit < 1 || q.Limit > auditMaxLimit) {
+				err = fmt.Errorf("limit must be between 1 and %d", auditMaxLimit)
+			}
+		default:
+			command = append(command, arg)
+		}
+		if err != nil {
+			return q, fmt.Errorf("bad %s: %w", key, err)
+		}
+	}
+	q.Command = strings.Join(command, " ")
+	return q, nil
+}
+
+// parseAuditTime parses either a duration, meaning that long ago, or a date.
+func parseAuditTime(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+func formatAuditEntry(e *audit.Entry) string {
+	who := e.Origin.Username
+	if who == "" {
+		who = e.Origin.UserID
+	}
+	if e.Approval != nil {
+		approver := e.Approval.Username
+		if approver == "" {
+			approver = e.Approval.UserID
+		}
+		verb := "approved"
+		if e.Approval.Rejected {
+			verb = "rejected"
+		}
+		who += " (" + verb + " by " + approver + ")"
+	}
+	result := "ok"
+	switch {
+	case !e.Allowed:
+		result = e.Decision
+	case e.Error != "":
+		result = "error: " + e.Error
+	}
+	return fmt.Sprintf("#%d %s [%s] %s: %s -> %s (%s)",
+		e.ID,
+		e.Time.Format("2006-01-02 15:04:05"),
+		e.Server,
+		who,
+		e.Command,
+		result,
+		e.Latency.Round(time.Millisecond))
+}
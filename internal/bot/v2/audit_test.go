@@ -0,0 +1,63 @@
+package botv2i
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cezarmathe/stevebot/internal/audit"
+)
+
+func TestParseAuditQuery(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		args []string
+		want audit.Query
+	}{
+		{nil, audit.Query{Limit: auditDefaultLimit}},
+		{[]string{"user:<@123>"}, audit.Query{UserID: "123", Limit: auditDefaultLimit}},
+		{[]string{"user:<@!123>"}, audit.Query{UserID: "123", Limit: auditDefaultLimit}},
+		{[]string{"user:123"}, audit.Query{UserID: "123", Limit: auditDefaultLimit}},
+		{[]string{"since:90m"}, audit.Query{Since: now.Add(-90 * time.Minute), Limit: auditDefaultLimit}},
+		{[]string{"until:2026-10-01"}, audit.Query{Until: day, Limit: auditDefaultLimit}},
+		{[]string{"since:2026-10-01T10:00:00Z"}, audit.Query{Since: time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC), Limit: auditDefaultLimit}},
+		{[]string{"limit:5", "op", "steve"}, audit.Query{Command: "op steve", Limit: 5}},
+		{[]string{"limit:50"}, audit.Query{Limit: auditMaxLimit}},
+		// unknown keys are part of the command
+		{[]string{"tp", "steve", "minecraft:overworld"}, audit.Query{Command: "tp steve minecraft:overworld", Limit: auditDefaultLimit}},
+		{
+			[]string{"whitelist", "user:1", "since:1h", "add", "until:30m", "limit:1"},
+			audit.Query{UserID: "1", Command: "whitelist add", Since: now.Add(-time.Hour), Until: now.Add(-30 * time.Minute), Limit: 1},
+		},
+	}
+	for _, test := range tests {
+		got, err := parseAuditQuery(test.args, now)
+		if err != nil {
+			t.Errorf("%q: %v", test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %+v, want %+v", test.args, got, test.want)
+		}
+	}
+}
+
+func TestParseAuditQueryErrors(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	for _, args := range [][]string{
+		{"since:yesterday"},
+		{"until:5x"},
+		{"since:2026-13-01"},
+		{"limit:abc"},
+		{"limit:0"},
+		{"limit:51"},
+		{"op", "limit:-1"},
+	} {
+		if q, err := parseAuditQuery(args, now); err == nil {
+			t.Errorf("%q: got %+v, want an error", args, q)
+		}
+	}
+}
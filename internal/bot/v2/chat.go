@@ -0,0 +1,193 @@
+package botv2i
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/audit"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"github.com/cezarmathe/stevebot/internal/mcformat"
+	"github.com/cezarmathe/stevebot/internal/mclog"
+	"go.uber.org/zap"
+)
+
+const (
+	// Minecraft limits chat messages to 256 characters.
+	maxChatMessage   = 256
+	discordChatColor = "blue"
+)
+
+var (
+	userMentionRegexp    = regexp.MustCompile(`<@!?(\d+)>`)
+	roleMentionRegexp    = regexp.MustCompile(`<@&\d+>`)
+	channelMentionRegexp = regexp.MustCompile(`<#\d+>`)
+	customEmojiRegexp    = regexp.MustCompile(`<a?(:\w+:)\d+>`)
+
+	// The Minecraft font has no emoji, the most common ones are replaced by
+	// their emoticon.
+	emojiReplacer = strings.NewReplacer(
+		"😀", ":D", "😃", ":D", "😄", ":D", "😁", ":D", "😆", "xD",
+		"🙂", ":)", "😊", ":)", "😉", ";)", "😛", ":P", "😜", ";P",
+		"🙁", ":(", "☹️", ":(", "😢", ":'(", "😭", ":'(", "😮", ":O",
+		"😐", ":|", "❤️", "<3", "❤", "<3", "👍", "+1", "👎", "-1",
+	)
+	markdownReplacer = strings.NewReplacer(
+		`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "|", `\|`, ">", `\>`,
+	)
+)
+
+// chatComponent is a component of the JSON text of a tellraw command.
+type chatComponent struct {
+	Text  string `json:"text"`
+	Color string `json:"color,omitempty"`
+}
+
+// chatServers returns the servers whose chat is bridged with a channel.
+func (svc *Service) chatServers(channelID string) []string {
+	var servers []string
+	for server, channel := range svc.config.ChatChannels {
+		if channel == channelID {
+			servers = append(servers, server)
+		}
+	}
+	sort.Strings(servers)
+	return servers
+}
+
+// relayChat relays a message sent in a channel bridged with the chat of a
+// server to the game, and reports whether the message was meant for the
+// chat. Commands are not, messages of bots and webhooks are but are not
+// relayed, so that bridges do not echo each other.
+func (svc *Service) relayChat(ctx context.Context, m *discordgo.MessageCreate) bool {
+	servers := svc.chatServers(m.ChannelID)
+	if len(servers) == 0 {
+		return false
+	}
+	if svc.config.CommandPrefix != "" && strings.HasPrefix(m.Content, svc.config.CommandPrefix) {
+		return false
+	}
+	if m.Author.Bot || m.WebhookID != "" {
+		svc.logger.Debug("chat message sent by bot")
+		return true
+	}
+	text := chatText(m)
+	if text == "" {
+		return true
+	}
+	cmd, err := tellraw(displayName(m), text)
+	if err != nil {
+		svc.logger.Error("encode chat message", zap.Error(err))
+		return true
+	}
+	ctx = audit.WithOrigin(ctx, audit.Origin{
+		UserID:    m.Author.ID,
+		Username:  m.Author.String(),
+		GuildID:   m.GuildID,
+		ChannelID: m.ChannelID,
+		MessageID: m.ID,
+	})
+	ctx, cancel := svc.commandContext(ctx)
+	defer cancel()
+	for _, server := range servers {
+		steve, err := svc.servers.Get(server)
+		if err == nil {
+			_, err = steve.Execute(ctx, cmd)
+		}
+		if err != nil {
+			svc.logger.Warn("relay chat message", zap.String("server", server), zap.Error(err))
+		}
+	}
+	return true
+}
+
+// relayGameChat posts a chat message sent in the game to the channel bridged
+// with the chat of the server, if any.
+func (svc *Service) relayGameChat(dc discord.Client, server string, chat mclog.Chat) {
+	channelID, ok := svc.config.ChatChannels[server]
+	if !ok || channelID == "" {
+		return
+	}
+	send := &discordgo.MessageSend{
+		Content: fmt.Sprintf("**%s**: %s", escapeMarkdown(chat.Player), escapeMarkdown(mcformat.Strip(chat.Message))),
+		// players can't ping anyone from the game
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}
+	if _, err := dc.SendMessageComplex(channelID, send); err != nil {
+		svc.logger.Error("send chat message", zap.String("server", server), zap.Error(err))
+	}
+}
+
+// displayName returns the name of the author of a message in its guild.
+func displayName(m *discordgo.MessageCreate) string {
+	if m.Member != nil && m.Member.Nick != "" {
+		return m.Member.Nick
+	}
+	return m.Author.Username
+}
+
+// chatText returns the content of a message as it is shown in the game:
+// mentions and custom emoji are replaced by their names, attachments by
+// their file names and formatting codes are removed.
+func chatText(m *discordgo.MessageCreate) string {
+	names := make(map[string]string, len(m.Mentions))
+	for _, user := range m.Mentions {
+		names[user.ID] = user.Username
+	}
+	text := userMentionRegexp.ReplaceAllStringFunc(m.Content, func(mention string) string {
+		id := userMentionRegexp.FindStringSubmatch(mention)[1]
+		if name, ok := names[id]; ok {
+			return "@" + name
+		}
+		return "@user"
+	})
+	text = roleMentionRegexp.ReplaceAllString(text, "@role")
+	text = channelMentionRegexp.ReplaceAllString(text, "#channel")
+	text = customEmojiRegexp.ReplaceAllString(text, "$1")
+	text = emojiReplacer.Replace(text)
+	for _, attachment := range m.Attachments {
+		text += fmt.Sprintf(" [%s]", attachment.Filename)
+	}
+	// commands are a single line
+	text = strings.Join(strings.Fields(mcformat.Strip(text)), " ")
+	if runes := []rune(text); len(runes) > maxChatMessage {
+		text = string(runes[:maxChatMessage-1]) + "…"
+	}
+	return text
+}
+
+// tellraw returns a tellraw command showing a chat message sent from Discord
+// to every player.
+func tellraw(author, text string) (string, error) {
+	return tellrawTo("@a",
+		chatComponent{Text: "[Discord] ", Color: discordChatColor},
+		chatComponent{Text: fmt.Sprintf("<%s> ", mcformat.Strip(author))},
+		chatComponent{Text: text},
+	)
+}
+
+// tellrawTo returns a tellraw command showing the components to a player, or
+// to the players matched by a target selector.
+func tellrawTo(target string, components ...chatComponent) (string, error) {
+	// the following components inherit the style of the first one
+	components = append([]chatComponent{{Text: ""}}, components...)
+	// the JSON text is kept readable, Minecraft does not need <, > and & to
+	// be escaped
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(components); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("tellraw %s %s", target, strings.TrimSpace(b.String())), nil
+}
+
+// escapeMarkdown escapes the characters Discord formats text with.
+func escapeMarkdown(s string) string {
+	return markdownReplacer.Replace(s)
+}
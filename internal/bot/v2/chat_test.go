@@ -0,0 +1,90 @@
+package botv2i
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/discord/discordtest"
+	"github.com/cezarmathe/stevebot/internal/mclog"
+)
+
+func TestRelayChat(t *testing.T) {
+	steve := &fakeSteve{}
+	config := &Config{ChatChannels: map[string]string{"default": testChannelID}}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	m := newMessage(`hi <@42> "§cred" <:pog:123> 🙂` + "\nbye")
+	m.Member.Nick = "Steve§l"
+	m.Mentions = []*discordgo.User{{ID: "42", Username: "alex"}}
+	m.Attachments = []*discordgo.MessageAttachment{{Filename: "screenshot.png"}}
+	svc.HandleCommand(context.Background(), dc, m)
+
+	want := `tellraw @a [{"text":""},{"text":"[Discord] ","color":"blue"},{"text":"<Steve> "},` +
+		`{"text":"hi @alex \"red\" :pog: :) bye [screenshot.png]"}]`
+	if cmds := steve.commands(); len(cmds) != 1 || cmds[0] != want {
+		t.Errorf("steve received %q, want %q", cmds, want)
+	}
+	assertTimeline(t, dc)
+}
+
+func TestRelayChatIgnored(t *testing.T) {
+	steve := &fakeSteve{out: "There are 0 of a max of 20 players online: "}
+	config := &Config{ChatChannels: map[string]string{"default": testChannelID}}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	bot := newMessage("hello from another bridge")
+	bot.Author.Bot = true
+	webhook := newMessage("hello from a webhook")
+	webhook.WebhookID = "webhook"
+	own := newMessage("hello from stevebot")
+	own.Author.ID = testBotUserID
+	for _, m := range []*discordgo.MessageCreate{bot, webhook, own} {
+		svc.HandleCommand(context.Background(), dc, m)
+	}
+	// commands still work in bridged channels
+	svc.HandleCommand(context.Background(), dc, newMessage("~list"))
+
+	if cmds := steve.commands(); len(cmds) != 1 || cmds[0] != "list" {
+		t.Errorf("steve received %q, want only the command", cmds)
+	}
+}
+
+func TestHandleLogEventsChat(t *testing.T) {
+	config := &Config{ChatChannels: map[string]string{"default": testChannelID}}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": {}, "creative": {}})
+	dc := discordtest.NewClient(testBotUserID)
+
+	events := make(chan mclog.Event, 3)
+	events <- mclog.Chat{Player: "Steve_1", Message: "§agg @everyone *wow*"}
+	events <- mclog.Join{Player: "Steve_1"}
+	close(events)
+	svc.HandleLogEvents(context.Background(), dc, "default", events)
+	creative := make(chan mclog.Event, 1)
+	creative <- mclog.Chat{Player: "alex", Message: "not bridged"}
+	close(creative)
+	svc.HandleLogEvents(context.Background(), dc, "creative", creative)
+
+	assertTimeline(t, dc, discordtest.Event{Kind: discordtest.Send, Content: `**Steve\_1**: gg @everyone \*wow\*`})
+}
+
+func TestHandleLogEventsCanceled(t *testing.T) {
+	svc := newTestService(t, &Config{}, nil, map[string]*fakeSteve{"default": {}})
+	dc := discordtest.NewClient(testBotUserID)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		svc.HandleLogEvents(ctx, dc, "default", make(chan mclog.Event))
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("not stopped")
+	}
+}
@@ -0,0 +1,107 @@
+package botv2i
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"github.com/cezarmathe/stevebot/internal/mcformat"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNotAdmin = errors.New("only bot admins may run this command")
+)
+
+// botCommand is a command handled by the bot itself instead of being sent to
+// a Minecraft server. It returns the content of the reply, or nothing if it
+// replied itself. Bot commands that run commands on a server bound them with
+// the command timeout.
+type botCommand func(ctx context.Context, dc discord.Client, m *discordgo.MessageCreate, args []string) string
+
+// botCommands returns the commands handled by the bot, by name. Bot commands
+// are reserved for admins.
+func (svc *Service) botCommands() map[string]botCommand {
+	return map[string]botCommand{
+		"audit":  svc.auditCommand,
+		"dlq":    svc.dlqCommand,
+		"wlsync": svc.wlsyncCommand,
+	}
+}
+
+// userCommands returns the commands handled by the bot that anyone may run,
+// by name.
+func (svc *Service) userCommands() map[string]botCommand {
+	return map[string]botCommand{
+		"link":   svc.linkCommand,
+		"unlink": svc.unlinkCommand,
+		"whois":  svc.whoisCommand,
+		"mcname": svc.mcnameCommand,
+	}
+}
+
+// isAdmin returns whether the author of a message is a bot admin.
+func (svc *Service) isAdmin(m *discordgo.MessageCreate) bool {
+	for _, id := range svc.config.AdminUsers {
+		if id == m.Author.ID {
+			return true
+		}
+	}
+	if m.Member == nil {
+		return false
+	}
+	for _, id := range svc.config.AdminRoles {
+		for _, role := range m.Member.Roles {
+			if id == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleBotCommand runs a bot command, if argv names one, and returns whether
+// it did.
+func (svc *Service) handleBotCommand(ctx context.Context, dc discord.Client, m *discordgo.MessageCreate, argv []string) bool {
+	if len(argv) == 0 {
+		return false
+	}
+	cmd, admin := svc.botCommands()[argv[0]]
+	if !admin {
+		var ok bool
+		if cmd, ok = svc.userCommands()[argv[0]]; !ok {
+			return false
+		}
+	}
+	var reply string
+	if !admin || svc.isAdmin(m) {
+		reply = cmd(ctx, dc, m, argv[1:])
+	} else {
+		reply = fmt.Sprintf("Error: %s", ErrNotAdmin.Error())
+	}
+	if reply == "" {
+		return true
+	}
+	// replies mention users, e.g. whois, without pinging them
+	send := &discordgo.MessageSend{Content: reply, AllowedMentions: &discordgo.MessageAllowedMentions{}}
+	if _, err := dc.SendMessageComplex(m.ChannelID, send); err != nil {
+		svc.logger.Error("send bot command reply", zap.String("cmd", argv[0]), zap.Error(err))
+	}
+	return true
+}
+
+// codeBlock wraps text in a code block, without formatting codes, cutting it
+// short so that the message stays under the Discord limit.
+func codeBlock(text string) string {
+	return codeBlockWithin(text, discord.MessageLimit)
+}
+
+// codeBlockWithin wraps text in a code block of at most limit bytes, without
+// formatting codes.
+func codeBlockWithin(text string, limit int) string {
+	text = truncate(mcformat.Strip(text), limit-len("```\n\n```"))
+	return "```\n" + strings.TrimSpace(text) + "\n```"
+}
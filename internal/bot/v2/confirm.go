@@ -0,0 +1,227 @@
+package botv2i
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"go.uber.org/zap"
+)
+
+const (
+	confirmButtonPrefix = "confirm:"
+	cancelButtonPrefix  = "cancel:"
+)
+
+var (
+	ErrConfirmationNotFound = errors.New("this confirmation has expired")
+	ErrNotYourConfirmation  = errors.New("only the user who sent the command may confirm it")
+)
+
+// confirmation is a dangerous command waiting for its author to confirm or
+// cancel it.
+type confirmation struct {
+	id       string
+	userID   string
+	decision chan bool
+}
+
+// confirmations holds the pending confirmations, by id.
+type confirmations struct {
+	mu      sync.Mutex
+	pending map[string]*confirmation
+}
+
+func newConfirmations() *confirmations {
+	return &confirmations{pending: make(map[string]*confirmation)}
+}
+
+// add a pending confirmation for a command sent by a user.
+func (c *confirmations) add(id, userID string) *confirmation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending := &confirmation{id: id, userID: userID, decision: make(chan bool, 1)}
+	c.pending[id] = pending
+	return pending
+}
+
+// decide confirms or cancels a pending confirmation on behalf of a user.
+func (c *confirmations) decide(id, userID string, confirmed bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending, ok := c.pending[id]
+	if !ok {
+		return ErrConfirmationNotFound
+	}
+	if pending.userID != userID {
+		return ErrNotYourConfirmation
+	}
+	delete(c.pending, id)
+	pending.decision <- confirmed
+	return nil
+}
+
+// expire removes a pending confirmation and returns whether it was still
+// pending, i.e. nobody decided on it in the meantime.
+func (c *confirmations) expire(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.pending[id]; !ok {
+		return false
+	}
+	delete(c.pending, id)
+	return true
+}
+
+// needsConfirmation returns whether a command is marked as dangerous.
+func (svc *Service) needsConfirmation(cmd string) bool {
+	// dangerous commands are the ones denied by the list, which sees through
+	// "/stop", "minecraft:stop" and "execute ... run stop" like the server
+	return !svc.dangerous.Evaluate(cmd).Allowed
+}
+
+// await waits for the author of a command to confirm or cancel it, and
+// returns whether they confirmed it and the new content of the confirmation
+// message. A confirmation that is not decided on before the confirmation
+// timeout, or before ctx is done, expires.
+func (svc *Service) await(ctx context.Context, pending *confirmation) (bool, string) {
+	var timeout <-chan time.Time
+	if svc.config.ConfirmationTimeout > 0 {
+		timer := time.NewTimer(svc.config.ConfirmationTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var confirmed, expired bool
+	select {
+	case confirmed = <-pending.decision:
+	case <-timeout:
+		expired = true
+	case <-ctx.Done():
+		expired = true
+	}
+	if expired {
+		if svc.confirmations.expire(pending.id) {
+			return false, "Confirmation expired."
+		}
+		// decided on while expiring
+		confirmed = <-pending.decision
+	}
+	if !confirmed {
+		return false, "Cancelled."
+	}
+	return true, "Working on it.."
+}
+
+// confirmationPrompt returns the content and the buttons of a confirmation
+// message.
+func (svc *Service) confirmationPrompt(id, userID, server, cmd string) (string, []discordgo.MessageComponent) {
+	content := fmt.Sprintf("<@%s>, `%s` on %s is a dangerous command. Are you sure?", userID, cmd, server)
+	if svc.config.ConfirmationTimeout > 0 {
+		content += fmt.Sprintf(" (expires in %s)", svc.config.ConfirmationTimeout)
+	}
+	return content, []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Confirm",
+				Style:    discordgo.DangerButton,
+				CustomID: confirmButtonPrefix + id,
+			},
+			discordgo.Button{
+				Label:    "Cancel",
+				Style:    discordgo.SecondaryButton,
+				CustomID: cancelButtonPrefix + id,
+			},
+		}},
+	}
+}
+
+// confirmMessage asks the author of a message command to confirm it, and
+// returns the confirmation message, which shows the progress of the command
+// once confirmed, or nil if the command was not confirmed.
+func (svc *Service) confirmMessage(ctx context.Context, dc discord.Client, m *discordgo.MessageCreate, server, cmd string) *discordgo.Message {
+	pending := svc.confirmations.add(m.ID, m.Author.ID)
+	content, components := svc.confirmationPrompt(m.ID, m.Author.ID, server, cmd)
+	cmsg, err := dc.SendMessageComplex(m.ChannelID, &discordgo.MessageSend{
+		Content:    content,
+		Components: components,
+	})
+	if err != nil {
+		svc.confirmations.expire(m.ID)
+		svc.logger.Error("send confirmation message", zap.Error(err))
+		return nil
+	}
+	confirmed, content := svc.await(ctx, pending)
+	edit := discordgo.NewMessageEdit(cmsg.ChannelID, cmsg.ID).SetContent(content)
+	edit.Components = []discordgo.MessageComponent{}
+	if _, err := dc.EditMessageComplex(edit); err != nil {
+		svc.logger.Error("edit confirmation message", zap.Error(err))
+	}
+	if !confirmed {
+		return nil
+	}
+	return cmsg
+}
+
+// confirmInteraction asks the author of a slash command to confirm it in the
+// response to the interaction, and returns whether they confirmed it.
+func (svc *Service) confirmInteraction(ctx context.Context, dc discord.Client, i *discordgo.Interaction, userID, server, cmd string) bool {
+	pending := svc.confirmations.add(i.ID, userID)
+	content, components := svc.confirmationPrompt(i.ID, userID, server, cmd)
+	err := dc.RespondInteraction(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: components,
+		},
+	})
+	if err != nil {
+		svc.confirmations.expire(i.ID)
+		svc.logger.Error("send confirmation response", zap.Error(err))
+		return false
+	}
+	confirmed, content := svc.await(ctx, pending)
+	if _, err := dc.EditInteractionResponse(i, &discordgo.WebhookEdit{
+		Content:    &content,
+		Components: &[]discordgo.MessageComponent{},
+	}); err != nil {
+		svc.logger.Error("edit confirmation response", zap.Error(err))
+	}
+	return confirmed
+}
+
+// handleConfirmationButton handles clicks on the buttons of a confirmation
+// message, and returns whether the interaction was one. The message itself is
+// updated by whoever waits for the confirmation.
+func (svc *Service) handleConfirmationButton(dc discord.Client, i *discordgo.Interaction) bool {
+	customID := i.MessageComponentData().CustomID
+	var id string
+	var confirmed bool
+	switch {
+	case strings.HasPrefix(customID, confirmButtonPrefix):
+		id, confirmed = strings.TrimPrefix(customID, confirmButtonPrefix), true
+	case strings.HasPrefix(customID, cancelButtonPrefix):
+		id, confirmed = strings.TrimPrefix(customID, cancelButtonPrefix), false
+	default:
+		return false
+	}
+	user, _ := interactionUser(i)
+	if err := svc.confirmations.decide(id, user.ID, confirmed); err != nil {
+		svc.respondError(dc, i, err)
+		return true
+	}
+	err := dc.RespondInteraction(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		svc.logger.Error("acknowledge confirmation button", zap.Error(err))
+	}
+	return true
+}
@@ -0,0 +1,194 @@
+package botv2i
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/discord/discordtest"
+)
+
+// waitForEvent waits for the n-th operation performed on dc and returns it.
+func waitForEvent(t *testing.T, dc *discordtest.Client, n int) discordtest.Event {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if events := dc.Timeline(); len(events) > n {
+			return events[n]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for event %d, got %v", n, dc.Timeline())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// click creates a click on a button of a message sent by the bot, by a user
+// holding the given roles.
+func click(message *discordgo.Message, userID string, button int, roles ...string) *discordgo.InteractionCreate {
+	row := message.Components[0].(discordgo.ActionsRow)
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:        "click-" + userID,
+		Type:      discordgo.InteractionMessageComponent,
+		ChannelID: message.ChannelID,
+		Message:   message,
+		Member:    &discordgo.Member{User: &discordgo.User{ID: userID}, Roles: roles},
+		Data: discordgo.MessageComponentInteractionData{
+			CustomID:      row.Components[button].(discordgo.Button).CustomID,
+			ComponentType: discordgo.ButtonComponent,
+		},
+	}}
+}
+
+func TestHandleCommandConfirmed(t *testing.T) {
+	steve := &fakeSteve{out: "Stopping the server"}
+	config := &Config{DangerousCommands: []string{"stop"}, ConfirmationTimeout: time.Second}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	done := make(chan struct{})
+	go func() {
+		svc.HandleCommand(context.Background(), dc, newMessage("~stop"))
+		close(done)
+	}()
+	prompt := waitForEvent(t, dc, 0)
+	if prompt.Kind != discordtest.Send || !strings.Contains(prompt.Content, "dangerous command") {
+		t.Fatalf("got %v, want a confirmation prompt", prompt)
+	}
+	if cmds := steve.commands(); len(cmds) != 0 {
+		t.Fatalf("steve received %q before the confirmation", cmds)
+	}
+	message, _ := dc.Message(prompt.MessageID)
+
+	// only the author may confirm
+	svc.HandleInteraction(context.Background(), dc, click(message, "someone-else", 0))
+	if got := waitForEvent(t, dc, 1); !strings.Contains(got.Content, ErrNotYourConfirmation.Error()) {
+		t.Fatalf("got %v, want a rejected confirmation", got)
+	}
+	svc.HandleInteraction(context.Background(), dc, click(message, "user", 0))
+	<-done
+
+	message, _ = dc.Message(prompt.MessageID)
+	if message.Content != "Stopping the server" || len(message.Components) != 0 {
+		t.Errorf("got message %q with %d components, want the command output", message.Content, len(message.Components))
+	}
+	if cmds := steve.commands(); len(cmds) != 1 || cmds[0] != "stop" {
+		t.Errorf("steve received %q", cmds)
+	}
+}
+
+func TestHandleCommandCancelled(t *testing.T) {
+	steve := &fakeSteve{}
+	config := &Config{DangerousCommands: []string{"ban"}, ConfirmationTimeout: time.Second}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	done := make(chan struct{})
+	go func() {
+		svc.HandleCommand(context.Background(), dc, newMessage("~ban alex"))
+		close(done)
+	}()
+	prompt := waitForEvent(t, dc, 0)
+	message, _ := dc.Message(prompt.MessageID)
+	svc.HandleInteraction(context.Background(), dc, click(message, "user", 1))
+	<-done
+
+	message, _ = dc.Message(prompt.MessageID)
+	if message.Content != "Cancelled." {
+		t.Errorf("got message %q, want it cancelled", message.Content)
+	}
+	if cmds := steve.commands(); len(cmds) != 0 {
+		t.Errorf("steve received %q", cmds)
+	}
+}
+
+func TestHandleCommandConfirmationExpired(t *testing.T) {
+	steve := &fakeSteve{}
+	config := &Config{DangerousCommands: []string{"stop"}, ConfirmationTimeout: 10 * time.Millisecond}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~stop"))
+
+	got := dc.Timeline()
+	if len(got) != 2 || got[1].Content != "Confirmation expired." {
+		t.Fatalf("got timeline %v, want an expired confirmation", got)
+	}
+	// a click on a stale copy of the prompt
+	message := &discordgo.Message{ID: got[0].MessageID, ChannelID: got[0].ChannelID, Components: got[0].Components}
+	svc.HandleInteraction(context.Background(), dc, click(message, "user", 0))
+	if got := waitForEvent(t, dc, 2); !strings.Contains(got.Content, ErrConfirmationNotFound.Error()) {
+		t.Errorf("got %v, want an expired confirmation error", got)
+	}
+	if cmds := steve.commands(); len(cmds) != 0 {
+		t.Errorf("steve received %q", cmds)
+	}
+}
+
+func TestHandleInteractionConfirmed(t *testing.T) {
+	steve := &fakeSteve{out: "Made steve a server operator"}
+	config := &Config{SlashCommand: "mc", DangerousCommands: []string{"op"}, ConfirmationTimeout: time.Second}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	i := newInteraction(discordgo.InteractionApplicationCommand, "run", stringOption("command", "op steve", false))
+	done := make(chan struct{})
+	go func() {
+		svc.HandleInteraction(context.Background(), dc, i)
+		close(done)
+	}()
+	if prompt := waitForEvent(t, dc, 0); prompt.Kind != discordtest.Respond || len(prompt.Components) == 0 {
+		t.Fatalf("got %v, want a confirmation prompt", prompt)
+	}
+	message, _ := dc.Response(i.ID)
+	svc.HandleInteraction(context.Background(), dc, click(message, "user", 0))
+	<-done
+
+	message, _ = dc.Response(i.ID)
+	if message.Content != "Made steve a server operator" {
+		t.Errorf("got response %q, want the command output", message.Content)
+	}
+}
+
+func TestNeedsConfirmation(t *testing.T) {
+	svc := newTestService(t, &Config{DangerousCommands: []string{"stop", "op"}}, nil, map[string]*fakeSteve{"default": {}})
+
+	tests := []struct {
+		cmd  string
+		want bool
+	}{
+		{"stop", true},
+		{"/stop", true},
+		{"minecraft:stop", true},
+		{"/minecraft:op steve", true},
+		{"execute as @a run op @s", true},
+		{"list", false},
+		{"/list", false},
+		{"deop steve", false},
+	}
+	for _, test := range tests {
+		if got := svc.needsConfirmation(test.cmd); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.cmd, got, test.want)
+		}
+	}
+}
+
+func TestHandleCommandConfirmationPrefixed(t *testing.T) {
+	steve := &fakeSteve{}
+	config := &Config{DangerousCommands: []string{"stop"}, ConfirmationTimeout: 10 * time.Millisecond}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~minecraft:stop"))
+
+	got := dc.Timeline()
+	if len(got) != 2 || got[1].Content != "Confirmation expired." {
+		t.Fatalf("got timeline %v, want an expired confirmation", got)
+	}
+	if cmds := steve.commands(); len(cmds) != 0 {
+		t.Errorf("steve received %q", cmds)
+	}
+}
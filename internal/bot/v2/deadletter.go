@@ -0,0 +1,106 @@
+package botv2i
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/deadletter"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"go.uber.org/zap"
+)
+
+const (
+	dlqListLimit = 20
+	// commands are cut short in messages, the output gets the rest
+	dlqMaxCommand = 500
+)
+
+// NotifyDeadLetter posts the late result of a command to the channel the
+// command was sent from.
+func (svc *Service) NotifyDeadLetter(dc discord.Client, l deadletter.Letter) {
+	if l.Origin.ChannelID == "" {
+		return
+	}
+	header := fmt.Sprintf("Late result of `%s` on %s (dead letter #%d, requested by <@%s>):\n",
+		truncate(l.Command, dlqMaxCommand), l.Server, l.ID, l.Origin.UserID)
+	// the requester is named, not pinged
+	send := &discordgo.MessageSend{
+		Content:         withDeadLetterResult(header, &l),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}
+	if _, err := dc.SendMessageComplex(l.Origin.ChannelID, send); err != nil {
+		svc.logger.Error("send dead letter notification", zap.Uint64("id", l.ID), zap.Error(err))
+	}
+}
+
+// dlqCommand inspects and replays dead letters.
+//
+// Usage: dlq list | dlq show <id> | dlq replay <id> | dlq delete <id>
+func (svc *Service) dlqCommand(ctx context.Context, dc discord.Client, m *discordgo.MessageCreate, args []string) string {
+	if svc.deadLetters == nil {
+		return "Error: the dead letter queue is not enabled"
+	}
+	if len(args) == 0 || args[0] == "list" {
+		letters, err := svc.deadLetters.List(dlqListLimit)
+		if err != nil {
+			svc.logger.Error("list dead letters", zap.Error(err))
+			return "Error: can't list dead letters"
+		}
+		if len(letters) == 0 {
+			return "The dead letter queue is empty."
+		}
+		var b strings.Builder
+		for _, l := range letters {
+			fmt.Fprintf(&b, "#%d %s [%s] %s: %s\n",
+				l.ID, l.Time.Format("2006-01-02 15:04:05"), l.Server, l.Origin.Username, l.Command)
+		}
+		return codeBlock(b.String())
+	}
+
+	if len(args) != 2 {
+		return "Error: usage: dlq list | dlq show <id> | dlq replay <id> | dlq delete <id>"
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(args[1], "#"), 10, 64)
+	if err != nil {
+		return fmt.Sprintf("Error: bad dead letter id %q", args[1])
+	}
+	l, err := svc.deadLetters.Get(id)
+	if err != nil {
+		if !errors.Is(err, deadletter.ErrNotFound) {
+			svc.logger.Error("get dead letter", zap.Uint64("id", id), zap.Error(err))
+		}
+		return fmt.Sprintf("Error: %s", err.Error())
+	}
+
+	switch args[0] {
+	case "show":
+		header := fmt.Sprintf("Dead letter #%d\nTime: %s\nServer: %s\nRequested by: %s in <#%s>\nCommand: `%s`\n",
+			l.ID, l.Time.Format("2006-01-02 15:04:05"), l.Server, l.Origin.Username, l.Origin.ChannelID,
+			truncate(l.Command, dlqMaxCommand))
+		return withDeadLetterResult(header, &l)
+	case "replay":
+		// replays are confirmed, approved and audited like any command
+		svc.runCommand(ctx, dc, m, l.Server, l.Command, fmt.Sprintf("Replay of dead letter #%d:\n", l.ID))
+		return ""
+	case "delete":
+		if err := svc.deadLetters.Delete(l.ID); err != nil {
+			return fmt.Sprintf("Error: %s", err.Error())
+		}
+		return fmt.Sprintf("Deleted dead letter #%d.", l.ID)
+	default:
+		return fmt.Sprintf("Error: unknown dlq subcommand %q", args[0])
+	}
+}
+
+// withDeadLetterResult appends the result of a dead letter to header, cutting
+// it short so that the message stays under the Discord limit.
+func withDeadLetterResult(header string, l *deadletter.Letter) string {
+	if l.Error != "" {
+		return truncate(fmt.Sprintf("%sError: %s", header, l.Error), discord.MessageLimit)
+	}
+	return header + codeBlockWithin(l.Output, discord.MessageLimit-len(header))
+}
@@ -0,0 +1,179 @@
+package botv2i
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cezarmathe/stevebot/internal/audit"
+	"github.com/cezarmathe/stevebot/internal/deadletter"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"github.com/cezarmathe/stevebot/internal/discord/discordtest"
+)
+
+// newDeadLetterService returns a service with a dead letter queue holding the
+// given letters, in order.
+func newDeadLetterService(t *testing.T, config *Config, steve *fakeSteve, letters ...*deadletter.Letter) Service {
+	t.Helper()
+
+	config.AdminUsers = []string{"user"}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": steve})
+	queue, err := deadletter.Open(filepath.Join(t.TempDir(), "deadletters.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { queue.Close() })
+	for _, l := range letters {
+		if err := queue.Push(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc.deadLetters = queue
+	return svc
+}
+
+// newLetter returns a letter sent by "user" in the test channel.
+func newLetter(cmd, out string) *deadletter.Letter {
+	return &deadletter.Letter{
+		Server:  "default",
+		Command: cmd,
+		Origin:  audit.Origin{UserID: "user", Username: "steve", ChannelID: testChannelID},
+		Output:  out,
+	}
+}
+
+func TestNotifyDeadLetter(t *testing.T) {
+	svc := newDeadLetterService(t, &Config{}, &fakeSteve{})
+	dc := discordtest.NewClient(testBotUserID)
+
+	l := newLetter("say "+strings.Repeat("a", 1400), strings.Repeat("output line\n", 300))
+	l.ID = 1
+	svc.NotifyDeadLetter(dc, *l)
+
+	got := dc.Timeline()
+	if len(got) != 1 || got[0].ChannelID != testChannelID {
+		t.Fatalf("got timeline %v, want the result posted in the channel of the command", got)
+	}
+	if len(got[0].Content) > discord.MessageLimit {
+		t.Errorf("notification is %d bytes long", len(got[0].Content))
+	}
+	if !strings.HasPrefix(got[0].Content, "Late result of `say aaa") || !strings.HasSuffix(got[0].Content, "```") {
+		t.Errorf("got %q, want the command and a closed code block", got[0].Content)
+	}
+	if mentions := got[0].AllowedMentions; mentions == nil || len(mentions.Parse) != 0 || len(mentions.Users) != 0 {
+		t.Errorf("got allowed mentions %+v, want none", mentions)
+	}
+}
+
+func TestDlqList(t *testing.T) {
+	svc := newDeadLetterService(t, &Config{}, &fakeSteve{}, newLetter("list", ""), newLetter("save-all", ""))
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~dlq list"))
+
+	got := dc.Timeline()
+	if len(got) != 1 {
+		t.Fatalf("got timeline %v", got)
+	}
+	if i, j := strings.Index(got[0].Content, "#2"), strings.Index(got[0].Content, "#1"); i < 0 || j < i {
+		t.Errorf("got %q, want the letters newest first", got[0].Content)
+	}
+}
+
+func TestDlqShow(t *testing.T) {
+	l := newLetter("say "+strings.Repeat("a", 1400), strings.Repeat("output line\n", 300))
+	failed := newLetter("list", "")
+	failed.Error = "connection reset"
+	svc := newDeadLetterService(t, &Config{}, &fakeSteve{}, l, failed)
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~dlq show 1"))
+	svc.HandleCommand(context.Background(), dc, newMessage("~dlq show #2"))
+	svc.HandleCommand(context.Background(), dc, newMessage("~dlq show 3"))
+
+	got := dc.Timeline()
+	if len(got) != 3 {
+		t.Fatalf("got timeline %v", got)
+	}
+	if len(got[0].Content) > discord.MessageLimit || !strings.HasSuffix(got[0].Content, "```") {
+		t.Errorf("got a %d bytes long letter %q, want it cut short", len(got[0].Content), got[0].Content)
+	}
+	if !strings.HasSuffix(got[1].Content, "Error: connection reset") {
+		t.Errorf("got %q, want the error of the letter", got[1].Content)
+	}
+	if got[2].Content != "Error: "+deadletter.ErrNotFound.Error() {
+		t.Errorf("got %q, want %q", got[2].Content, deadletter.ErrNotFound)
+	}
+}
+
+func TestDlqDelete(t *testing.T) {
+	svc := newDeadLetterService(t, &Config{}, &fakeSteve{}, newLetter("list", ""))
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~dlq delete 1"))
+
+	if _, err := svc.deadLetters.Get(1); !errors.Is(err, deadletter.ErrNotFound) {
+		t.Errorf("got %v, want the letter deleted", err)
+	}
+	assertTimeline(t, dc, discordtest.Event{Kind: discordtest.Send, Content: "Deleted dead letter #1."})
+}
+
+func TestDlqReplay(t *testing.T) {
+	steve := &fakeSteve{out: "Saved the game"}
+	svc := newDeadLetterService(t, &Config{}, steve, newLetter("save-all", ""))
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~dlq replay 1"))
+
+	if cmds := steve.commands(); len(cmds) != 1 || cmds[0] != "save-all" {
+		t.Errorf("steve received %q", cmds)
+	}
+	message, _ := dc.Message("1")
+	if message == nil || message.Content != "Replay of dead letter #1:\nSaved the game" {
+		t.Errorf("got message %+v, want the result of the replay", message)
+	}
+}
+
+func TestDlqReplayConfirmation(t *testing.T) {
+	steve := &fakeSteve{out: "Stopping the server"}
+	config := &Config{DangerousCommands: []string{"stop"}, ConfirmationTimeout: 10 * time.Millisecond}
+	svc := newDeadLetterService(t, config, steve, newLetter("/minecraft:stop", ""))
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~dlq replay 1"))
+
+	if cmds := steve.commands(); len(cmds) != 0 {
+		t.Errorf("steve received %q without a confirmation", cmds)
+	}
+	prompt := dc.Timeline()[0]
+	if !strings.Contains(prompt.Content, "dangerous command") {
+		t.Errorf("got %v, want a confirmation prompt", prompt)
+	}
+	if message, _ := dc.Message(prompt.MessageID); message.Content != "Confirmation expired." {
+		t.Errorf("got %q, want the confirmation expired", message.Content)
+	}
+}
+
+func TestDlqReplayApproval(t *testing.T) {
+	steve := &fakeSteve{out: "Made steve a server operator"}
+	config := newApprovalConfig()
+	svc := newDeadLetterService(t, config, steve, newLetter("op steve", ""))
+	dc := discordtest.NewClient(testBotUserID)
+
+	request := requestApproval(t, svc, dc, "~dlq replay 1")
+	if cmds := steve.commands(); len(cmds) != 0 {
+		t.Fatalf("steve received %q before the approval", cmds)
+	}
+	svc.HandleInteraction(context.Background(), dc, click(request, "moderator", 0, testApproverRole))
+
+	if cmds := steve.commands(); len(cmds) != 1 || cmds[0] != "op steve" {
+		t.Errorf("steve received %q", cmds)
+	}
+	feedback, _ := dc.Message("1")
+	if !strings.HasPrefix(feedback.Content, "Replay of dead letter #1:\n") || !strings.Contains(feedback.Content, "Made steve a server operator") {
+		t.Errorf("got feedback %q, want the result of the replay", feedback.Content)
+	}
+}
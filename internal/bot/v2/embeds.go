@@ -0,0 +1,132 @@
+package botv2i
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/mcoutput"
+)
+
+const (
+	// Minecraft green
+	embedColor = 0x55ff55
+
+	// Discord limits of embeds.
+	maxEmbedDescription = 4096
+	maxEmbedFields      = 25
+	maxEmbedFieldValue  = 1024
+
+	// Minecraft days are 24000 ticks long and start at 6:00.
+	ticksPerDay  = 24000
+	ticksPerHour = 1000
+)
+
+// renderEmbed renders the parsed output of a command run on a server as an
+// embed, nil if there is no renderer for it.
+func renderEmbed(server string, value interface{}) *discordgo.MessageEmbed {
+	var embed *discordgo.MessageEmbed
+	switch v := value.(type) {
+	case mcoutput.PlayerList:
+		embed = &discordgo.MessageEmbed{
+			Title:       fmt.Sprintf("%d/%d players online", v.Online, v.Max),
+			Description: nameList(v.Players, "Nobody is online."),
+		}
+	case mcoutput.Whitelist:
+		embed = &discordgo.MessageEmbed{
+			Title:       fmt.Sprintf("Whitelist (%d)", len(v.Players)),
+			Description: nameList(v.Players, "Nobody is whitelisted."),
+		}
+	case mcoutput.Banlist:
+		embed = renderBanlist(v)
+	case mcoutput.Time:
+		embed = renderTime(v)
+	case mcoutput.Seed:
+		embed = &discordgo.MessageEmbed{
+			Title:       "Seed",
+			Description: fmt.Sprintf("`%d`", v.Value),
+		}
+	case mcoutput.Difficulty:
+		title := "Difficulty"
+		if v.Changed {
+			title = "Difficulty changed"
+		}
+		embed = &discordgo.MessageEmbed{Title: title, Description: v.Name}
+	case mcoutput.Objectives:
+		names := make([]string, 0, len(v.Objectives))
+		for _, objective := range v.Objectives {
+			name := objective.DisplayName
+			if objective.Name != "" {
+				name = fmt.Sprintf("%s (`%s`, %s)", objective.DisplayName, objective.Name, objective.Criteria)
+			}
+			names = append(names, name)
+		}
+		embed = &discordgo.MessageEmbed{
+			Title:       fmt.Sprintf("Scoreboard objectives (%d)", len(v.Objectives)),
+			Description: nameList(names, "There are no objectives."),
+		}
+	default:
+		return nil
+	}
+	embed.Color = embedColor
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: server}
+	return embed
+}
+
+func renderBanlist(v mcoutput.Banlist) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{Title: fmt.Sprintf("Bans (%d)", len(v.Bans))}
+	if len(v.Bans) == 0 {
+		embed.Description = "Nobody is banned."
+		return embed
+	}
+	for i, ban := range v.Bans {
+		if i == maxEmbedFields-1 && len(v.Bans) > maxEmbedFields {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:  "…",
+				Value: fmt.Sprintf("and %d more", len(v.Bans)-i),
+			})
+			break
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  ban.Target,
+			Value: truncate(fmt.Sprintf("By %s: %s", ban.Source, ban.Reason), maxEmbedFieldValue),
+		})
+	}
+	return embed
+}
+
+func renderTime(v mcoutput.Time) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{Title: "Time"}
+	switch v.Query {
+	case "daytime":
+		ticks := v.Value % ticksPerDay
+		hour := (ticks/ticksPerHour + 6) % 24
+		minute := ticks % ticksPerHour * 60 / ticksPerHour
+		embed.Description = fmt.Sprintf("%02d:%02d (%d ticks into the day)", hour, minute, ticks)
+	case "gametime":
+		embed.Description = fmt.Sprintf("%d ticks since the world was created (%d days)", v.Value, v.Value/ticksPerDay)
+	case "day":
+		embed.Description = fmt.Sprintf("Day %d", v.Value)
+	default:
+		embed.Description = fmt.Sprintf("%s: %d", v.Query, v.Value)
+	}
+	return embed
+}
+
+// nameList returns names as the description of an embed, or empty if there
+// are none.
+func nameList(names []string, empty string) string {
+	if len(names) == 0 {
+		return empty
+	}
+	return truncate(strings.Join(names, ", "), maxEmbedDescription)
+}
+
+// truncate cuts s short so that it is at most n bytes long.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	// drop the rune cut in half, if any
+	return strings.ToValidUTF8(s[:n-len("…")], "") + "…"
+}
@@ -0,0 +1,81 @@
+package botv2i
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cezarmathe/stevebot/internal/discord/discordtest"
+	"github.com/cezarmathe/stevebot/internal/mcoutput"
+)
+
+func TestHandleCommandEmbed(t *testing.T) {
+	steve := &fakeSteve{out: "There are 2 of a max of 20 players online: alex, steve"}
+	svc := newTestService(t, &Config{Embeds: true}, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~list"))
+
+	got := dc.Timeline()
+	if len(got) != 2 || len(got[1].Embeds) != 1 || got[1].Content != "" {
+		t.Fatalf("got timeline %v, want an edit with an embed", got)
+	}
+	embed := got[1].Embeds[0]
+	if embed.Title != "2/20 players online" || embed.Description != "alex, steve" || embed.Footer.Text != "default" {
+		t.Errorf("got embed %+v", embed)
+	}
+}
+
+func TestHandleCommandEmbedFallback(t *testing.T) {
+	steve := &fakeSteve{out: "Unknown or incomplete command, see below for error"}
+	svc := newTestService(t, &Config{Embeds: true}, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~list"))
+
+	assertTimeline(t, dc,
+		discordtest.Event{Kind: discordtest.Send, Content: "Working on it.."},
+		discordtest.Event{Kind: discordtest.Edit, Content: "Unknown or incomplete command, see below for error"})
+	if got := dc.Timeline(); len(got[1].Embeds) != 0 {
+		t.Errorf("got embeds %+v for unrecognized output", got[1].Embeds)
+	}
+}
+
+func TestRenderEmbed(t *testing.T) {
+	tests := []struct {
+		value       interface{}
+		title       string
+		description string
+	}{
+		{mcoutput.PlayerList{Max: 20}, "0/20 players online", "Nobody is online."},
+		{mcoutput.Whitelist{Players: []string{"alex"}}, "Whitelist (1)", "alex"},
+		{mcoutput.Time{Query: "daytime", Value: 18000}, "Time", "00:00 (18000 ticks into the day)"},
+		{mcoutput.Time{Query: "daytime", Value: 30500}, "Time", "12:30 (6500 ticks into the day)"},
+		{mcoutput.Seed{Value: 42}, "Seed", "`42`"},
+		{mcoutput.Difficulty{Name: "Hard", Changed: true}, "Difficulty changed", "Hard"},
+		{mcoutput.Objectives{Objectives: []mcoutput.Objective{{DisplayName: "Deaths"}}}, "Scoreboard objectives (1)", "Deaths"},
+	}
+	for _, test := range tests {
+		embed := renderEmbed("survival", test.value)
+		if embed == nil {
+			t.Errorf("%+v not rendered", test.value)
+			continue
+		}
+		if embed.Title != test.title || embed.Description != test.description {
+			t.Errorf("%+v: got %q %q, want %q %q", test.value, embed.Title, embed.Description, test.title, test.description)
+		}
+	}
+	if embed := renderEmbed("survival", "raw output"); embed != nil {
+		t.Errorf("raw output rendered as %+v", embed)
+	}
+}
+
+func TestRenderBanlist(t *testing.T) {
+	var list mcoutput.Banlist
+	for i := 0; i < 30; i++ {
+		list.Bans = append(list.Bans, mcoutput.Ban{Target: "steve", Source: "Server", Reason: "griefing"})
+	}
+	embed := renderEmbed("survival", list)
+	if len(embed.Fields) != maxEmbedFields || embed.Fields[maxEmbedFields-1].Value != "and 6 more" {
+		t.Errorf("got %d fields, last %+v", len(embed.Fields), embed.Fields[len(embed.Fields)-1])
+	}
+}
@@ -0,0 +1,41 @@
+package botv2i
+
+import (
+	"context"
+
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"github.com/cezarmathe/stevebot/internal/mclog"
+)
+
+// HandleLogEvents handles the events of the log of a server until events is
+// closed or ctx is done. Notifications held back are posted before it
+// returns.
+func (svc *Service) HandleLogEvents(ctx context.Context, dc discord.Client, server string, events <-chan mclog.Event) {
+	notifier := svc.newNotifier(dc, server)
+	defer notifier.flush()
+
+	for {
+		var event mclog.Event
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return
+		case <-notifier.flushes():
+			notifier.flush()
+			continue
+		case event, ok = <-events:
+			if !ok {
+				return
+			}
+		}
+		switch event := event.(type) {
+		case mclog.Chat:
+			// link codes are not relayed, they are of no use to anyone else
+			if !svc.completeLink(ctx, dc, server, event) {
+				svc.relayGameChat(dc, server, event)
+			}
+		default:
+			notifier.notify(event)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package botv2i
+
+import (
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cezarmathe/stevebot/internal/mcformat"
+	stevev2i "github.com/cezarmathe/stevebot/internal/steve/v2"
+)
+
+// formatFanOutResults renders the results of a command executed on a group of
+// servers as a table with one row per server.
+func formatFanOutResults(results []stevev2i.FanOutResult) string {
+	var b strings.Builder
+	b.WriteString("```\n")
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	tw.Write([]byte("SERVER\tSTATUS\tOUTPUT\n"))
+	for _, res := range results {
+		status, out := "ok", res.Out
+		if res.Err != nil {
+			status, out = "error", res.Err.Error()
+		}
+		// keep every server on a single row, without formatting codes that
+		// would break the alignment
+		out = strings.Join(strings.Fields(mcformat.Strip(out)), " ")
+		tw.Write([]byte(res.Server + "\t" + status + "\t" + out + "\n"))
+	}
+	tw.Flush()
+	b.WriteString("```")
+	return b.String()
+}
@@ -0,0 +1,336 @@
+package botv2i
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/audit"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"go.uber.org/zap"
+)
+
+const (
+	// Discord accepts at most 25 autocomplete choices.
+	maxAutocompleteChoices = 25
+)
+
+var (
+	ErrUnknownSlashCommand = errors.New("unknown command")
+	ErrInvalidPlayerName   = errors.New("invalid player name")
+)
+
+// ApplicationCommands returns the slash commands to register, nil if slash
+// commands are disabled.
+func (svc *Service) ApplicationCommands() []*discordgo.ApplicationCommand {
+	if svc.config.SlashCommand == "" {
+		return nil
+	}
+	serverOption := &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         "server",
+		Description:  "Server or group of servers to run the command on",
+		Autocomplete: true,
+	}
+	playerOption := &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         "player",
+		Description:  "Name of the player",
+		Required:     true,
+		Autocomplete: true,
+	}
+	return []*discordgo.ApplicationCommand{{
+		Name:        svc.config.SlashCommand,
+		Description: "Run commands on the Minecraft servers",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "run",
+				Description: "Run a command",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "command",
+						Description: "The command to run, without the leading slash",
+						Required:    true,
+					},
+					serverOption,
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List the online players",
+				Options:     []*discordgo.ApplicationCommandOption{serverOption},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+				Name:        "whitelist",
+				Description: "Manage the whitelist",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "add",
+						Description: "Add a player to the whitelist",
+						Options:     []*discordgo.ApplicationCommandOption{playerOption, serverOption},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "remove",
+						Description: "Remove a player from the whitelist",
+						Options:     []*discordgo.ApplicationCommandOption{playerOption, serverOption},
+					},
+				},
+			},
+		},
+	}}
+}
+
+// HandleInteraction handles slash commands, their autocompletions and clicks
+// on the buttons of the bot messages.
+func (svc *Service) HandleInteraction(ctx context.Context, dc discord.Client, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionMessageComponent:
+		if !svc.handleConfirmationButton(dc, i.Interaction) &&
+			!svc.handleApprovalButton(ctx, dc, i.Interaction) {
+			svc.handlePageButton(dc, i.Interaction)
+		}
+	case discordgo.InteractionApplicationCommand:
+		if i.ApplicationCommandData().Name != svc.config.SlashCommand {
+			return
+		}
+		svc.handleSlashCommand(ctx, dc, i.Interaction)
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		if i.ApplicationCommandData().Name != svc.config.SlashCommand {
+			return
+		}
+		svc.handleAutocomplete(ctx, dc, i.Interaction)
+	}
+}
+
+func (svc *Service) handleSlashCommand(ctx context.Context, dc discord.Client, i *discordgo.Interaction) {
+	user, roles := interactionUser(i)
+	path, options := slashCommandOptions(i.ApplicationCommandData().Options)
+	cmd, err := slashCommandLine(path, options)
+	if err != nil {
+		svc.respondError(dc, i, err)
+		return
+	}
+	server := options["server"]
+	if server == "" {
+		server = svc.channelServer(i.ChannelID)
+	}
+	svc.logger.Debug("handle slash command", zap.String("server", server), zap.String("cmd", cmd))
+	if err := svc.permissions.Check(user.ID, roles, cmd); err != nil {
+		svc.logger.Debug("permission denied", zap.String("author", user.ID), zap.Error(err))
+		svc.respondError(dc, i, err)
+		return
+	}
+
+	ctx = audit.WithOrigin(ctx, audit.Origin{
+		UserID:    user.ID,
+		Username:  user.String(),
+		GuildID:   i.GuildID,
+		ChannelID: i.ChannelID,
+		MessageID: i.ID,
+	})
+	if svc.needsConfirmation(cmd) {
+		if !svc.confirmInteraction(ctx, dc, i, user.ID, server, cmd) {
+			return
+		}
+	} else {
+		err = dc.RespondInteraction(i, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		})
+		if err != nil {
+			svc.logger.Error("defer interaction response", zap.Error(err))
+			return
+		}
+	}
+	reply := func(content string, embeds ...*discordgo.MessageEmbed) {
+		out := svc.paginate(i.ID, content)
+		edit := &discordgo.WebhookEdit{Content: &out.content, Files: out.files()}
+		if out.components != nil {
+			edit.Components = &out.components
+		}
+		if embeds != nil {
+			edit.Embeds = &embeds
+		}
+		_, err := dc.EditInteractionResponse(i, edit)
+		if err == nil {
+			return
+		}
+		// interaction tokens expire after 15 minutes, approvals may take longer
+		svc.logger.Warn("edit interaction response", zap.Error(err))
+		_, err = dc.SendMessageComplex(i.ChannelID, &discordgo.MessageSend{
+			Content:    out.content,
+			Components: out.components,
+			Embeds:     embeds,
+			Files:      out.files(),
+		})
+		if err != nil {
+			svc.logger.Error("send feedback message", zap.Error(err))
+		}
+	}
+	if svc.needsApproval(cmd) {
+		svc.requestApproval(ctx, dc, server, cmd, reply)
+		return
+	}
+	ctx, cancel := svc.commandContext(ctx)
+	defer cancel()
+	content, embeds := svc.run(ctx, i.ChannelID, server, cmd)
+	reply(content, embeds...)
+}
+
+func (svc *Service) handleAutocomplete(ctx context.Context, dc discord.Client, i *discordgo.Interaction) {
+	_, options := slashCommandOptions(i.ApplicationCommandData().Options)
+	focused := focusedOption(i.ApplicationCommandData().Options)
+	if focused == nil {
+		return
+	}
+	var candidates []string
+	switch focused.Name {
+	case "server":
+		candidates = append(svc.servers.Names(), svc.servers.Groups()...)
+	case "player":
+		server := options["server"]
+		if server == "" {
+			server = svc.channelServer(i.ChannelID)
+		}
+		user, roles := interactionUser(i)
+		if svc.permissions.Check(user.ID, roles, "list") != nil {
+			break
+		}
+		if svc.config.AutocompleteTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, svc.config.AutocompleteTimeout)
+			defer cancel()
+		}
+		ctx = audit.WithOrigin(ctx, audit.Origin{
+			UserID:    user.ID,
+			Username:  user.String(),
+			GuildID:   i.GuildID,
+			ChannelID: i.ChannelID,
+			MessageID: i.ID,
+		})
+		candidates = svc.onlinePlayers(ctx, server)
+	}
+	err := dc.RespondInteraction(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: autocompleteChoices(candidates, focused.StringValue()),
+		},
+	})
+	if err != nil {
+		svc.logger.Error("respond to autocomplete", zap.Error(err))
+	}
+}
+
+// respondError responds to an interaction with an error only the user that
+// sent it can see.
+func (svc *Service) respondError(dc discord.Client, i *discordgo.Interaction, err error) {
+	err = dc.RespondInteraction(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: fmt.Sprintf("Error: %s", err.Error()),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		svc.logger.Error("respond to interaction", zap.Error(err))
+	}
+}
+
+// interactionUser returns the user that sent an interaction and their roles.
+// Interactions sent in guilds come with a member, those sent in direct
+// messages with a user.
+func interactionUser(i *discordgo.Interaction) (*discordgo.User, []string) {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User, i.Member.Roles
+	}
+	if i.User != nil {
+		return i.User, nil
+	}
+	return &discordgo.User{}, nil
+}
+
+// slashCommandOptions returns the subcommand path of a slash command, e.g.
+// "whitelist add", and the values of its options by name.
+func slashCommandOptions(options []*discordgo.ApplicationCommandInteractionDataOption) (string, map[string]string) {
+	var path []string
+	values := make(map[string]string)
+	for len(options) > 0 {
+		opt := options[0]
+		if opt.Type != discordgo.ApplicationCommandOptionSubCommand &&
+			opt.Type != discordgo.ApplicationCommandOptionSubCommandGroup {
+			break
+		}
+		path = append(path, opt.Name)
+		options = opt.Options
+	}
+	for _, opt := range options {
+		if opt.Type == discordgo.ApplicationCommandOptionString {
+			values[opt.Name] = strings.TrimSpace(opt.StringValue())
+		}
+	}
+	return strings.Join(path, " "), values
+}
+
+// focusedOption returns the option being autocompleted, nil if none is.
+func focusedOption(options []*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, opt := range options {
+		if opt.Focused {
+			return opt
+		}
+		if focused := focusedOption(opt.Options); focused != nil {
+			return focused
+		}
+	}
+	return nil
+}
+
+// slashCommandLine returns the Minecraft command a slash command stands for.
+func slashCommandLine(path string, options map[string]string) (string, error) {
+	switch path {
+	case "run":
+		cmd := strings.TrimPrefix(options["command"], "/")
+		if cmd == "" {
+			return "", fmt.Errorf("%w: empty command", ErrUnknownSlashCommand)
+		}
+		return cmd, nil
+	case "list":
+		return "list", nil
+	case "whitelist add", "whitelist remove":
+		player := options["player"]
+		if !playerNameRegex.MatchString(player) {
+			return "", fmt.Errorf("%w: %q", ErrInvalidPlayerName, player)
+		}
+		return path + " " + player, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownSlashCommand, path)
+	}
+}
+
+// autocompleteChoices returns the candidates that start with the typed value,
+// ignoring case, sorted and without duplicates.
+func autocompleteChoices(candidates []string, typed string) []*discordgo.ApplicationCommandOptionChoice {
+	candidates = append([]string(nil), candidates...)
+	sort.Strings(candidates)
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(candidates))
+	for i, candidate := range candidates {
+		if i > 0 && candidates[i-1] == candidate {
+			continue
+		}
+		if !strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(typed)) {
+			continue
+		}
+		if len(choices) == maxAutocompleteChoices {
+			break
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: candidate, Value: candidate})
+	}
+	return choices
+}
@@ -0,0 +1,207 @@
+package botv2i
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/discord/discordtest"
+	"github.com/cezarmathe/stevebot/internal/policy"
+	"github.com/cezarmathe/stevebot/internal/query/querytest"
+)
+
+// newInteraction creates an interaction for /mc with the given subcommand
+// path and options.
+func newInteraction(typ discordgo.InteractionType, path string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	names := strings.Fields(path)
+	for i := len(names) - 1; i >= 0; i-- {
+		optType := discordgo.ApplicationCommandOptionSubCommand
+		if i < len(names)-1 {
+			optType = discordgo.ApplicationCommandOptionSubCommandGroup
+		}
+		options = []*discordgo.ApplicationCommandInteractionDataOption{{
+			Type:    optType,
+			Name:    names[i],
+			Options: options,
+		}}
+	}
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:        "interaction",
+		Type:      typ,
+		ChannelID: testChannelID,
+		Member: &discordgo.Member{
+			User:  &discordgo.User{ID: "user", Username: "steve"},
+			Roles: []string{"players"},
+		},
+		Data: discordgo.ApplicationCommandInteractionData{
+			Name:    "mc",
+			Options: options,
+		},
+	}}
+}
+
+func stringOption(name, value string, focused bool) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{
+		Type:    discordgo.ApplicationCommandOptionString,
+		Name:    name,
+		Value:   value,
+		Focused: focused,
+	}
+}
+
+func TestHandleInteraction(t *testing.T) {
+	steve := &fakeSteve{out: "Added steve to the whitelist"}
+	svc := newTestService(t, &Config{SlashCommand: "mc"}, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleInteraction(context.Background(), dc, newInteraction(discordgo.InteractionApplicationCommand,
+		"whitelist add", stringOption("player", "steve", false)))
+
+	got := dc.Timeline()
+	if len(got) != 2 {
+		t.Fatalf("got timeline %v, want a response and an edit", got)
+	}
+	if got[0].Kind != discordtest.Respond ||
+		got[0].Response.Type != discordgo.InteractionResponseDeferredChannelMessageWithSource {
+		t.Errorf("got %v, want a deferred response", got[0])
+	}
+	if got[1].Kind != discordtest.EditResponse || got[1].Content != "Added steve to the whitelist" {
+		t.Errorf("got %v, want the command output", got[1])
+	}
+	if cmds := steve.commands(); len(cmds) != 1 || cmds[0] != "whitelist add steve" {
+		t.Errorf("steve received %q", cmds)
+	}
+}
+
+func TestHandleInteractionServerOption(t *testing.T) {
+	survival := &fakeSteve{out: "survival"}
+	creative := &fakeSteve{out: "creative"}
+	svc := newTestService(t, &Config{SlashCommand: "mc"}, nil, map[string]*fakeSteve{
+		"default":  survival,
+		"creative": creative,
+	})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleInteraction(context.Background(), dc, newInteraction(discordgo.InteractionApplicationCommand,
+		"run", stringOption("command", "/time set day", false), stringOption("server", "creative", false)))
+
+	if cmds := creative.commands(); len(cmds) != 1 || cmds[0] != "time set day" {
+		t.Errorf("creative received %q", cmds)
+	}
+	if cmds := survival.commands(); len(cmds) != 0 {
+		t.Errorf("survival received %q", cmds)
+	}
+}
+
+func TestHandleInteractionInvalidPlayer(t *testing.T) {
+	steve := &fakeSteve{}
+	svc := newTestService(t, &Config{SlashCommand: "mc"}, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleInteraction(context.Background(), dc, newInteraction(discordgo.InteractionApplicationCommand,
+		"whitelist add", stringOption("player", "steve op alex", false)))
+
+	got := dc.Timeline()
+	if len(got) != 1 || !strings.HasPrefix(got[0].Content, "Error: "+ErrInvalidPlayerName.Error()) {
+		t.Fatalf("got timeline %v, want an invalid player error", got)
+	}
+	if got[0].Response.Data.Flags&discordgo.MessageFlagsEphemeral == 0 {
+		t.Error("error response is not ephemeral")
+	}
+	if cmds := steve.commands(); len(cmds) != 0 {
+		t.Errorf("steve received %q", cmds)
+	}
+}
+
+func TestHandleInteractionPermissionDenied(t *testing.T) {
+	steve := &fakeSteve{}
+	permissions := &Permissions{Grants: []Grant{{
+		Name:   "players",
+		Roles:  []string{"players"},
+		Policy: *policy.AllowList([]string{"list"}),
+	}}}
+	svc := newTestService(t, &Config{SlashCommand: "mc"}, permissions, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleInteraction(context.Background(), dc, newInteraction(discordgo.InteractionApplicationCommand,
+		"run", stringOption("command", "op steve", false)))
+
+	got := dc.Timeline()
+	if len(got) != 1 || !strings.HasPrefix(got[0].Content, "Error: "+ErrNoPermission.Error()) {
+		t.Errorf("got timeline %v, want a permission error", got)
+	}
+	if cmds := steve.commands(); len(cmds) != 0 {
+		t.Errorf("steve received %q", cmds)
+	}
+}
+
+func TestHandleInteractionAutocompletePlayer(t *testing.T) {
+	steve := &fakeSteve{out: "There are 3 of a max of 20 players online: Steve, alex, Sam"}
+	svc := newTestService(t, &Config{SlashCommand: "mc"}, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleInteraction(context.Background(), dc, newInteraction(discordgo.InteractionApplicationCommandAutocomplete,
+		"whitelist remove", stringOption("player", "s", true)))
+
+	got := dc.Timeline()
+	if len(got) != 1 || got[0].Response.Type != discordgo.InteractionApplicationCommandAutocompleteResult {
+		t.Fatalf("got timeline %v, want an autocomplete result", got)
+	}
+	var names []string
+	for _, choice := range got[0].Response.Data.Choices {
+		names = append(names, choice.Name)
+	}
+	if strings.Join(names, ",") != "Sam,Steve" {
+		t.Errorf("got choices %q, want [Sam Steve]", names)
+	}
+}
+
+func TestHandleInteractionAutocompletePlayerQuery(t *testing.T) {
+	srv := querytest.NewServer(querytest.Config{Players: []string{"Steve", "alex", "Sam"}})
+	defer srv.Close()
+	steve := &fakeSteve{err: errors.New("connection refused")}
+	config := &Config{SlashCommand: "mc", QueryAddresses: map[string]string{"default": srv.Addr}}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleInteraction(context.Background(), dc, newInteraction(discordgo.InteractionApplicationCommandAutocomplete,
+		"whitelist remove", stringOption("player", "s", true)))
+
+	got := dc.Timeline()
+	if len(got) != 1 || len(got[0].Response.Data.Choices) != 2 {
+		t.Fatalf("got timeline %v, want the players from the query port", got)
+	}
+}
+
+func TestHandleInteractionAutocompleteServer(t *testing.T) {
+	svc := newTestService(t, &Config{SlashCommand: "mc"}, nil, map[string]*fakeSteve{
+		"default":  {},
+		"creative": {},
+	})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleInteraction(context.Background(), dc, newInteraction(discordgo.InteractionApplicationCommandAutocomplete,
+		"list", stringOption("server", "CR", true)))
+
+	got := dc.Timeline()
+	if len(got) != 1 || len(got[0].Response.Data.Choices) != 1 ||
+		got[0].Response.Data.Choices[0].Name != "creative" {
+		t.Errorf("got timeline %v, want the creative server", got)
+	}
+}
+
+func TestParsePlayerList(t *testing.T) {
+	for out, want := range map[string]string{
+		"There are 0 of a max of 20 players online: ":             "",
+		"There are 2 of a max of 20 players online: alex, steve":  "alex,steve",
+		"There are 2/20 players online:\nalex, steve":             "alex,steve",
+		"Unknown or incomplete command, see below for error":      "",
+		"There are 1 of a max of 20 players online: not-a-player": "",
+	} {
+		if got := strings.Join(parsePlayerList(out), ","); got != want {
+			t.Errorf("parsePlayerList(%q) = %q, want %q", out, got, want)
+		}
+	}
+}
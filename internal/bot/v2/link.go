@@ -0,0 +1,324 @@
+package botv2i
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"github.com/cezarmathe/stevebot/internal/links"
+	"github.com/cezarmathe/stevebot/internal/mclog"
+	"go.uber.org/zap"
+)
+
+const (
+	linkCodeDigits = 6
+	// tellraw answers with this when the player is not online.
+	noPlayerFound = "No player was found"
+)
+
+var (
+	ErrLinkingDisabled = errors.New("account linking is not enabled")
+	ErrInvalidPlayer   = errors.New("invalid Minecraft name")
+	ErrPlayerOffline   = errors.New("the player must be online to link their account")
+	ErrPlayerLinked    = errors.New("this Minecraft account is linked to another user")
+	ErrNoWhitelistRole = errors.New("only members of the whitelist role can give their Minecraft name")
+
+	playerNameRegexp = regexp.MustCompile(`^[.]?\w{1,16}$`)
+)
+
+// linkRequest is a Discord user waiting for a player to type a code in the
+// chat of a server, to prove the account is theirs.
+type linkRequest struct {
+	userID    string
+	channelID string
+	server    string
+	player    string
+	code      string
+	expires   time.Time
+}
+
+// linkRequests holds the pending link requests, by server and lowercase
+// player name.
+type linkRequests struct {
+	mu      sync.Mutex
+	pending map[string]*linkRequest
+}
+
+func newLinkRequests() *linkRequests {
+	return &linkRequests{pending: make(map[string]*linkRequest)}
+}
+
+func linkRequestKey(server, player string) string {
+	return server + "/" + strings.ToLower(player)
+}
+
+// add a pending request, replacing the other requests of its user.
+func (r *linkRequests) add(req *linkRequest) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, pending := range r.pending {
+		if pending.userID == req.userID {
+			delete(r.pending, key)
+		}
+	}
+	r.pending[linkRequestKey(req.server, req.player)] = req
+}
+
+// complete removes and returns the request of a player who typed its code in
+// the chat of a server, if it has not expired.
+func (r *linkRequests) complete(server, player, code string, now time.Time) (*linkRequest, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := linkRequestKey(server, player)
+	req, ok := r.pending[key]
+	if !ok {
+		return nil, false
+	}
+	if now.After(req.expires) {
+		delete(r.pending, key)
+		return nil, false
+	}
+	if req.code != code {
+		return nil, false
+	}
+	delete(r.pending, key)
+	return req, true
+}
+
+// linkCommand starts linking the Minecraft account of the author of a
+// message: a code is shown to the player in the game, and the account is
+// linked once they type it in the chat.
+//
+// Usage: link [@server] <player>
+func (svc *Service) linkCommand(ctx context.Context, dc discord.Client, m *discordgo.MessageCreate, args []string) string {
+	if svc.links == nil {
+		return fmt.Sprintf("Error: %s", ErrLinkingDisabled.Error())
+	}
+	server, args := svc.selectServer(m.ChannelID, args)
+	if len(args) != 1 {
+		return "Usage: link [@server] <player>"
+	}
+	player := args[0]
+	if !playerNameRegexp.MatchString(player) {
+		return fmt.Sprintf("Error: %s", ErrInvalidPlayer.Error())
+	}
+	// proving an account is yours takes it over from whoever only gave its
+	// name
+	if err := svc.checkPlayerFree(m.Author.ID, player, true); err != nil {
+		return fmt.Sprintf("Error: %s", err.Error())
+	}
+	steve, err := svc.servers.Get(server)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err.Error())
+	}
+	code, err := linkCode()
+	if err != nil {
+		svc.logger.Error("generate link code", zap.Error(err))
+		return "Error: can't generate a code"
+	}
+	text := fmt.Sprintf("%s wants to link this account to Discord. If that's you, type %s in the chat.", m.Author.Username, code)
+	cmd, err := tellrawTo(player, chatComponent{Text: text, Color: discordChatColor})
+	if err != nil {
+		svc.logger.Error("encode link code", zap.Error(err))
+		return "Error: can't send the code"
+	}
+	ctx, cancel := svc.commandContext(ctx)
+	defer cancel()
+	out, err := steve.Execute(ctx, cmd)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err.Error())
+	}
+	if strings.Contains(out, noPlayerFound) {
+		return fmt.Sprintf("Error: %s", ErrPlayerOffline.Error())
+	}
+	svc.linkRequests.add(&linkRequest{
+		userID:    m.Author.ID,
+		channelID: m.ChannelID,
+		server:    server,
+		player:    player,
+		code:      code,
+		expires:   time.Now().Add(svc.config.LinkTimeout),
+	})
+	return fmt.Sprintf("A code was sent to %s in the game, type it in the chat within %s to link your account.",
+		player, svc.config.LinkTimeout)
+}
+
+// completeLink links the account of a player who typed the code of a pending
+// link request in the chat, and reports whether the message was that code.
+func (svc *Service) completeLink(ctx context.Context, dc discord.Client, server string, chat mclog.Chat) bool {
+	req, ok := svc.linkRequests.complete(server, chat.Player, strings.TrimSpace(chat.Message), time.Now())
+	if !ok {
+		return false
+	}
+	l := &links.Link{UserID: req.userID, Player: chat.Player, Server: server}
+	// the whitelist sync keeps track of the account, whoever it moves to
+	if existing, err := svc.links.ByPlayer(chat.Player); err == nil {
+		l.Whitelisted = existing.Whitelisted
+	}
+	previous, _ := svc.links.ByUser(req.userID)
+	reply := fmt.Sprintf("<@%s> is now linked to **%s**.", req.userID, escapeMarkdown(chat.Player))
+	if err := svc.links.Put(l); err != nil {
+		svc.logger.Error("store link", zap.Error(err))
+		reply = fmt.Sprintf("<@%s> Error: can't store the link", req.userID)
+	} else {
+		if steve, err := svc.servers.Get(server); err == nil {
+			if cmd, err := tellrawTo(chat.Player, chatComponent{Text: "Your account is now linked to Discord.", Color: discordChatColor}); err == nil {
+				if _, err := steve.Execute(ctx, cmd); err != nil {
+					svc.logger.Warn("confirm link", zap.String("server", server), zap.Error(err))
+				}
+			}
+		}
+		if svc.whitelistSync() && previous.Player != "" && !strings.EqualFold(previous.Player, chat.Player) {
+			svc.changeWhitelist(ctx, dc, []links.Link{previous}, func(links.Link) bool { return false })
+		}
+	}
+	if _, err := dc.SendMessage(req.channelID, reply); err != nil {
+		svc.logger.Error("send link reply", zap.Error(err))
+	}
+	return true
+}
+
+// unlinkCommand removes the link of the author of a message. Admins may
+// remove the link of anyone.
+//
+// Usage: unlink [user]
+func (svc *Service) unlinkCommand(ctx context.Context, dc discord.Client, m *discordgo.MessageCreate, args []string) string {
+	if svc.links == nil {
+		return fmt.Sprintf("Error: %s", ErrLinkingDisabled.Error())
+	}
+	userID := m.Author.ID
+	if len(args) > 0 {
+		if !svc.isAdmin(m) {
+			return fmt.Sprintf("Error: %s", ErrNotAdmin.Error())
+		}
+		userID = strings.Trim(args[0], "<@!>")
+	}
+	l, err := svc.links.Delete(userID)
+	if errors.Is(err, links.ErrNotFound) {
+		return fmt.Sprintf("<@%s> is not linked to a Minecraft account.", userID)
+	}
+	if err != nil {
+		svc.logger.Error("delete link", zap.Error(err))
+		return "Error: can't delete the link"
+	}
+	if svc.whitelistSync() {
+		svc.changeWhitelist(ctx, dc, []links.Link{l}, func(links.Link) bool { return false })
+	}
+	return fmt.Sprintf("<@%s> is no longer linked to **%s**.", userID, escapeMarkdown(l.Player))
+}
+
+// whoisCommand looks up the link of a Discord user or a Minecraft account.
+//
+// Usage: whois <user|player>
+func (svc *Service) whoisCommand(ctx context.Context, dc discord.Client, m *discordgo.MessageCreate, args []string) string {
+	if svc.links == nil {
+		return fmt.Sprintf("Error: %s", ErrLinkingDisabled.Error())
+	}
+	if len(args) != 1 {
+		return "Usage: whois <user|player>"
+	}
+	var l links.Link
+	var err error
+	if strings.HasPrefix(args[0], "<@") {
+		l, err = svc.links.ByUser(strings.Trim(args[0], "<@!>"))
+	} else {
+		l, err = svc.links.ByPlayer(args[0])
+	}
+	if errors.Is(err, links.ErrNotFound) {
+		return fmt.Sprintf("%s is not linked.", escapeMarkdown(args[0]))
+	}
+	if err != nil {
+		svc.logger.Error("look up link", zap.Error(err))
+		return "Error: can't look up the link"
+	}
+	reply := fmt.Sprintf("<@%s> is linked to **%s** since %s", l.UserID, escapeMarkdown(l.Player), l.Time.Format("2006-01-02"))
+	if l.Unverified {
+		reply += " (unverified)"
+	}
+	return reply + "."
+}
+
+// mcnameCommand links the author of a message, who must be a member of the
+// whitelist role, to a Minecraft account without verifying it and whitelists
+// it, for players who can't join a server before being whitelisted.
+//
+// Usage: mcname <player>
+func (svc *Service) mcnameCommand(ctx context.Context, dc discord.Client, m *discordgo.MessageCreate, args []string) string {
+	if !svc.whitelistSync() {
+		return fmt.Sprintf("Error: %s", ErrWhitelistSyncDisabled.Error())
+	}
+	if m.GuildID != svc.config.WhitelistGuild || !svc.hasWhitelistRole(m.Member) {
+		return fmt.Sprintf("Error: %s", ErrNoWhitelistRole.Error())
+	}
+	if len(args) != 1 {
+		return "Usage: mcname <player>"
+	}
+	player := args[0]
+	if !playerNameRegexp.MatchString(player) {
+		return fmt.Sprintf("Error: %s", ErrInvalidPlayer.Error())
+	}
+	if err := svc.checkPlayerFree(m.Author.ID, player, false); err != nil {
+		return fmt.Sprintf("Error: %s", err.Error())
+	}
+	previous, err := svc.links.ByUser(m.Author.ID)
+	if err != nil && !errors.Is(err, links.ErrNotFound) {
+		svc.logger.Error("look up link", zap.Error(err))
+		return "Error: can't look up the link"
+	}
+	l := links.Link{UserID: m.Author.ID, Player: player, Unverified: true}
+	if strings.EqualFold(previous.Player, player) {
+		l.Whitelisted = previous.Whitelisted
+	}
+	if err := svc.links.Put(&l); err != nil {
+		svc.logger.Error("store link", zap.Error(err))
+		return "Error: can't store the link"
+	}
+	ls := []links.Link{l}
+	// the previous account is only removed from the whitelists the sync
+	// added it to
+	if previous.Player != "" && !strings.EqualFold(previous.Player, player) {
+		ls = append(ls, previous)
+	}
+	svc.changeWhitelist(ctx, dc, ls, func(l links.Link) bool { return strings.EqualFold(l.Player, player) })
+	return fmt.Sprintf("<@%s> is now linked to **%s** and whitelisted.", m.Author.ID, escapeMarkdown(player))
+}
+
+// checkPlayerFree returns ErrPlayerLinked if a player is linked to a user
+// other than userID. Unverified links don't count if verified is set.
+func (svc *Service) checkPlayerFree(userID, player string, verified bool) error {
+	l, err := svc.links.ByPlayer(player)
+	if errors.Is(err, links.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		svc.logger.Error("look up link", zap.Error(err))
+		return errors.New("can't look up the link")
+	}
+	if l.UserID != userID && !(verified && l.Unverified) {
+		return ErrPlayerLinked
+	}
+	return nil
+}
+
+// linkCode returns a random numeric code.
+func linkCode() (string, error) {
+	limit := big.NewInt(1)
+	for i := 0; i < linkCodeDigits; i++ {
+		limit.Mul(limit, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", linkCodeDigits, n), nil
+}
@@ -0,0 +1,114 @@
+package botv2i
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cezarmathe/stevebot/internal/discord/discordtest"
+	"github.com/cezarmathe/stevebot/internal/links"
+	"github.com/cezarmathe/stevebot/internal/mclog"
+)
+
+// newTestLinkStore opens a link store in a temporary directory.
+func newTestLinkStore(t *testing.T) *links.Store {
+	t.Helper()
+
+	store, err := links.Open(filepath.Join(t.TempDir(), "links.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestLink(t *testing.T) {
+	steve := &fakeSteve{}
+	config := &Config{LinkTimeout: time.Minute, ChatChannels: map[string]string{"default": "chat"}}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": steve})
+	svc.links = newTestLinkStore(t)
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~link Steve"))
+	cmds := steve.commands()
+	if len(cmds) != 1 || !strings.HasPrefix(cmds[0], "tellraw Steve ") {
+		t.Fatalf("steve received %q, want the code shown to Steve", cmds)
+	}
+	code := regexp.MustCompile(`\d{6}`).FindString(cmds[0])
+	handleEvents(&svc, dc, "default",
+		mclog.Chat{Player: "alex", Message: code},
+		mclog.Chat{Player: "Steve", Message: "the code is " + code},
+		mclog.Chat{Player: "Steve", Message: code + " "},
+	)
+
+	l, err := svc.links.ByPlayer("steve")
+	if err != nil || l.UserID != "user" || l.Player != "Steve" {
+		t.Fatalf("got link %+v (%v), want Steve linked", l, err)
+	}
+	got := dc.Timeline()
+	if len(got) != 4 || got[1].ChannelID != "chat" || got[2].ChannelID != "chat" ||
+		got[3].ChannelID != testChannelID || got[3].Content != "<@user> is now linked to **Steve**." {
+		t.Errorf("got timeline %v, want the other messages relayed and the link confirmed", got)
+	}
+	if cmds := steve.commands(); len(cmds) != 2 || !strings.HasPrefix(cmds[1], "tellraw Steve ") {
+		t.Errorf("steve received %q, want the link confirmed in game", cmds)
+	}
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~whois <@user>"))
+	svc.HandleCommand(context.Background(), dc, newMessage("~unlink"))
+	svc.HandleCommand(context.Background(), dc, newMessage("~whois Steve"))
+	got = dc.Timeline()[4:]
+	if len(got) != 3 || !strings.HasPrefix(got[0].Content, "<@user> is linked to **Steve**") ||
+		got[1].Content != "<@user> is no longer linked to **Steve**." || got[2].Content != "Steve is not linked." {
+		t.Errorf("got timeline %v", got)
+	}
+	// whois and unlink mention users without pinging them
+	for _, event := range got[:2] {
+		if m := event.AllowedMentions; m == nil || len(m.Parse) != 0 || len(m.Users) != 0 {
+			t.Errorf("%v: got allowed mentions %+v, want none", event, m)
+		}
+	}
+}
+
+func TestLinkExpired(t *testing.T) {
+	steve := &fakeSteve{}
+	svc := newTestService(t, &Config{LinkTimeout: time.Nanosecond}, nil, map[string]*fakeSteve{"default": steve})
+	svc.links = newTestLinkStore(t)
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~link Steve"))
+	code := regexp.MustCompile(`\d{6}`).FindString(steve.commands()[0])
+	time.Sleep(time.Millisecond)
+	handleEvents(&svc, dc, "default", mclog.Chat{Player: "Steve", Message: code})
+
+	if _, err := svc.links.ByPlayer("Steve"); err != links.ErrNotFound {
+		t.Errorf("got %v, want no link", err)
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	steve := &fakeSteve{out: "No player was found"}
+	svc := newTestService(t, &Config{}, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~link Steve"))
+	svc.links = newTestLinkStore(t)
+	if err := svc.links.Put(&links.Link{UserID: "someone", Player: "alex"}); err != nil {
+		t.Fatal(err)
+	}
+	svc.HandleCommand(context.Background(), dc, newMessage("~link Steve"))
+	svc.HandleCommand(context.Background(), dc, newMessage("~link ALEX"))
+	svc.HandleCommand(context.Background(), dc, newMessage("~link not-a-name"))
+	svc.HandleCommand(context.Background(), dc, newMessage("~unlink <@someone>"))
+
+	assertTimeline(t, dc,
+		discordtest.Event{Kind: discordtest.Send, Content: "Error: " + ErrLinkingDisabled.Error()},
+		discordtest.Event{Kind: discordtest.Send, Content: "Error: " + ErrPlayerOffline.Error()},
+		discordtest.Event{Kind: discordtest.Send, Content: "Error: " + ErrPlayerLinked.Error()},
+		discordtest.Event{Kind: discordtest.Send, Content: "Error: " + ErrInvalidPlayer.Error()},
+		discordtest.Event{Kind: discordtest.Send, Content: "Error: " + ErrNotAdmin.Error()},
+	)
+}
@@ -0,0 +1,163 @@
+package botv2i
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"github.com/cezarmathe/stevebot/internal/mclog"
+	"go.uber.org/zap"
+)
+
+// Kinds of notifications, as listed in the notification events.
+const (
+	notifyJoin        = "join"
+	notifyLeave       = "leave"
+	notifyDeath       = "death"
+	notifyAdvancement = "advancement"
+)
+
+// Minecraft colours of notifications.
+const (
+	leaveColor     = 0xffff55 // yellow
+	deathColor     = 0xaaaaaa // gray
+	challengeColor = 0xaa00aa // dark purple
+	summaryColor   = 0x555555 // dark gray
+)
+
+// notifier posts the notifications of a server in its notification channel,
+// at most NotificationRate per NotificationInterval. The notifications over
+// the limit are held back and posted together once the interval is over, so
+// that many players leaving at once do not flood the channel.
+type notifier struct {
+	svc       *Service
+	dc        discord.Client
+	server    string
+	channelID string
+
+	// sent holds the times of the notifications posted during the last
+	// interval, oldest first.
+	sent []time.Time
+	// held holds the descriptions of the notifications held back.
+	held  []string
+	timer *time.Timer
+}
+
+func (svc *Service) newNotifier(dc discord.Client, server string) *notifier {
+	return &notifier{
+		svc:       svc,
+		dc:        dc,
+		server:    server,
+		channelID: svc.config.NotificationChannels[server],
+	}
+}
+
+// notify posts the notification of an event, if the event is one the server
+// notifies of.
+func (n *notifier) notify(event mclog.Event) {
+	if n.channelID == "" {
+		return
+	}
+	kind, embed := renderNotification(event)
+	if embed == nil || !n.svc.notifies(kind) {
+		return
+	}
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: n.server}
+
+	now := time.Now()
+	interval := n.svc.config.NotificationInterval
+	for len(n.sent) > 0 && now.Sub(n.sent[0]) >= interval {
+		n.sent = n.sent[1:]
+	}
+	if rate := n.svc.config.NotificationRate; rate > 0 && (len(n.sent) >= rate || len(n.held) > 0) {
+		n.held = append(n.held, embed.Description)
+		if n.timer == nil {
+			n.timer = time.NewTimer(n.sent[0].Add(interval).Sub(now))
+		}
+		return
+	}
+	n.send(embed)
+}
+
+// flushes returns a channel that receives once the held notifications are
+// due, nil if there are none.
+func (n *notifier) flushes() <-chan time.Time {
+	if n.timer == nil {
+		return nil
+	}
+	return n.timer.C
+}
+
+// flush posts the notifications held back in a single summary.
+func (n *notifier) flush() {
+	if n.timer != nil {
+		n.timer.Stop()
+		n.timer = nil
+	}
+	if len(n.held) == 0 {
+		return
+	}
+	n.send(&discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("%d more events", len(n.held)),
+		Description: truncate(strings.Join(n.held, "\n"), maxEmbedDescription),
+		Color:       summaryColor,
+		Footer:      &discordgo.MessageEmbedFooter{Text: n.server},
+	})
+	n.held = nil
+}
+
+func (n *notifier) send(embed *discordgo.MessageEmbed) {
+	n.sent = append(n.sent, time.Now())
+	send := &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}}
+	if _, err := n.dc.SendMessageComplex(n.channelID, send); err != nil {
+		n.svc.logger.Error("send notification", zap.String("server", n.server), zap.Error(err))
+	}
+}
+
+// notifies reports whether notifications of a kind are enabled.
+func (svc *Service) notifies(kind string) bool {
+	for _, enabled := range svc.config.NotificationEvents {
+		if strings.EqualFold(strings.TrimSpace(enabled), kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderNotification renders an event as a compact embed, nil if players are
+// not notified of it, and returns the kind of the notification.
+func renderNotification(event mclog.Event) (string, *discordgo.MessageEmbed) {
+	var kind string
+	embed := &discordgo.MessageEmbed{Timestamp: event.Log().Time.Format(time.RFC3339)}
+	switch event := event.(type) {
+	case mclog.Join:
+		kind = notifyJoin
+		embed.Description = fmt.Sprintf("**%s** joined the game", escapeMarkdown(event.Player))
+		embed.Color = embedColor
+	case mclog.Leave:
+		kind = notifyLeave
+		embed.Description = fmt.Sprintf("**%s** left the game", escapeMarkdown(event.Player))
+		embed.Color = leaveColor
+	case mclog.Death:
+		kind = notifyDeath
+		rest := strings.TrimPrefix(event.Message, event.Player)
+		embed.Description = fmt.Sprintf("**%s**%s", escapeMarkdown(event.Player), escapeMarkdown(rest))
+		embed.Color = deathColor
+	case mclog.Advancement:
+		kind = notifyAdvancement
+		verb, color := "made the advancement", embedColor
+		switch event.Kind {
+		case mclog.KindChallenge:
+			verb, color = "completed the challenge", challengeColor
+		case mclog.KindGoal:
+			verb = "reached the goal"
+		}
+		embed.Description = fmt.Sprintf("**%s** has %s **[%s]**", escapeMarkdown(event.Player), verb, escapeMarkdown(event.Title))
+		embed.Color = color
+	default:
+		return "", nil
+	}
+	return kind, embed
+}
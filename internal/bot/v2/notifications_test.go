@@ -0,0 +1,125 @@
+package botv2i
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cezarmathe/stevebot/internal/discord/discordtest"
+	"github.com/cezarmathe/stevebot/internal/mclog"
+)
+
+// newNotificationConfig returns a config posting the notifications of the
+// default server in the test channel.
+func newNotificationConfig(events ...string) *Config {
+	return &Config{
+		NotificationChannels: map[string]string{"default": testChannelID},
+		NotificationEvents:   events,
+		NotificationInterval: time.Minute,
+	}
+}
+
+// handleEvents handles events until they run out.
+func handleEvents(svc *Service, dc *discordtest.Client, server string, events ...mclog.Event) {
+	ch := make(chan mclog.Event, len(events))
+	for _, event := range events {
+		ch <- event
+	}
+	close(ch)
+	svc.HandleLogEvents(context.Background(), dc, server, ch)
+}
+
+// notifications returns the descriptions of the notifications posted on dc.
+func notifications(t *testing.T, dc *discordtest.Client) []string {
+	t.Helper()
+
+	var descriptions []string
+	for _, event := range dc.Timeline() {
+		if event.Kind != discordtest.Send || event.ChannelID != testChannelID || len(event.Embeds) != 1 {
+			t.Fatalf("got %v, want a notification", event)
+		}
+		descriptions = append(descriptions, event.Embeds[0].Description)
+	}
+	return descriptions
+}
+
+func TestNotifications(t *testing.T) {
+	config := newNotificationConfig("join", "leave", "death")
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": {}, "creative": {}})
+	dc := discordtest.NewClient(testBotUserID)
+
+	handleEvents(&svc, dc, "default",
+		mclog.Join{Player: "Steve_1"},
+		mclog.Started{},
+		mclog.Death{Player: "Steve_1", Message: "Steve_1 was slain by Zombie"},
+		mclog.Advancement{Player: "Steve_1", Kind: mclog.KindAdvancement, Title: "Stone Age"},
+		mclog.Leave{Player: "Steve_1"},
+	)
+	handleEvents(&svc, dc, "creative", mclog.Join{Player: "alex"})
+
+	got := notifications(t, dc)
+	want := []string{
+		`**Steve\_1** joined the game`,
+		`**Steve\_1** was slain by Zombie`,
+		`**Steve\_1** left the game`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got notifications %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("notification %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+	if footer := dc.Timeline()[0].Embeds[0].Footer; footer == nil || footer.Text != "default" {
+		t.Errorf("got footer %+v, want the server", footer)
+	}
+}
+
+func TestNotificationsRateLimited(t *testing.T) {
+	config := newNotificationConfig("leave")
+	config.NotificationRate = 2
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": {}})
+	dc := discordtest.NewClient(testBotUserID)
+
+	handleEvents(&svc, dc, "default",
+		mclog.Leave{Player: "alex"},
+		mclog.Leave{Player: "steve"},
+		mclog.Leave{Player: "notch"},
+		mclog.Leave{Player: "jeb_"},
+	)
+
+	got := dc.Timeline()
+	if len(got) != 3 {
+		t.Fatalf("got timeline %v, want 2 notifications and a summary", got)
+	}
+	if summary := got[2].Embeds[0]; summary.Title != "2 more events" ||
+		summary.Description != "**notch** left the game\n**jeb\\_** left the game" {
+		t.Errorf("got summary %+v", summary)
+	}
+}
+
+func TestNotificationsFlushed(t *testing.T) {
+	config := newNotificationConfig("join")
+	config.NotificationRate = 1
+	config.NotificationInterval = 20 * time.Millisecond
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": {}})
+	dc := discordtest.NewClient(testBotUserID)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan mclog.Event, 2)
+	go svc.HandleLogEvents(ctx, dc, "default", events)
+
+	events <- mclog.Join{Player: "alex"}
+	events <- mclog.Join{Player: "steve"}
+	deadline := time.Now().Add(time.Second)
+	for len(dc.Timeline()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got timeline %v, want the held notification posted", dc.Timeline())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if summary := dc.Timeline()[1].Embeds[0]; summary.Description != "**steve** joined the game" {
+		t.Errorf("got summary %+v", summary)
+	}
+}
@@ -0,0 +1,177 @@
+package botv2i
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"go.uber.org/zap"
+)
+
+const (
+	pageButtonPrefix = "page:"
+	// attachmentName is the name of the file long output is attached as.
+	attachmentName = "output.txt"
+)
+
+var (
+	ErrPagesNotFound = errors.New("these pages have expired")
+)
+
+// output is the content of a feedback message, along with the buttons to
+// browse its pages or the text it is attached as, if it is too long for a
+// single message.
+type output struct {
+	content    string
+	components []discordgo.MessageComponent
+	attachment string
+}
+
+// files returns the files to attach to the feedback message, nil if none.
+func (o output) files() []*discordgo.File {
+	if o.attachment == "" {
+		return nil
+	}
+	return []*discordgo.File{{
+		Name:        attachmentName,
+		ContentType: "text/plain",
+		Reader:      strings.NewReader(o.attachment),
+	}}
+}
+
+// paginated is output split into pages.
+type paginated struct {
+	pages []string
+	timer *time.Timer
+}
+
+// paginations holds the output that can be browsed with the page buttons, by
+// id. Pages only live in memory, they are lost when the bot restarts.
+type paginations struct {
+	mu        sync.Mutex
+	paginated map[string]*paginated
+}
+
+func newPaginations() *paginations {
+	return &paginations{paginated: make(map[string]*paginated)}
+}
+
+// add pages that are forgotten after timeout, if positive.
+func (p *paginations) add(id string, pages []string, timeout time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if old, ok := p.paginated[id]; ok && old.timer != nil {
+		old.timer.Stop()
+	}
+	pending := &paginated{pages: pages}
+	if timeout > 0 {
+		pending.timer = time.AfterFunc(timeout, func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+
+			if p.paginated[id] == pending {
+				delete(p.paginated, id)
+			}
+		})
+	}
+	p.paginated[id] = pending
+}
+
+// get returns the pages with the given id.
+func (p *paginations) get(id string) ([]string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pending, ok := p.paginated[id]
+	if !ok {
+		return nil, false
+	}
+	return pending.pages, true
+}
+
+// paginate prepares content for a feedback message. Content longer than the
+// Discord limit is attached as a text file if it is longer than the
+// attachment threshold, or split into pages browsed with buttons otherwise.
+func (svc *Service) paginate(id, content string) output {
+	if len(content) <= discord.MessageLimit {
+		return output{content: content}
+	}
+	if svc.config.AttachmentThreshold > 0 && len(content) > svc.config.AttachmentThreshold {
+		text := discord.PlainText(content)
+		return output{
+			content:    fmt.Sprintf("The output is too long, it is attached as %s (%d characters.)", attachmentName, len(text)),
+			attachment: text,
+		}
+	}
+	pages := discord.Split(content, discord.MessageLimit)
+	svc.paginations.add(id, pages, svc.config.PageTimeout)
+	return output{content: pages[0], components: pageButtons(id, 0, len(pages))}
+}
+
+// pageButtons returns the buttons to browse the pages with the given id, from
+// the page at index n.
+func pageButtons(id string, n, count int) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Prev",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("%s%s:%d", pageButtonPrefix, id, n-1),
+				Disabled: n == 0,
+			},
+			discordgo.Button{
+				Label:    fmt.Sprintf("%d/%d", n+1, count),
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("%s%s:current", pageButtonPrefix, id),
+				Disabled: true,
+			},
+			discordgo.Button{
+				Label:    "Next",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("%s%s:%d", pageButtonPrefix, id, n+1),
+				Disabled: n == count-1,
+			},
+		}},
+	}
+}
+
+// handlePageButton handles clicks on the page buttons, and returns whether
+// the interaction was one. Anyone who can see the output may browse it.
+func (svc *Service) handlePageButton(dc discord.Client, i *discordgo.Interaction) bool {
+	customID := i.MessageComponentData().CustomID
+	if !strings.HasPrefix(customID, pageButtonPrefix) {
+		return false
+	}
+	ref := strings.TrimPrefix(customID, pageButtonPrefix)
+	sep := strings.LastIndex(ref, ":")
+	if sep < 0 {
+		return true
+	}
+	id := ref[:sep]
+	n, err := strconv.Atoi(ref[sep+1:])
+	if err != nil {
+		return true
+	}
+	pages, ok := svc.paginations.get(id)
+	if !ok || n < 0 || n >= len(pages) {
+		svc.respondError(dc, i, ErrPagesNotFound)
+		return true
+	}
+	err = dc.RespondInteraction(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    pages[n],
+			Components: pageButtons(id, n, len(pages)),
+		},
+	})
+	if err != nil {
+		svc.logger.Error("turn page", zap.String("id", id), zap.Error(err))
+	}
+	return true
+}
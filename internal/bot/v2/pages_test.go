@@ -0,0 +1,80 @@
+package botv2i
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"github.com/cezarmathe/stevebot/internal/discord/discordtest"
+)
+
+func TestHandleCommandPages(t *testing.T) {
+	steve := &fakeSteve{out: "§a" + strings.Repeat("There are 0 of a max of 20 players online\n", 100)}
+	svc := newTestService(t, &Config{OutputFormat: "ansi"}, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~list"))
+
+	got := dc.Timeline()
+	if len(got) != 2 || got[1].Kind != discordtest.Edit || len(got[1].Components) == 0 {
+		t.Fatalf("got timeline %v, want a paginated edit", got)
+	}
+	first := got[1].Content
+	if len(first) > discord.MessageLimit || !strings.HasPrefix(first, "```ansi\n") || !strings.HasSuffix(first, "\n```") {
+		t.Errorf("got first page %q, want a code block under the limit", first)
+	}
+
+	message, _ := dc.Message(got[1].MessageID)
+	svc.HandleInteraction(context.Background(), dc, click(message, "someone-else", 2))
+	message, _ = dc.Message(got[1].MessageID)
+	if message.Content == first || !strings.HasPrefix(message.Content, "```ansi\n") {
+		t.Errorf("got second page %q", message.Content)
+	}
+	row := message.Components[0].(discordgo.ActionsRow)
+	if label := row.Components[1].(discordgo.Button).Label; !strings.HasPrefix(label, "2/") {
+		t.Errorf("got page label %q", label)
+	}
+	if prev := row.Components[0].(discordgo.Button); prev.Disabled {
+		t.Error("can't go back to the first page")
+	}
+}
+
+func TestHandleCommandPagesExpired(t *testing.T) {
+	steve := &fakeSteve{out: strings.Repeat("a line of output\n", 200)}
+	svc := newTestService(t, &Config{}, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~list"))
+	got := dc.Timeline()
+	message, _ := dc.Message(got[1].MessageID)
+	svc.paginations = newPaginations()
+	svc.HandleInteraction(context.Background(), dc, click(message, "user", 2))
+
+	if got := waitForEvent(t, dc, 2); !strings.Contains(got.Content, ErrPagesNotFound.Error()) {
+		t.Errorf("got %v, want an expired pages error", got)
+	}
+}
+
+func TestHandleCommandAttachment(t *testing.T) {
+	steve := &fakeSteve{out: strings.Repeat("§ca line of output\n", 200)}
+	config := &Config{OutputFormat: "ansi", AttachmentThreshold: 3000}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~list"))
+
+	got := dc.Timeline()
+	if len(got) != 2 || len(got[1].Files) != 1 || len(got[1].Components) != 0 {
+		t.Fatalf("got timeline %v, want an edit with an attachment", got)
+	}
+	data, err := ioutil.ReadAll(got[1].Files[0].Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Repeat("a line of output\n", 200); string(data) != want {
+		t.Errorf("got attachment %q, want the plain output", data)
+	}
+}
@@ -0,0 +1,121 @@
+package botv2i
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cezarmathe/stevebot/internal/policy"
+)
+
+var (
+	ErrNoPermission = errors.New("you are not allowed to run commands")
+)
+
+// Grant gives a command policy to Discord users and roles.
+type Grant struct {
+	Name string `json:"name"`
+	// Role and user ids the grant applies to. A grant without roles and
+	// users applies to everyone.
+	Roles  []string      `json:"roles,omitempty"`
+	Users  []string      `json:"users,omitempty"`
+	Policy policy.Policy `json:"policy"`
+}
+
+// Permissions maps Discord users and roles to the commands they may run. A
+// command is allowed if any of the grants that apply to the author allows it.
+//
+// Permissions are loaded from a JSON file, e.g.
+//
+//	{
+//	    "grants": [
+//	        {
+//	            "name": "everyone",
+//	            "policy": {"rules": [{"action": "allow", "command": "list"}]}
+//	        },
+//	        {
+//	            "name": "moderators",
+//	            "roles": ["123456789012345678"],
+//	            "policy": {"rules": [
+//	                {"action": "allow", "command": "kick **"},
+//	                {"action": "allow", "command": "ban **"}
+//	            ]}
+//	        }
+//	    ]
+//	}
+type Permissions struct {
+	Grants []Grant `json:"grants"`
+}
+
+// PermissionError is returned for commands the author is not allowed to run.
+type PermissionError struct {
+	Grant    string
+	Decision policy.Decision
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("%s: %s of grant %q", ErrNoPermission.Error(), e.Decision.Reason(), e.Grant)
+}
+
+func (e *PermissionError) Unwrap() error {
+	return ErrNoPermission
+}
+
+// Load the permissions from a JSON file.
+func LoadPermissions(path string) (*Permissions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load permissions: %w", err)
+	}
+	p := new(Permissions)
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("load permissions: %w", err)
+	}
+	return p, nil
+}
+
+// Check whether a user holding the given roles may run a command. Nil
+// permissions allow everything.
+func (p *Permissions) Check(userID string, roles []string, cmd string) error {
+	if p == nil {
+		return nil
+	}
+	var denied *PermissionError
+	for i := range p.Grants {
+		grant := &p.Grants[i]
+		if !grant.appliesTo(userID, roles) {
+			continue
+		}
+		decision := grant.Policy.Evaluate(cmd)
+		if decision.Allowed {
+			return nil
+		}
+		if denied == nil {
+			denied = &PermissionError{Grant: grant.Name, Decision: decision}
+		}
+	}
+	if denied == nil {
+		return ErrNoPermission
+	}
+	return denied
+}
+
+func (g *Grant) appliesTo(userID string, roles []string) bool {
+	if len(g.Roles) == 0 && len(g.Users) == 0 {
+		return true
+	}
+	for _, id := range g.Users {
+		if id == userID {
+			return true
+		}
+	}
+	for _, id := range g.Roles {
+		for _, role := range roles {
+			if id == role {
+				return true
+			}
+		}
+	}
+	return false
+}
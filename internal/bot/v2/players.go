@@ -0,0 +1,96 @@
+package botv2i
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cezarmathe/stevebot/internal/mcformat"
+	"github.com/cezarmathe/stevebot/internal/mcoutput"
+)
+
+const (
+	// How long the list of online players of a server is reused for
+	// autocompletions, so that typing a player name does not send a list
+	// command on every keystroke.
+	playerCacheTTL = 10 * time.Second
+)
+
+var (
+	playerNameRegex = regexp.MustCompile(`^[A-Za-z0-9_]{1,16}$`)
+)
+
+// parsePlayerList returns the names of the players in the output of the list
+// command, e.g. "There are 2 of a max of 20 players online: alex, steve".
+func parsePlayerList(out string) []string {
+	value, err := mcoutput.ParseList(nil, strings.TrimSpace(mcformat.Strip(out)))
+	if err != nil {
+		return nil
+	}
+	var players []string
+	for _, name := range value.(mcoutput.PlayerList).Players {
+		if playerNameRegex.MatchString(name) {
+			players = append(players, name)
+		}
+	}
+	return players
+}
+
+type cachedPlayers struct {
+	players []string
+	time    time.Time
+}
+
+// playerCache holds the online players of each server for a short while.
+type playerCache struct {
+	mu      sync.Mutex
+	servers map[string]cachedPlayers
+}
+
+func newPlayerCache() *playerCache {
+	return &playerCache{servers: make(map[string]cachedPlayers)}
+}
+
+// onlinePlayers returns the names of the players online on a server, or on
+// any server of a group.
+func (svc *Service) onlinePlayers(ctx context.Context, server string) []string {
+	servers := []string{server}
+	if members, ok := svc.servers.Group(server); ok {
+		servers = members
+	}
+	var players []string
+	for _, server := range servers {
+		players = append(players, svc.serverPlayers(ctx, server)...)
+	}
+	return players
+}
+
+func (svc *Service) serverPlayers(ctx context.Context, server string) []string {
+	svc.players.mu.Lock()
+	cached, ok := svc.players.servers[server]
+	svc.players.mu.Unlock()
+	if ok && time.Since(cached.time) < playerCacheTTL {
+		return cached.players
+	}
+
+	steve, err := svc.servers.Get(server)
+	if err != nil {
+		return nil
+	}
+	var players []string
+	if out, err := steve.Execute(ctx, "list"); err == nil {
+		players = parsePlayerList(out)
+	} else if stat, qerr := svc.query(ctx, server); qerr == nil {
+		// RCON is unavailable, the query port lists the players too
+		players = stat.Players
+	} else {
+		return nil
+	}
+	cached = cachedPlayers{players: players, time: time.Now()}
+	svc.players.mu.Lock()
+	svc.players.servers[server] = cached
+	svc.players.mu.Unlock()
+	return cached.players
+}
@@ -2,58 +2,355 @@ package botv2i
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/audit"
+	"github.com/cezarmathe/stevebot/internal/deadletter"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"github.com/cezarmathe/stevebot/internal/links"
+	"github.com/cezarmathe/stevebot/internal/mcformat"
+	"github.com/cezarmathe/stevebot/internal/mcoutput"
+	"github.com/cezarmathe/stevebot/internal/policy"
 	stevev2i "github.com/cezarmathe/stevebot/internal/steve/v2"
 	"go.uber.org/zap"
 )
 
 type Config struct {
 	CommandPrefix string `env:"COMMAND_PREFIX"`
+	// How long to wait for the result of a command before giving up on it.
+	// Results that arrive later are posted as dead letters, if enabled.
+	CommandTimeout time.Duration `env:"COMMAND_TIMEOUT" envDefault:"10s"`
+
+	// Prefix of the optional first word of a command that names the server
+	// the command is sent to, e.g. "@creative".
+	ServerSelector string `env:"SERVER_SELECTOR" envDefault:"@"`
+	// Default server for commands sent in a channel, by channel id.
+	ChannelServers map[string]string `env:"CHANNEL_SERVERS"`
+
+	// How Minecraft formatting codes in command output are rendered: "ansi"
+	// for colours in an ansi code block, "strip" to remove them or "raw" to
+	// leave them as is. ChannelOutputFormats overrides it by channel id.
+	OutputFormat         string            `env:"OUTPUT_FORMAT" envDefault:"ansi"`
+	ChannelOutputFormats map[string]string `env:"CHANNEL_OUTPUT_FORMATS"`
+	// Whether the output of common commands, like list or banlist, is
+	// rendered as an embed instead of text.
+	Embeds bool `env:"EMBEDS" envDefault:"true"`
+
+	// Output longer than a Discord message is split into pages browsed with
+	// buttons for PageTimeout, or attached as a text file if it is longer
+	// than AttachmentThreshold characters. If AttachmentThreshold is 0,
+	// output is never attached.
+	AttachmentThreshold int           `env:"ATTACHMENT_THRESHOLD" envDefault:"8000"`
+	PageTimeout         time.Duration `env:"PAGE_TIMEOUT" envDefault:"15m"`
+
+	// Path to a permissions file mapping Discord roles and users to the
+	// commands they may run. If empty, everyone may run any command.
+	PermissionsFile string `env:"PERMISSIONS_FILE"`
+
+	// Commands that must be confirmed by their author before they run, e.g.
+	// "stop" or "whitelist remove". Commands are matched word by word, like
+	// allowed commands.
+	DangerousCommands []string `env:"DANGEROUS_COMMANDS"`
+	// How long the author of a dangerous command has to confirm it.
+	ConfirmationTimeout time.Duration `env:"CONFIRMATION_TIMEOUT" envDefault:"30s"`
+
+	// Commands that run only once a second person approves them, e.g. "op"
+	// or "whitelist remove". Approval requests are posted to the approvals
+	// channel, and may be approved by anyone but the author holding one of
+	// the approver roles.
+	ApprovalCommands []string      `env:"APPROVAL_COMMANDS"`
+	ApprovalChannel  string        `env:"APPROVAL_CHANNEL"`
+	ApproverRoles    []string      `env:"APPROVER_ROLES"`
+	ApprovalTimeout  time.Duration `env:"APPROVAL_TIMEOUT" envDefault:"1h"`
+
+	// Name of the slash command to register, e.g. "mc" for /mc run. If
+	// empty, no slash commands are registered.
+	SlashCommand string `env:"SLASH_COMMAND" envDefault:"mc"`
+	// Guild to register the slash command in. If empty, the command is
+	// registered globally, which may take a while to show up.
+	SlashCommandGuild string `env:"SLASH_COMMAND_GUILD"`
+	// How long to wait for the list of online players when autocompleting
+	// player names. Discord gives up on autocompletions after 3 seconds.
+	AutocompleteTimeout time.Duration `env:"AUTOCOMPLETE_TIMEOUT" envDefault:"2s"`
+
+	// Addresses pinged by the status command and query ports, by server
+	// name, as host or host:port. Set from the configuration of the servers.
+	// Servers with a query port get the full list of their players and
+	// plugins in their status, and their online players listed even if RCON
+	// is unavailable.
+	StatusAddresses map[string]string
+	QueryAddresses  map[string]string
+
+	// Channel bridged with the in-game chat of a server, by server name.
+	// Chat messages are posted in the channel, and messages sent in it that
+	// are not commands are shown in the game with tellraw, which the command
+	// policy of the server must allow.
+	ChatChannels map[string]string `env:"CHAT_CHANNELS"`
+
+	// Channel player joins, leaves, deaths and advancements are posted in,
+	// by server name. NotificationEvents are the kinds of events posted. At
+	// most NotificationRate notifications are posted per
+	// NotificationInterval, the others are posted together once the interval
+	// is over. If NotificationRate is 0, notifications are not limited.
+	NotificationChannels map[string]string `env:"NOTIFICATION_CHANNELS"`
+	NotificationEvents   []string          `env:"NOTIFICATION_EVENTS" envDefault:"join,leave,death,advancement"`
+	NotificationRate     int               `env:"NOTIFICATION_RATE" envDefault:"5"`
+	NotificationInterval time.Duration     `env:"NOTIFICATION_INTERVAL" envDefault:"10s"`
+
+	// How long a player has to type the code of a link request in the chat.
+	LinkTimeout time.Duration `env:"LINK_TIMEOUT" envDefault:"10m"`
+
+	// Role of WhitelistGuild whose members are whitelisted, under the name of
+	// their linked Minecraft account, on WhitelistServers (every server if
+	// empty). Members who lose the role or leave the guild are removed from
+	// the whitelist, and the whitelists are reconciled with the members of
+	// the role every WhitelistReconcileInterval. Players are only removed
+	// from the whitelists the sync added them to, the ones whitelisted by
+	// hand are left alone. With WhitelistDryRun, the changes are only
+	// reported. Reports are posted in
+	// WhitelistReportChannel, or logged if it is empty. The command policy
+	// of the servers must allow whitelist add, remove and list.
+	WhitelistGuild             string        `env:"WHITELIST_GUILD"`
+	WhitelistRole              string        `env:"WHITELIST_ROLE"`
+	WhitelistServers           []string      `env:"WHITELIST_SERVERS"`
+	WhitelistReconcileInterval time.Duration `env:"WHITELIST_RECONCILE_INTERVAL" envDefault:"1h"`
+	WhitelistDryRun            bool          `env:"WHITELIST_DRY_RUN"`
+	WhitelistReportChannel     string        `env:"WHITELIST_REPORT_CHANNEL"`
+
+	// Discord roles and users that may run bot commands, like audit and dlq.
+	AdminRoles []string `env:"ADMIN_ROLES"`
+	AdminUsers []string `env:"ADMIN_USERS"`
+}
+
+// Validate checks for settings that can't work together.
+func (c *Config) Validate() error {
+	if len(c.ApprovalCommands) > 0 && len(c.ApproverRoles) == 0 {
+		return errors.New("APPROVAL_COMMANDS is set but APPROVER_ROLES is empty, nobody could approve them")
+	}
+	if _, err := mcformat.ParseMode(c.OutputFormat); err != nil {
+		return fmt.Errorf("OUTPUT_FORMAT: %w", err)
+	}
+	for channelID, format := range c.ChannelOutputFormats {
+		if _, err := mcformat.ParseMode(format); err != nil {
+			return fmt.Errorf("CHANNEL_OUTPUT_FORMATS: channel %s: %w", channelID, err)
+		}
+	}
+	return nil
+}
+
+// Permissions loads the permissions of the service, nil if none are
+// configured.
+func (c *Config) Permissions() (*Permissions, error) {
+	if c.PermissionsFile == "" {
+		return nil, nil
+	}
+	return LoadPermissions(c.PermissionsFile)
 }
 
 type Service struct {
-	config *Config
-	logger *zap.Logger
+	config      *Config
+	logger      *zap.Logger
+	permissions *Permissions
+	auditLog    *audit.Log
+	deadLetters *deadletter.Queue
+	links       *links.Store
+
+	servers     *stevev2i.Registry
+	players     *playerCache
+	outputs     *mcoutput.Registry
+	paginations *paginations
 
-	steve stevev2i.SteveV2
+	dangerous     *policy.Policy
+	confirmations *confirmations
+	privileged    *policy.Policy
+	approvals     *approvals
+
+	linkRequests *linkRequests
+	// serializes whitelist syncs, which read and write the servers the
+	// accounts of links were whitelisted on
+	whitelistMu *sync.Mutex
 }
 
-func New(config *Config, logger *zap.Logger, steve stevev2i.SteveV2) Service {
+func New(config *Config, logger *zap.Logger, permissions *Permissions, auditLog *audit.Log, deadLetters *deadletter.Queue, links *links.Store, servers *stevev2i.Registry) Service {
 	return Service{
-		config: config,
-		logger: logger,
+		config:      config,
+		logger:      logger,
+		permissions: permissions,
+		auditLog:    auditLog,
+		deadLetters: deadLetters,
+		links:       links,
+
+		servers:     servers,
+		players:     newPlayerCache(),
+		outputs:     mcoutput.Default(),
+		paginations: newPaginations(),
 
-		steve: steve,
+		dangerous:     policy.DenyList(config.DangerousCommands),
+		confirmations: newConfirmations(),
+		privileged:    policy.DenyList(config.ApprovalCommands),
+		approvals:     newApprovals(),
+
+		linkRequests: newLinkRequests(),
+		whitelistMu:  new(sync.Mutex),
 	}
 }
 
-func (svc *Service) HandleCommand(ctx context.Context, s *discordgo.Session, m *discordgo.MessageCreate) {
-	if m.Author.ID == s.State.User.ID {
+func (svc *Service) HandleCommand(ctx context.Context, dc discord.Client, m *discordgo.MessageCreate) {
+	if m.Author.ID == dc.UserID() {
 		svc.logger.Debug("message sent by bot user")
 		return
 	}
+	if svc.relayChat(ctx, m) {
+		return
+	}
 	command := m.Content
-	if !strings.HasPrefix(command, svc.config.CommandPrefix) {
+	if svc.config.CommandPrefix == "" || !strings.HasPrefix(command, svc.config.CommandPrefix) {
 		svc.logger.Debug("message is not command")
 		return
 	}
 	command = strings.TrimPrefix(command, svc.config.CommandPrefix)
 	argv := strings.Fields(command)
-	svc.logger.Debug("handle command", zap.Strings("argv", argv))
-	fmsg, err := s.ChannelMessageSend(m.ChannelID, "Working on it..")
-	if err != nil {
-		svc.logger.Error("send feedback message", zap.Error(err))
+	ctx = audit.WithOrigin(ctx, audit.Origin{
+		UserID:    m.Author.ID,
+		Username:  m.Author.String(),
+		GuildID:   m.GuildID,
+		ChannelID: m.ChannelID,
+		MessageID: m.ID,
+	})
+	if svc.handleBotCommand(ctx, dc, m, argv) {
+		return
 	}
-	out, err := svc.steve.Execute(ctx, strings.Join(argv, " "))
-	if err != nil {
-		_, err = s.ChannelMessageEdit(fmsg.ChannelID, fmsg.ID, fmt.Sprintf("Error: %s", err.Error()))
+	server, argv := svc.selectServer(m.ChannelID, argv)
+	svc.logger.Debug("handle command", zap.String("server", server), zap.Strings("argv", argv))
+	if len(argv) > 0 && argv[0] == statusCommand {
+		svc.handleStatusCommand(ctx, dc, m.ChannelID, server)
+		return
+	}
+	var roles []string
+	if m.Member != nil {
+		roles = m.Member.Roles
+	}
+	if err := svc.permissions.Check(m.Author.ID, roles, strings.Join(argv, " ")); err != nil {
+		svc.logger.Debug("permission denied", zap.String("author", m.Author.ID), zap.Error(err))
+		if _, err := dc.SendMessage(m.ChannelID, fmt.Sprintf("Error: %s", err.Error())); err != nil {
+			svc.logger.Error("send feedback message", zap.Error(err))
+		}
+		return
+	}
+	svc.runCommand(ctx, dc, m, server, strings.Join(argv, " "), "")
+}
+
+// runCommand runs a command sent in a message on a server, once confirmed and
+// approved if it has to be, and posts its result after header.
+func (svc *Service) runCommand(ctx context.Context, dc discord.Client, m *discordgo.MessageCreate, server, cmd, header string) {
+	var fmsg *discordgo.Message
+	if svc.needsConfirmation(cmd) {
+		if fmsg = svc.confirmMessage(ctx, dc, m, server, cmd); fmsg == nil {
+			return
+		}
 	} else {
-		_, err = s.ChannelMessageEdit(fmsg.ChannelID, fmsg.ID, out)
+		var err error
+		if fmsg, err = dc.SendMessage(m.ChannelID, header+"Working on it.."); err != nil {
+			svc.logger.Error("send feedback message", zap.Error(err))
+			return
+		}
+	}
+	reply := func(content string, embeds ...*discordgo.MessageEmbed) {
+		out := svc.paginate(m.ID, header+content)
+		edit := discordgo.NewMessageEdit(fmsg.ChannelID, fmsg.ID).SetContent(out.content)
+		edit.Components = out.components
+		edit.Embeds = embeds
+		edit.Files = out.files()
+		if _, err := dc.EditMessageComplex(edit); err != nil {
+			svc.logger.Error("edit feedback message", zap.Error(err))
+		}
+	}
+	if svc.needsApproval(cmd) {
+		svc.requestApproval(ctx, dc, server, cmd, reply)
+		return
+	}
+	ctx, cancel := svc.commandContext(ctx)
+	defer cancel()
+	content, embeds := svc.run(ctx, m.ChannelID, server, cmd)
+	reply(content, embeds...)
+}
+
+// replyFunc replaces the feedback message of a command with its result.
+type replyFunc func(content string, embeds ...*discordgo.MessageEmbed)
+
+// commandContext returns a context that expires after the command timeout.
+func (svc *Service) commandContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if svc.config.CommandTimeout > 0 {
+		return context.WithTimeout(ctx, svc.config.CommandTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// run runs a command on a server, or on every server of a group, and returns
+// the content and the embeds of the feedback message posted in a channel.
+func (svc *Service) run(ctx context.Context, channelID, server, cmd string) (string, []*discordgo.MessageEmbed) {
+	if members, ok := svc.servers.Group(server); ok {
+		return formatFanOutResults(svc.servers.FanOut(ctx, members, cmd)), nil
+	}
+	return svc.execute(ctx, channelID, server, cmd)
+}
+
+// execute runs a command on a single server and returns the content and the
+// embeds of the feedback message posted in a channel. Output recognized by an
+// output parser is rendered as an embed, if enabled, other output is posted
+// as text.
+func (svc *Service) execute(ctx context.Context, channelID, server, cmd string) (string, []*discordgo.MessageEmbed) {
+	steve, err := svc.servers.Get(server)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err.Error()), nil
 	}
+	out, err := steve.Execute(ctx, cmd)
 	if err != nil {
-		svc.logger.Error("edit feedback message", zap.Error(err))
+		return fmt.Sprintf("Error: %s", err.Error()), nil
+	}
+	if svc.config.Embeds {
+		if value, ok := svc.outputs.Parse(cmd, out); ok {
+			if embed := renderEmbed(server, value); embed != nil {
+				return "", []*discordgo.MessageEmbed{embed}
+			}
+		}
+	}
+	return mcformat.Format(out, svc.outputFormat(channelID)), nil
+}
+
+// outputFormat returns how formatting codes are rendered in a channel. The
+// formats are checked by Validate, an unknown one strips the codes.
+func (svc *Service) outputFormat(channelID string) mcformat.Mode {
+	format, ok := svc.config.ChannelOutputFormats[channelID]
+	if !ok {
+		format = svc.config.OutputFormat
+	}
+	mode, _ := mcformat.ParseMode(format)
+	return mode
+}
+
+// selectServer returns the name of the server (or group of servers) a command
+// is meant for and the command without the server selector. Commands without
+// a selector go to the default server of the channel, if any, or to the
+// default server.
+func (svc *Service) selectServer(channelID string, argv []string) (string, []string) {
+	if len(argv) > 0 && svc.config.ServerSelector != "" &&
+		strings.HasPrefix(argv[0], svc.config.ServerSelector) {
+		return strings.TrimPrefix(argv[0], svc.config.ServerSelector), argv[1:]
+	}
+	return svc.channelServer(channelID), argv
+}
+
+// channelServer returns the default server of a channel, or the default
+// server if the channel has none.
+func (svc *Service) channelServer(channelID string) string {
+	if server, ok := svc.config.ChannelServers[channelID]; ok {
+		return server
 	}
+	return svc.servers.Default()
 }
@@ -0,0 +1,327 @@
+package botv2i
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/discord/discordtest"
+	"github.com/cezarmathe/stevebot/internal/mcformat"
+	"github.com/cezarmathe/stevebot/internal/policy"
+	stevev2i "github.com/cezarmathe/stevebot/internal/steve/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	testBotUserID = "bot"
+	testChannelID = "channel"
+)
+
+// fakeSteve is a SteveV2 that answers every command with the same output, or
+// waits for the context to be done if block is set.
+type fakeSteve struct {
+	out   string
+	err   error
+	block bool
+
+	mu   sync.Mutex
+	cmds []string
+}
+
+func (f *fakeSteve) Execute(ctx context.Context, cmd string) (string, error) {
+	f.mu.Lock()
+	f.cmds = append(f.cmds, cmd)
+	f.mu.Unlock()
+
+	if f.block {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return f.out, f.err
+}
+
+func (f *fakeSteve) commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.cmds...)
+}
+
+func newTestService(t *testing.T, config *Config, permissions *Permissions, servers map[string]*fakeSteve) Service {
+	t.Helper()
+
+	registry := stevev2i.NewRegistry("default")
+	for name, steve := range servers {
+		if err := registry.Add(name, steve); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if config.CommandPrefix == "" {
+		config.CommandPrefix = "~"
+	}
+	if config.ServerSelector == "" {
+		config.ServerSelector = "@"
+	}
+	return New(config, zap.NewNop(), permissions, nil, nil, nil, registry)
+}
+
+func newMessage(content string) *discordgo.MessageCreate {
+	return &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:        "message",
+		ChannelID: testChannelID,
+		Content:   content,
+		Author:    &discordgo.User{ID: "user", Username: "steve"},
+		Member:    &discordgo.Member{Roles: []string{"players"}},
+	}}
+}
+
+// assertTimeline checks that the operations performed on dc match the
+// expected kinds and contents.
+func assertTimeline(t *testing.T, dc *discordtest.Client, want ...discordtest.Event) {
+	t.Helper()
+
+	got := dc.Timeline()
+	if len(got) != len(want) {
+		t.Fatalf("got timeline %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].Kind != want[i].Kind || got[i].Content != want[i].Content {
+			t.Errorf("event %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestHandleCommand(t *testing.T) {
+	steve := &fakeSteve{out: "There are 0 of a max of 20 players online: "}
+	svc := newTestService(t, &Config{}, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~list"))
+
+	assertTimeline(t, dc,
+		discordtest.Event{Kind: discordtest.Send, Content: "Working on it.."},
+		discordtest.Event{Kind: discordtest.Edit, Content: "There are 0 of a max of 20 players online: "})
+	if got := steve.commands(); len(got) != 1 || got[0] != "list" {
+		t.Errorf("steve received %q, want [list]", got)
+	}
+}
+
+func TestHandleCommandError(t *testing.T) {
+	steve := &fakeSteve{err: errors.New("boom")}
+	svc := newTestService(t, &Config{}, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~list"))
+
+	assertTimeline(t, dc,
+		discordtest.Event{Kind: discordtest.Send, Content: "Working on it.."},
+		discordtest.Event{Kind: discordtest.Edit, Content: "Error: boom"})
+}
+
+func TestHandleCommandTimeout(t *testing.T) {
+	steve := &fakeSteve{block: true}
+	svc := newTestService(t, &Config{CommandTimeout: 10 * time.Millisecond}, nil,
+		map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~list"))
+
+	assertTimeline(t, dc,
+		discordtest.Event{Kind: discordtest.Send, Content: "Working on it.."},
+		discordtest.Event{Kind: discordtest.Edit, Content: "Error: " + context.DeadlineExceeded.Error()})
+}
+
+func TestHandleCommandIgnored(t *testing.T) {
+	steve := &fakeSteve{}
+	svc := newTestService(t, &Config{}, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("hello there"))
+	own := newMessage("~list")
+	own.Author.ID = testBotUserID
+	svc.HandleCommand(context.Background(), dc, own)
+
+	assertTimeline(t, dc)
+	if got := steve.commands(); len(got) != 0 {
+		t.Errorf("steve received %q", got)
+	}
+}
+
+func TestHandleCommandSendFails(t *testing.T) {
+	steve := &fakeSteve{}
+	svc := newTestService(t, &Config{}, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+	dc.FailNext(discordtest.Send, errors.New("missing permissions"))
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~list"))
+
+	if got := dc.Timeline(); len(got) != 1 || got[0].Err == nil {
+		t.Errorf("got timeline %v, want a single failed send", got)
+	}
+	if got := steve.commands(); len(got) != 0 {
+		t.Errorf("steve received %q", got)
+	}
+}
+
+func TestHandleCommandEditFails(t *testing.T) {
+	steve := &fakeSteve{out: "ok"}
+	svc := newTestService(t, &Config{}, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+	dc.FailNext(discordtest.Edit, errors.New("message too long"))
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~list"))
+
+	got := dc.Timeline()
+	if len(got) != 2 || got[1].Kind != discordtest.Edit || got[1].Err == nil {
+		t.Errorf("got timeline %v, want a send and a failed edit", got)
+	}
+}
+
+func TestHandleCommandPermissionDenied(t *testing.T) {
+	steve := &fakeSteve{}
+	permissions := &Permissions{Grants: []Grant{{
+		Name:   "players",
+		Roles:  []string{"players"},
+		Policy: *policy.AllowList([]string{"list"}),
+	}}}
+	svc := newTestService(t, &Config{}, permissions, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~op steve"))
+
+	got := dc.Timeline()
+	if len(got) != 1 || !strings.HasPrefix(got[0].Content, "Error: "+ErrNoPermission.Error()) {
+		t.Errorf("got timeline %v, want a permission error", got)
+	}
+	if got := steve.commands(); len(got) != 0 {
+		t.Errorf("steve received %q", got)
+	}
+}
+
+func TestHandleCommandServerSelector(t *testing.T) {
+	survival := &fakeSteve{out: "survival"}
+	creative := &fakeSteve{out: "creative"}
+	config := &Config{ChannelServers: map[string]string{"creative-chat": "creative"}}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{
+		"default":  survival,
+		"creative": creative,
+	})
+
+	dc := discordtest.NewClient(testBotUserID)
+	svc.HandleCommand(context.Background(), dc, newMessage("~@creative time set day"))
+	m := newMessage("~time set night")
+	m.ChannelID = "creative-chat"
+	svc.HandleCommand(context.Background(), dc, m)
+	svc.HandleCommand(context.Background(), dc, newMessage("~time set noon"))
+
+	if got := creative.commands(); len(got) != 2 || got[0] != "time set day" || got[1] != "time set night" {
+		t.Errorf("creative received %q", got)
+	}
+	if got := survival.commands(); len(got) != 1 || got[0] != "time set noon" {
+		t.Errorf("survival received %q", got)
+	}
+}
+
+func TestHandleCommandUnknownServer(t *testing.T) {
+	svc := newTestService(t, &Config{}, nil, map[string]*fakeSteve{"default": {}})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~@modded list"))
+
+	got := dc.Timeline()
+	if len(got) != 2 || !strings.HasPrefix(got[1].Content, "Error: "+stevev2i.ErrUnknownServer.Error()) {
+		t.Errorf("got timeline %v, want an unknown server error", got)
+	}
+}
+
+func TestHandleCommandFanOut(t *testing.T) {
+	survival := &fakeSteve{out: "Saved the game"}
+	creative := &fakeSteve{err: errors.New("no rcon connection available")}
+	registry := stevev2i.NewRegistry("survival")
+	registry.Add("survival", survival)
+	registry.Add("creative", creative)
+	registry.AddToGroup("all", "survival")
+	registry.AddToGroup("all", "creative")
+	svc := New(&Config{CommandPrefix: "~", ServerSelector: "@"}, zap.NewNop(), nil, nil, nil, nil, registry)
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~@all save-all"))
+
+	got := dc.Timeline()
+	if len(got) != 2 {
+		t.Fatalf("got timeline %v", got)
+	}
+	table := got[1].Content
+	for _, want := range []string{"survival  ok      Saved the game", "creative  error   no rcon connection available"} {
+		if !strings.Contains(table, want) {
+			t.Errorf("table %q does not contain %q", table, want)
+		}
+	}
+}
+
+func TestHandleCommandBotCommandNotAdmin(t *testing.T) {
+	svc := newTestService(t, &Config{AdminRoles: []string{"admins"}}, nil, map[string]*fakeSteve{"default": {}})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~audit"))
+
+	assertTimeline(t, dc, discordtest.Event{Kind: discordtest.Send, Content: "Error: " + ErrNotAdmin.Error()})
+}
+
+func TestHandleCommandOutputFormat(t *testing.T) {
+	steve := &fakeSteve{out: "§aThere are §c0§a players online"}
+	config := &Config{OutputFormat: "ansi", ChannelOutputFormats: map[string]string{"plain": "strip"}}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~list"))
+	m := newMessage("~list")
+	m.ChannelID = "plain"
+	svc.HandleCommand(context.Background(), dc, m)
+
+	got := dc.Timeline()
+	if len(got) != 4 {
+		t.Fatalf("got timeline %v", got)
+	}
+	if !strings.HasPrefix(got[1].Content, "```ansi\n\x1b[0;32mThere are ") {
+		t.Errorf("got %q, want an ansi code block", got[1].Content)
+	}
+	if got[3].Content != "There are 0 players online" {
+		t.Errorf("got %q, want the output without formatting codes", got[3].Content)
+	}
+}
+
+func TestCodeBlock(t *testing.T) {
+	got := codeBlock(strings.Repeat("é", 1500))
+	if len(got) > 2000 || !utf8.ValidString(got) || !strings.HasSuffix(got, "…\n```") {
+		t.Errorf("got %d bytes (valid UTF-8: %v), want a valid code block cut short", len(got), utf8.ValidString(got))
+	}
+}
+
+func TestValidateOutputFormats(t *testing.T) {
+	tests := []struct {
+		config *Config
+		valid  bool
+	}{
+		{&Config{OutputFormat: "ansi"}, true},
+		{&Config{OutputFormat: "ANSI", ChannelOutputFormats: map[string]string{"plain": "Strip"}}, true},
+		{&Config{OutputFormat: "asni"}, false},
+		{&Config{OutputFormat: "raw", ChannelOutputFormats: map[string]string{"plain": "plain"}}, false},
+	}
+	for _, test := range tests {
+		if err := test.config.Validate(); (err == nil) != test.valid {
+			t.Errorf("%+v: got %v, want valid %v", test.config, err, test.valid)
+		}
+	}
+
+	// formats are case insensitive
+	svc := newTestService(t, &Config{OutputFormat: "ANSI"}, nil, map[string]*fakeSteve{"default": {}})
+	if got := svc.outputFormat(testChannelID); got != mcformat.ModeANSI {
+		t.Errorf("got %q, want %q", got, mcformat.ModeANSI)
+	}
+}
@@ -0,0 +1,210 @@
+package botv2i
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"github.com/cezarmathe/stevebot/internal/mcformat"
+	"github.com/cezarmathe/stevebot/internal/query"
+	"github.com/cezarmathe/stevebot/internal/slp"
+	"go.uber.org/zap"
+)
+
+const (
+	// statusCommand pings a server, or every server of a group, instead of
+	// sending a command to it.
+	statusCommand = "status"
+
+	// Minecraft red
+	offlineEmbedColor = 0xff5555
+	// Discord accepts at most 10 embeds per message.
+	maxEmbeds        = 10
+	maxListedPlayers = 50
+	faviconPrefix    = "data:image/png;base64,"
+	faviconFileName  = "%s.png"
+)
+
+var (
+	ErrNoStatusAddress = errors.New("no status address configured for this server")
+	ErrNoQueryAddress  = errors.New("no query address configured for this server")
+)
+
+// serverStatus is the result of a status ping and, for servers with a query
+// port, of a query.
+type serverStatus struct {
+	server string
+	status *slp.Status
+	stat   *query.Stat
+	err    error
+}
+
+// handleStatusCommand pings a server, or every server of a group, with the
+// Server List Ping protocol, which works even if RCON does not, and posts
+// their status.
+func (svc *Service) handleStatusCommand(ctx context.Context, dc discord.Client, channelID, server string) {
+	servers := []string{server}
+	if members, ok := svc.servers.Group(server); ok {
+		servers = members
+	}
+	if len(servers) > maxEmbeds {
+		servers = servers[:maxEmbeds]
+	}
+	ctx, cancel := svc.commandContext(ctx)
+	defer cancel()
+
+	statuses := make([]serverStatus, len(servers))
+	var wg sync.WaitGroup
+	for i, name := range servers {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			statuses[i] = svc.serverStatus(ctx, name)
+		}(i, name)
+	}
+	wg.Wait()
+
+	send := &discordgo.MessageSend{}
+	for _, s := range statuses {
+		embed, favicon := renderStatus(s)
+		send.Embeds = append(send.Embeds, embed)
+		if favicon != nil {
+			send.Files = append(send.Files, favicon)
+		}
+	}
+	if _, err := dc.SendMessageComplex(channelID, send); err != nil {
+		svc.logger.Error("send status", zap.String("server", server), zap.Error(err))
+	}
+}
+
+// serverStatus pings a server and queries it, if it has a query port, at the
+// same time.
+func (svc *Service) serverStatus(ctx context.Context, server string) serverStatus {
+	result := serverStatus{server: server}
+	if _, err := svc.servers.Get(server); err != nil {
+		result.err = err
+		return result
+	}
+	stats := make(chan *query.Stat, 1)
+	go func() {
+		stat, _ := svc.query(ctx, server)
+		stats <- stat
+	}()
+	if address := svc.config.StatusAddresses[server]; address != "" {
+		result.status, result.err = slp.Ping(ctx, address)
+		if result.err != nil {
+			svc.logger.Debug("ping", zap.String("server", server), zap.Error(result.err))
+		}
+	} else {
+		result.err = ErrNoStatusAddress
+	}
+	result.stat = <-stats
+	return result
+}
+
+// query returns the full stat of a server, or ErrNoQueryAddress if it has no
+// query port.
+func (svc *Service) query(ctx context.Context, server string) (*query.Stat, error) {
+	address := svc.config.QueryAddresses[server]
+	if address == "" {
+		return nil, ErrNoQueryAddress
+	}
+	stat, err := query.FullStat(ctx, address)
+	if err != nil {
+		svc.logger.Debug("query", zap.String("server", server), zap.Error(err))
+	}
+	return stat, err
+}
+
+// renderStatus renders the status of a server as an embed, with its favicon
+// as a thumbnail attached to the message, if it has one. The full stat of the
+// server, if any, fills in the players and plugins, and stands in for the
+// status if the ping failed.
+func renderStatus(s serverStatus) (*discordgo.MessageEmbed, *discordgo.File) {
+	if s.status == nil && s.stat == nil {
+		return &discordgo.MessageEmbed{
+			Title:       s.server,
+			Description: fmt.Sprintf("Offline: %s", s.err.Error()),
+			Color:       offlineEmbedColor,
+		}, nil
+	}
+	var motd, version, latency string
+	var online, maxPlayers int
+	var players []string
+	if status := s.status; status != nil {
+		motd, version = status.Description, status.Version.Name
+		online, maxPlayers = status.Players.Online, status.Players.Max
+		latency = status.Latency.Round(time.Millisecond).String()
+		for _, player := range status.Players.Sample {
+			players = append(players, player.Name)
+		}
+	} else {
+		motd, version = s.stat.MOTD, s.stat.Version
+		online, maxPlayers = s.stat.NumPlayers, s.stat.MaxPlayers
+		latency = "unknown"
+	}
+	if s.stat != nil {
+		players = s.stat.Players
+	}
+	version = mcformat.Strip(version)
+	if version == "" {
+		version = "unknown"
+	}
+	if s.status != nil && s.status.Legacy {
+		version += " (legacy ping)"
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       s.server,
+		Description: truncate(mcformat.Strip(motd), maxEmbedDescription),
+		Color:       embedColor,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Version", Value: version, Inline: true},
+			{Name: "Players", Value: fmt.Sprintf("%d/%d", online, maxPlayers), Inline: true},
+			{Name: "Latency", Value: latency, Inline: true},
+		},
+	}
+	if s.stat != nil && s.stat.Software != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Software", Value: s.stat.Software, Inline: true})
+	}
+	if s.stat != nil && s.stat.Map != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Map", Value: s.stat.Map, Inline: true})
+	}
+	if len(players) > 0 {
+		names := make([]string, 0, len(players))
+		for i, player := range players {
+			if i == maxListedPlayers {
+				names = append(names, fmt.Sprintf("and %d more", len(players)-i))
+				break
+			}
+			names = append(names, mcformat.Strip(player))
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Online",
+			Value: truncate(strings.Join(names, ", "), maxEmbedFieldValue),
+		})
+	}
+	if s.stat != nil && len(s.stat.Plugins) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  fmt.Sprintf("Plugins (%d)", len(s.stat.Plugins)),
+			Value: truncate(strings.Join(s.stat.Plugins, ", "), maxEmbedFieldValue),
+		})
+	}
+
+	if s.status == nil || !strings.HasPrefix(s.status.Favicon, faviconPrefix) {
+		return embed, nil
+	}
+	png, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s.status.Favicon, faviconPrefix))
+	if err != nil {
+		return embed, nil
+	}
+	name := fmt.Sprintf(faviconFileName, s.server)
+	embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: "attachment://" + name}
+	return embed, &discordgo.File{Name: name, ContentType: "image/png", Reader: bytes.NewReader(png)}
+}
@@ -0,0 +1,110 @@
+package botv2i
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cezarmathe/stevebot/internal/discord/discordtest"
+	"github.com/cezarmathe/stevebot/internal/query/querytest"
+	"github.com/cezarmathe/stevebot/internal/slp/slptest"
+)
+
+func TestHandleStatusCommand(t *testing.T) {
+	srv := slptest.NewServer(slptest.Config{Status: `{
+		"version": {"name": "Paper 1.20.1", "protocol": 763},
+		"players": {"max": 20, "online": 1, "sample": [{"name": "steve", "id": "8667ba71-b85a-4004-af54-457a9734eed7"}]},
+		"description": "§aA Minecraft Server",
+		"favicon": "data:image/png;base64,iVBORw0KGgo="
+	}`})
+	defer srv.Close()
+	steve := &fakeSteve{}
+	config := &Config{StatusAddresses: map[string]string{"default": srv.Addr}}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": steve})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~status"))
+
+	got := dc.Timeline()
+	if len(got) != 1 || len(got[0].Embeds) != 1 || len(got[0].Files) != 1 {
+		t.Fatalf("got timeline %v, want a status embed", got)
+	}
+	embed := got[0].Embeds[0]
+	if embed.Title != "default" || embed.Description != "A Minecraft Server" {
+		t.Errorf("got embed %+v", embed)
+	}
+	fields := make(map[string]string)
+	for _, field := range embed.Fields {
+		fields[field.Name] = field.Value
+	}
+	if fields["Version"] != "Paper 1.20.1" || fields["Players"] != "1/20" || fields["Online"] != "steve" {
+		t.Errorf("got fields %v", fields)
+	}
+	if embed.Thumbnail == nil || embed.Thumbnail.URL != "attachment://"+got[0].Files[0].Name {
+		t.Errorf("got thumbnail %+v, want the favicon", embed.Thumbnail)
+	}
+	if cmds := steve.commands(); len(cmds) != 0 {
+		t.Errorf("steve received %q", cmds)
+	}
+}
+
+func TestHandleStatusCommandOffline(t *testing.T) {
+	srv := slptest.NewServer(slptest.Config{})
+	addr := srv.Addr
+	srv.Close()
+	servers := map[string]*fakeSteve{"default": {}, "creative": {}}
+	config := &Config{StatusAddresses: map[string]string{"default": addr}}
+	svc := newTestService(t, config, nil, servers)
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~status"))
+	svc.HandleCommand(context.Background(), dc, newMessage("~@creative status"))
+
+	got := dc.Timeline()
+	if len(got) != 2 {
+		t.Fatalf("got timeline %v", got)
+	}
+	if embed := got[0].Embeds[0]; !strings.HasPrefix(embed.Description, "Offline: ") || embed.Color != offlineEmbedColor {
+		t.Errorf("got embed %+v, want the server offline", embed)
+	}
+	if embed := got[1].Embeds[0]; embed.Title != "creative" || !strings.Contains(embed.Description, ErrNoStatusAddress.Error()) {
+		t.Errorf("got embed %+v, want a missing address", embed)
+	}
+}
+
+func TestHandleStatusCommandQuery(t *testing.T) {
+	srv := querytest.NewServer(querytest.Config{
+		Values: map[string]string{
+			"hostname":   "A Minecraft Server",
+			"version":    "1.20.1",
+			"plugins":    "Paper on 1.20.1: EssentialsX 2.20.1; LuckPerms 5.4.102",
+			"map":        "world",
+			"numplayers": "2",
+			"maxplayers": "20",
+		},
+		Players: []string{"alex", "steve"},
+	})
+	defer srv.Close()
+	config := &Config{QueryAddresses: map[string]string{"default": srv.Addr}}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": {}})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~status"))
+
+	got := dc.Timeline()
+	if len(got) != 1 || len(got[0].Embeds) != 1 {
+		t.Fatalf("got timeline %v, want a status embed", got)
+	}
+	embed := got[0].Embeds[0]
+	if embed.Description != "A Minecraft Server" || embed.Color == offlineEmbedColor {
+		t.Errorf("got embed %+v, want the full stat to stand in for the ping", embed)
+	}
+	fields := make(map[string]string)
+	for _, field := range embed.Fields {
+		fields[field.Name] = field.Value
+	}
+	if fields["Players"] != "2/20" || fields["Online"] != "alex, steve" || fields["Map"] != "world" ||
+		fields["Software"] != "Paper on 1.20.1" || fields["Plugins (2)"] != "EssentialsX 2.20.1, LuckPerms 5.4.102" {
+		t.Errorf("got fields %v", fields)
+	}
+}
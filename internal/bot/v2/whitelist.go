@@ -0,0 +1,360 @@
+package botv2i
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/discord"
+	"github.com/cezarmathe/stevebot/internal/links"
+	"github.com/cezarmathe/stevebot/internal/mcoutput"
+	"go.uber.org/zap"
+)
+
+const (
+	// Discord returns at most 1000 members per request.
+	guildMembersLimit = 1000
+)
+
+var (
+	ErrWhitelistSyncDisabled = errors.New("whitelist sync is not enabled")
+)
+
+// whitelistChanges are the changes made to the whitelist of a server.
+type whitelistChanges struct {
+	server string
+	add    []string
+	remove []string
+	err    error
+}
+
+// whitelistSync reports whether the whitelist is kept in sync with the
+// members of the whitelist role.
+func (svc *Service) whitelistSync() bool {
+	return svc.links != nil && svc.config.WhitelistGuild != "" && svc.config.WhitelistRole != ""
+}
+
+// whitelistServers returns the servers whose whitelist is kept in sync.
+func (svc *Service) whitelistServers() []string {
+	if len(svc.config.WhitelistServers) > 0 {
+		return svc.config.WhitelistServers
+	}
+	return svc.servers.Names()
+}
+
+// hasWhitelistRole reports whether a member holds the whitelist role.
+func (svc *Service) hasWhitelistRole(member *discordgo.Member) bool {
+	if member == nil {
+		return false
+	}
+	for _, role := range member.Roles {
+		if role == svc.config.WhitelistRole {
+			return true
+		}
+	}
+	return false
+}
+
+// RunWhitelistSync reconciles the whitelists with the members of the
+// whitelist role every WhitelistReconcileInterval, until ctx is done.
+func (svc *Service) RunWhitelistSync(ctx context.Context, dc discord.Client) {
+	if !svc.whitelistSync() || svc.config.WhitelistReconcileInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(svc.config.WhitelistReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		reconcileCtx, cancel := context.WithTimeout(ctx, svc.config.WhitelistReconcileInterval)
+		changes, err := svc.reconcileWhitelist(reconcileCtx, dc, svc.config.WhitelistDryRun)
+		cancel()
+		if err != nil {
+			svc.logger.Error("reconcile whitelist", zap.Error(err))
+		} else {
+			svc.reportWhitelist(dc, changes, svc.config.WhitelistDryRun)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// HandleMemberUpdate whitelists the linked account of a guild member who
+// gained the whitelist role, and removes the one of a member who lost it.
+func (svc *Service) HandleMemberUpdate(ctx context.Context, dc discord.Client, m *discordgo.GuildMemberUpdate) {
+	if !svc.whitelistSync() || m.GuildID != svc.config.WhitelistGuild || m.User == nil {
+		return
+	}
+	whitelisted := svc.hasWhitelistRole(m.Member)
+	// members that were not cached are updated anyway, whitelisting is
+	// idempotent
+	if m.BeforeUpdate != nil && svc.hasWhitelistRole(m.BeforeUpdate) == whitelisted {
+		return
+	}
+	svc.updateWhitelist(ctx, dc, m.User.ID, whitelisted)
+}
+
+// HandleMemberRemove removes the linked account of a member who left the
+// guild from the whitelist.
+func (svc *Service) HandleMemberRemove(ctx context.Context, dc discord.Client, m *discordgo.GuildMemberRemove) {
+	if !svc.whitelistSync() || m.GuildID != svc.config.WhitelistGuild || m.User == nil {
+		return
+	}
+	svc.updateWhitelist(ctx, dc, m.User.ID, false)
+}
+
+// updateWhitelist adds the linked account of a user to the whitelists, or
+// removes it.
+func (svc *Service) updateWhitelist(ctx context.Context, dc discord.Client, userID string, whitelisted bool) {
+	l, err := svc.links.ByUser(userID)
+	if errors.Is(err, links.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		svc.logger.Error("look up link", zap.Error(err))
+		return
+	}
+	svc.changeWhitelist(ctx, dc, []links.Link{l}, func(links.Link) bool { return whitelisted })
+}
+
+// changeWhitelist syncs the whitelists with some links and reports the
+// changes.
+func (svc *Service) changeWhitelist(ctx context.Context, dc discord.Client, ls []links.Link, wanted func(links.Link) bool) {
+	ctx, cancel := svc.commandContext(ctx)
+	defer cancel()
+
+	dryRun := svc.config.WhitelistDryRun
+	svc.reportWhitelist(dc, svc.syncLinks(ctx, ls, wanted, dryRun), dryRun)
+}
+
+// reconcileWhitelist syncs the whitelist of every server with the linked
+// accounts of the members of the whitelist role.
+func (svc *Service) reconcileWhitelist(ctx context.Context, dc discord.Client, dryRun bool) ([]whitelistChanges, error) {
+	if !svc.whitelistSync() {
+		return nil, ErrWhitelistSyncDisabled
+	}
+	members, err := svc.roleMembers(dc)
+	if err != nil {
+		return nil, fmt.Errorf("list guild members: %w", err)
+	}
+	all, err := svc.links.List()
+	if err != nil {
+		return nil, fmt.Errorf("list links: %w", err)
+	}
+	return svc.syncLinks(ctx, all, func(l links.Link) bool { return members[l.UserID] }, dryRun), nil
+}
+
+// syncLinks adds the accounts of the wanted links to the whitelists they are
+// missing from, and removes the other accounts from the whitelists the sync
+// added them to, unless dryRun is set. Where the sync added an account is
+// recorded in its link, so players whitelisted by hand are never removed,
+// whoever links them.
+func (svc *Service) syncLinks(ctx context.Context, ls []links.Link, wanted func(links.Link) bool, dryRun bool) []whitelistChanges {
+	svc.whitelistMu.Lock()
+	defer svc.whitelistMu.Unlock()
+
+	// servers the sync added the account of each link to, as recorded once
+	// the syncs that ran in the meantime are done
+	added := make([]map[string]bool, len(ls))
+	for i, l := range ls {
+		if current, err := svc.links.ByUser(l.UserID); err == nil && strings.EqualFold(current.Player, l.Player) {
+			l.Whitelisted = current.Whitelisted
+		}
+		added[i] = make(map[string]bool, len(l.Whitelisted))
+		for _, server := range l.Whitelisted {
+			added[i][server] = true
+		}
+	}
+	changed := make([]bool, len(ls))
+
+	var changes []whitelistChanges
+	for _, server := range svc.whitelistServers() {
+		c := whitelistChanges{server: server}
+		current, err := svc.whitelist(ctx, server)
+		if err != nil {
+			c.err = err
+			changes = append(changes, c)
+			continue
+		}
+		for i, l := range ls {
+			_, present := current[strings.ToLower(l.Player)]
+			var cmd string
+			switch {
+			case wanted(l) && !present:
+				c.add = append(c.add, l.Player)
+				cmd = "whitelist add "
+			case wanted(l) || !added[i][server]:
+				continue
+			case present:
+				c.remove = append(c.remove, l.Player)
+				cmd = "whitelist remove "
+			default:
+				// removed by hand
+			}
+			if dryRun {
+				continue
+			}
+			if cmd != "" {
+				if err := svc.runWhitelist(ctx, server, cmd+l.Player); err != nil {
+					if c.err == nil {
+						c.err = err
+					}
+					continue
+				}
+			}
+			added[i][server] = wanted(l)
+			changed[i] = true
+		}
+		sort.Strings(c.add)
+		sort.Strings(c.remove)
+		changes = append(changes, c)
+	}
+
+	for i, l := range ls {
+		if !changed[i] {
+			continue
+		}
+		var servers []string
+		for server, ok := range added[i] {
+			if ok {
+				servers = append(servers, server)
+			}
+		}
+		sort.Strings(servers)
+		// unlinked accounts are not recorded anymore
+		if err := svc.links.SetWhitelisted(l.UserID, l.Player, servers); err != nil && !errors.Is(err, links.ErrNotFound) {
+			svc.logger.Error("store whitelisted servers", zap.String("player", l.Player), zap.Error(err))
+		}
+	}
+	return changes
+}
+
+// wlsyncCommand reconciles the whitelists with the members of the whitelist
+// role now, or only reports the changes it would make.
+//
+// Usage: wlsync [dry]
+func (svc *Service) wlsyncCommand(ctx context.Context, dc discord.Client, m *discordgo.MessageCreate, args []string) string {
+	ctx, cancel := svc.commandContext(ctx)
+	defer cancel()
+
+	dryRun := svc.config.WhitelistDryRun || (len(args) > 0 && args[0] == "dry")
+	changes, err := svc.reconcileWhitelist(ctx, dc, dryRun)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err.Error())
+	}
+	if report := formatWhitelistChanges(changes, dryRun); report != "" {
+		return report
+	}
+	return "The whitelists are in sync."
+}
+
+// roleMembers returns the ids of the members of the whitelist role.
+func (svc *Service) roleMembers(dc discord.Client) (map[string]bool, error) {
+	members := make(map[string]bool)
+	after := ""
+	for {
+		page, err := dc.GuildMembers(svc.config.WhitelistGuild, after, guildMembersLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range page {
+			if svc.hasWhitelistRole(member) {
+				members[member.User.ID] = true
+			}
+		}
+		if len(page) < guildMembersLimit {
+			return members, nil
+		}
+		after = page[len(page)-1].User.ID
+	}
+}
+
+// whitelist returns the whitelisted players of a server, by lowercase name.
+func (svc *Service) whitelist(ctx context.Context, server string) (map[string]string, error) {
+	steve, err := svc.servers.Get(server)
+	if err != nil {
+		return nil, err
+	}
+	out, err := steve.Execute(ctx, "whitelist list")
+	if err != nil {
+		return nil, err
+	}
+	value, err := mcoutput.ParseWhitelist(nil, out)
+	if err != nil {
+		return nil, fmt.Errorf("parse whitelist: %w", err)
+	}
+	players := make(map[string]string)
+	for _, player := range value.(mcoutput.Whitelist).Players {
+		players[strings.ToLower(player)] = player
+	}
+	return players, nil
+}
+
+// runWhitelist runs a whitelist command on a server.
+func (svc *Service) runWhitelist(ctx context.Context, server, cmd string) error {
+	steve, err := svc.servers.Get(server)
+	if err != nil {
+		return err
+	}
+	if _, err := steve.Execute(ctx, cmd); err != nil {
+		svc.logger.Warn("change whitelist", zap.String("server", server), zap.String("cmd", cmd), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// reportWhitelist posts the changes made to the whitelists in the report
+// channel, if any, or logs them.
+func (svc *Service) reportWhitelist(dc discord.Client, changes []whitelistChanges, dryRun bool) {
+	report := formatWhitelistChanges(changes, dryRun)
+	if report == "" {
+		return
+	}
+	if svc.config.WhitelistReportChannel == "" {
+		svc.logger.Info("whitelist changes", zap.String("report", report))
+		return
+	}
+	send := &discordgo.MessageSend{Content: report, AllowedMentions: &discordgo.MessageAllowedMentions{}}
+	if _, err := dc.SendMessageComplex(svc.config.WhitelistReportChannel, send); err != nil {
+		svc.logger.Error("send whitelist report", zap.Error(err))
+	}
+}
+
+// formatWhitelistChanges formats the changes made to the whitelists, one
+// server per line, empty if there are none.
+func formatWhitelistChanges(changes []whitelistChanges, dryRun bool) string {
+	added, removed := "Added", "Removed"
+	if dryRun {
+		added, removed = "Would add", "Would remove"
+	}
+	var lines []string
+	for _, c := range changes {
+		var parts []string
+		if len(c.add) > 0 {
+			parts = append(parts, fmt.Sprintf("%s %s", added, escapeMarkdown(strings.Join(c.add, ", "))))
+		}
+		if len(c.remove) > 0 {
+			parts = append(parts, fmt.Sprintf("%s %s", removed, escapeMarkdown(strings.Join(c.remove, ", "))))
+		}
+		if c.err != nil {
+			parts = append(parts, fmt.Sprintf("Error: %s", c.err.Error()))
+		}
+		if len(parts) > 0 {
+			lines = append(lines, fmt.Sprintf("**%s**: %s", c.server, strings.Join(parts, "; ")))
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	title := "Whitelist sync"
+	if dryRun {
+		title = "Whitelist sync (dry run)"
+	}
+	return truncate(title+"\n"+strings.Join(lines, "\n"), discord.MessageLimit)
+}
@@ -0,0 +1,231 @@
+package botv2i
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/discord/discordtest"
+	"github.com/cezarmathe/stevebot/internal/links"
+)
+
+// newWhitelistService returns a service syncing the whitelist of a server with
+// the members of the "players" role, some of which are linked. The sync added
+// Alex and Herobrine to the whitelist, Notch was whitelisted by hand.
+func newWhitelistService(t *testing.T, steve *fakeSteve, dryRun bool) (Service, *discordtest.Client) {
+	t.Helper()
+
+	config := &Config{
+		AdminUsers:      []string{"user"},
+		WhitelistGuild:  "guild",
+		WhitelistRole:   "players",
+		WhitelistDryRun: dryRun,
+	}
+	svc := newTestService(t, config, nil, map[string]*fakeSteve{"default": steve})
+	svc.links = newTestLinkStore(t)
+	for _, l := range []*links.Link{
+		{UserID: "alex", Player: "Alex", Whitelisted: []string{"default"}},
+		{UserID: "herobrine", Player: "Herobrine", Whitelisted: []string{"default"}},
+		{UserID: "notch", Player: "Notch", Unverified: true},
+		{UserID: "steve", Player: "Steve", Unverified: true},
+	} {
+		if err := svc.links.Put(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dc := discordtest.NewClient(testBotUserID)
+	dc.SetMembers("guild",
+		&discordgo.Member{User: &discordgo.User{ID: "alex"}, Roles: []string{"players"}},
+		&discordgo.Member{User: &discordgo.User{ID: "herobrine"}},
+		&discordgo.Member{User: &discordgo.User{ID: "steve"}, Roles: []string{"players"}},
+	)
+	return svc, dc
+}
+
+func TestWhitelistSync(t *testing.T) {
+	steve := &fakeSteve{out: "There are 3 whitelisted players: alex, herobrine, notch"}
+	svc, dc := newWhitelistService(t, steve, false)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~wlsync"))
+
+	// notch is linked to someone without the role, but was not added by the
+	// sync
+	want := []string{"whitelist list", "whitelist remove Herobrine", "whitelist add Steve"}
+	if cmds := steve.commands(); !reflect.DeepEqual(cmds, want) {
+		t.Errorf("steve received %q, want %q", cmds, want)
+	}
+	assertTimeline(t, dc, discordtest.Event{
+		Kind:    discordtest.Send,
+		Content: "Whitelist sync\n**default**: Added Steve; Removed Herobrine",
+	})
+	assertWhitelisted(t, svc, "Steve", "default")
+	assertWhitelisted(t, svc, "Herobrine")
+	assertWhitelisted(t, svc, "Notch")
+}
+
+// assertWhitelisted checks the servers the sync added a player to.
+func assertWhitelisted(t *testing.T, svc Service, player string, servers ...string) {
+	t.Helper()
+
+	l, err := svc.links.ByPlayer(player)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := append([]string(nil), l.Whitelisted...); !reflect.DeepEqual(got, append([]string(nil), servers...)) {
+		t.Errorf("%s: got whitelisted on %q, want %q", player, l.Whitelisted, servers)
+	}
+}
+
+func TestWhitelistSyncDryRun(t *testing.T) {
+	steve := &fakeSteve{out: "There are 3 whitelisted players: alex, herobrine, notch"}
+	svc, dc := newWhitelistService(t, steve, true)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~wlsync"))
+
+	if cmds := steve.commands(); !reflect.DeepEqual(cmds, []string{"whitelist list"}) {
+		t.Errorf("steve received %q, want only the whitelist listed", cmds)
+	}
+	assertTimeline(t, dc, discordtest.Event{
+		Kind:    discordtest.Send,
+		Content: "Whitelist sync (dry run)\n**default**: Would add Steve; Would remove Herobrine",
+	})
+	assertWhitelisted(t, svc, "Steve")
+	assertWhitelisted(t, svc, "Herobrine", "default")
+}
+
+func TestWhitelistSyncDisabled(t *testing.T) {
+	svc := newTestService(t, &Config{AdminUsers: []string{"user"}}, nil, map[string]*fakeSteve{"default": {}})
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~wlsync"))
+
+	assertTimeline(t, dc, discordtest.Event{Kind: discordtest.Send, Content: "Error: " + ErrWhitelistSyncDisabled.Error()})
+}
+
+func TestHandleMemberUpdate(t *testing.T) {
+	steve := &fakeSteve{out: "There are 3 whitelisted players: alex, notch, steve"}
+	svc, dc := newWhitelistService(t, steve, false)
+
+	member := func(userID string, roles ...string) *discordgo.Member {
+		return &discordgo.Member{GuildID: "guild", User: &discordgo.User{ID: userID}, Roles: roles}
+	}
+	svc.HandleMemberUpdate(context.Background(), dc, &discordgo.GuildMemberUpdate{
+		Member:       member("herobrine", "players"),
+		BeforeUpdate: member("herobrine"),
+	})
+	// unchanged roles
+	svc.HandleMemberUpdate(context.Background(), dc, &discordgo.GuildMemberUpdate{
+		Member:       member("alex", "players", "admins"),
+		BeforeUpdate: member("alex", "players"),
+	})
+	// whitelisted by hand
+	svc.HandleMemberUpdate(context.Background(), dc, &discordgo.GuildMemberUpdate{
+		Member:       member("steve"),
+		BeforeUpdate: member("steve", "players"),
+	})
+	svc.HandleMemberRemove(context.Background(), dc, &discordgo.GuildMemberRemove{Member: member("alex", "players")})
+	// not linked
+	svc.HandleMemberRemove(context.Background(), dc, &discordgo.GuildMemberRemove{Member: member("jeb")})
+
+	want := []string{
+		"whitelist list", "whitelist add Herobrine",
+		"whitelist list",
+		"whitelist list", "whitelist remove Alex",
+	}
+	if cmds := steve.commands(); !reflect.DeepEqual(cmds, want) {
+		t.Errorf("steve received %q, want %q", cmds, want)
+	}
+	if got := dc.Timeline(); len(got) != 0 {
+		t.Errorf("got timeline %v, want the changes logged without a report channel", got)
+	}
+}
+
+func TestMcname(t *testing.T) {
+	steve := &fakeSteve{out: "There are 2 whitelisted players: alex, jeb"}
+	svc, dc := newWhitelistService(t, steve, false)
+
+	mcname := func(player string, guildID string, roles ...string) {
+		m := newMessage("~mcname " + player)
+		m.GuildID = guildID
+		m.Member.Roles = roles
+		svc.HandleCommand(context.Background(), dc, m)
+	}
+	// whitelisted by hand
+	mcname("Jeb", "guild", "players")
+	mcname("Notch2", "guild", "players")
+	mcname("Notch3", "", "players")
+	mcname("Notch3", "guild")
+	mcname("Alex", "guild", "players")
+
+	// jeb is not removed
+	want := []string{"whitelist list", "whitelist list", "whitelist add Notch2"}
+	if cmds := steve.commands(); !reflect.DeepEqual(cmds, want) {
+		t.Errorf("steve received %q, want %q", cmds, want)
+	}
+	got := dc.Timeline()
+	if len(got) != 5 || got[0].Content != "<@user> is now linked to **Jeb** and whitelisted." ||
+		got[2].Content != "Error: "+ErrNoWhitelistRole.Error() ||
+		got[3].Content != "Error: "+ErrNoWhitelistRole.Error() ||
+		got[4].Content != "Error: "+ErrPlayerLinked.Error() {
+		t.Fatalf("got timeline %v", got)
+	}
+	if l, err := svc.links.ByUser("user"); err != nil || l.Player != "Notch2" || !l.Unverified {
+		t.Errorf("got link %+v (%v), want an unverified link to Notch2", l, err)
+	}
+	assertWhitelisted(t, svc, "Notch2", "default")
+}
+
+func TestMcnameRemovesPrevious(t *testing.T) {
+	steve := &fakeSteve{out: "There are 2 whitelisted players: alex, notch"}
+	svc, dc := newWhitelistService(t, steve, false)
+
+	m := newMessage("~mcname Alex2")
+	m.GuildID = "guild"
+	m.Author.ID = "alex"
+	svc.HandleCommand(context.Background(), dc, m)
+
+	want := []string{"whitelist list", "whitelist add Alex2", "whitelist remove Alex"}
+	if cmds := steve.commands(); !reflect.DeepEqual(cmds, want) {
+		t.Errorf("steve received %q, want %q", cmds, want)
+	}
+	assertWhitelisted(t, svc, "Alex2", "default")
+}
+
+func TestMcnameDisabled(t *testing.T) {
+	svc := newTestService(t, &Config{}, nil, map[string]*fakeSteve{"default": {}})
+	svc.links = newTestLinkStore(t)
+	dc := discordtest.NewClient(testBotUserID)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~mcname Steve"))
+
+	assertTimeline(t, dc, discordtest.Event{Kind: discordtest.Send, Content: "Error: " + ErrWhitelistSyncDisabled.Error()})
+}
+
+func TestLinkTakesOverUnverified(t *testing.T) {
+	steve := &fakeSteve{}
+	svc, dc := newWhitelistService(t, steve, false)
+
+	svc.HandleCommand(context.Background(), dc, newMessage("~link Steve"))
+
+	if got := dc.Timeline(); len(got) != 1 || got[0].Content == "Error: "+ErrPlayerLinked.Error() {
+		t.Errorf("got timeline %v, want a code sent to Steve", got)
+	}
+}
+
+func TestWhitelistSyncStaleLink(t *testing.T) {
+	steve := &fakeSteve{out: "There are 2 whitelisted players: alex, herobrine"}
+	svc, _ := newWhitelistService(t, steve, false)
+
+	stale, err := svc.links.ByUser("steve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// another sync whitelisted Steve on another server in the meantime
+	if err := svc.links.SetWhitelisted("steve", "Steve", []string{"creative"}); err != nil {
+		t.Fatal(err)
+	}
+	svc.syncLinks(context.Background(), []links.Link{stale}, func(links.Link) bool { return true }, false)
+
+	assertWhitelisted(t, svc, "Steve", "creative", "default")
+}
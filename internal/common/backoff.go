@@ -0,0 +1,48 @@
+package common
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff computes exponentially growing delays between retries, starting at
+// Min and doubling up to Max.
+//
+// A Backoff is not safe for concurrent use.
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+
+	// Jitter randomizes every delay to a value between half of it and all of
+	// it, so that many clients retrying at once do not retry in lockstep.
+	Jitter bool
+
+	attempt int
+}
+
+// Next returns the delay to wait before the next retry.
+func (b *Backoff) Next() time.Duration {
+	d := b.Min
+	for i := 0; i < b.attempt && d < b.Max; i++ {
+		d *= 2
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	b.attempt++
+
+	if b.Jitter && d > 1 {
+		d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	}
+	return d
+}
+
+// Attempt returns the number of delays handed out since the last reset.
+func (b *Backoff) Attempt() int {
+	return b.attempt
+}
+
+// Reset starts over from Min.
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
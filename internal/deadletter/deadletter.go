@@ -0,0 +1,153 @@
+// Package deadletter keeps commands that finished after whoever sent them
+// stopped waiting, so that their late results are not lost.
+package deadletter
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cezarmathe/stevebot/internal/audit"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	ErrNotFound = errors.New("dead letter not found")
+)
+
+var (
+	lettersBucket = []byte("letters")
+)
+
+// Letter is a command that finished after its caller stopped waiting.
+type Letter struct {
+	ID      uint64       `json:"id"`
+	Time    time.Time    `json:"time"`
+	Server  string       `json:"server,omitempty"`
+	Command string       `json:"command"`
+	Origin  audit.Origin `json:"origin"`
+	Output  string       `json:"output,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// Queue is a dead letter queue backed by a bbolt database.
+type Queue struct {
+	db *bolt.DB
+
+	mu          sync.Mutex
+	subscribers []func(Letter)
+}
+
+// Open opens (or creates) the dead letter queue stored at path.
+func Open(path string) (*Queue, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open dead letter queue: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(lettersBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open dead letter queue: %w", err)
+	}
+	return &Queue{db: db}, nil
+}
+
+// Close closes the queue.
+func (q *Queue) Close() error {
+	return q.db.Close()
+}
+
+// Subscribe registers a function that is called with every new letter.
+func (q *Queue) Subscribe(fn func(Letter)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.subscribers = append(q.subscribers, fn)
+}
+
+// Push persists a letter, sets its id and notifies the subscribers.
+func (q *Queue) Push(l *Letter) error {
+	if l.Time.IsZero() {
+		l.Time = time.Now()
+	}
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(lettersBucket)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		l.ID = id
+		data, err := json.Marshal(l)
+		if err != nil {
+			return err
+		}
+		return b.Put(idKey(id), data)
+	})
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	subscribers := q.subscribers
+	q.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(*l)
+	}
+	return nil
+}
+
+// List returns up to limit letters, newest first.
+func (q *Queue) List(limit int) ([]Letter, error) {
+	letters := make([]Letter, 0)
+	err := q.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(lettersBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var l Letter
+			if err := json.Unmarshal(v, &l); err != nil {
+				return err
+			}
+			letters = append(letters, l)
+			if limit > 0 && len(letters) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	return letters, err
+}
+
+// Get returns the letter with the given id.
+func (q *Queue) Get(id uint64) (Letter, error) {
+	var l Letter
+	err := q.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(lettersBucket).Get(idKey(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &l)
+	})
+	return l, err
+}
+
+// Delete removes the letter with the given id.
+func (q *Queue) Delete(id uint64) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(lettersBucket)
+		if b.Get(idKey(id)) == nil {
+			return ErrNotFound
+		}
+		return b.Delete(idKey(id))
+	})
+}
+
+func idKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
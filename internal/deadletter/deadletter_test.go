@@ -0,0 +1,112 @@
+package deadletter
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func newTestQueue(t *testing.T) *Queue {
+	t.Helper()
+
+	q, err := Open(filepath.Join(t.TempDir(), "deadletters.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func push(t *testing.T, q *Queue, cmd string) *Letter {
+	t.Helper()
+
+	l := &Letter{Server: "default", Command: cmd}
+	if err := q.Push(l); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestPush(t *testing.T) {
+	q := newTestQueue(t)
+	var notified []Letter
+	q.Subscribe(func(l Letter) { notified = append(notified, l) })
+
+	first := push(t, q, "list")
+	second := push(t, q, "save-all")
+
+	if first.ID != 1 || second.ID != 2 {
+		t.Errorf("got ids %d and %d, want 1 and 2", first.ID, second.ID)
+	}
+	if first.Time.IsZero() {
+		t.Error("letter time not set")
+	}
+	if len(notified) != 2 || notified[0].ID != 1 || notified[1].Command != "save-all" {
+		t.Errorf("subscriber got %+v", notified)
+	}
+}
+
+func TestList(t *testing.T) {
+	q := newTestQueue(t)
+	for _, cmd := range []string{"list", "save-all", "time query daytime"} {
+		push(t, q, cmd)
+	}
+
+	tests := []struct {
+		limit int
+		want  []uint64
+	}{
+		{0, []uint64{3, 2, 1}},
+		{2, []uint64{3, 2}},
+		{5, []uint64{3, 2, 1}},
+	}
+	for _, test := range tests {
+		letters, err := q.List(test.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []uint64
+		for _, l := range letters {
+			got = append(got, l.ID)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("limit %d: got ids %v, want %v", test.limit, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("limit %d: got ids %v, want %v", test.limit, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestListEmpty(t *testing.T) {
+	letters, err := newTestQueue(t).List(0)
+	if err != nil || letters == nil || len(letters) != 0 {
+		t.Errorf("got %v (%v), want no letters", letters, err)
+	}
+}
+
+func TestGetDelete(t *testing.T) {
+	q := newTestQueue(t)
+	push(t, q, "list")
+
+	if l, err := q.Get(1); err != nil || l.Command != "list" || l.Server != "default" {
+		t.Errorf("got %+v (%v), want the letter", l, err)
+	}
+	if err := q.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Get(1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want %v", err, ErrNotFound)
+	}
+	if err := q.Delete(1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want %v", err, ErrNotFound)
+	}
+	// ids are not reused
+	if l := push(t, q, "save-all"); l.ID != 2 {
+		t.Errorf("got id %d, want 2", l.ID)
+	}
+}
@@ -0,0 +1,91 @@
+// Package discord abstracts the Discord operations used by stevebot, so that
+// the bot can be tested without talking to Discord.
+package discord
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// Client is the subset of the Discord API used by stevebot.
+type Client interface {
+	// UserID returns the id of the bot user.
+	UserID() string
+
+	// SendMessage sends a message to a channel.
+	SendMessage(channelID, content string) (*discordgo.Message, error)
+
+	// SendMessageComplex sends a message with components, embeds or files to
+	// a channel.
+	SendMessageComplex(channelID string, data *discordgo.MessageSend) (*discordgo.Message, error)
+
+	// EditMessage replaces the content of a message.
+	EditMessage(channelID, messageID, content string) (*discordgo.Message, error)
+
+	// EditMessageComplex replaces the content, components or embeds of a
+	// message.
+	EditMessageComplex(edit *discordgo.MessageEdit) (*discordgo.Message, error)
+
+	// AddReaction reacts to a message with an emoji.
+	AddReaction(channelID, messageID, emoji string) error
+
+	// RespondInteraction sends the initial response to an interaction.
+	RespondInteraction(i *discordgo.Interaction, resp *discordgo.InteractionResponse) error
+
+	// EditInteractionResponse edits the initial response to an interaction,
+	// e.g. after a deferred response.
+	EditInteractionResponse(i *discordgo.Interaction, edit *discordgo.WebhookEdit) (*discordgo.Message, error)
+
+	// GuildMembers returns up to limit members of a guild, ordered by user
+	// id, starting after the member with id after, if not empty.
+	GuildMembers(guildID, after string, limit int) ([]*discordgo.Member, error)
+}
+
+// Session is a Client backed by a discordgo session.
+type Session struct {
+	inner *discordgo.Session
+}
+
+var (
+	_ Client = (*Session)(nil)
+)
+
+// NewSession creates a client backed by a discordgo session.
+func NewSession(s *discordgo.Session) *Session {
+	return &Session{s}
+}
+
+func (s *Session) UserID() string {
+	return s.inner.State.User.ID
+}
+
+func (s *Session) SendMessage(channelID, content string) (*discordgo.Message, error) {
+	return s.inner.ChannelMessageSend(channelID, content)
+}
+
+func (s *Session) SendMessageComplex(channelID string, data *discordgo.MessageSend) (*discordgo.Message, error) {
+	return s.inner.ChannelMessageSendComplex(channelID, data)
+}
+
+func (s *Session) EditMessage(channelID, messageID, content string) (*discordgo.Message, error) {
+	return s.inner.ChannelMessageEdit(channelID, messageID, content)
+}
+
+func (s *Session) EditMessageComplex(edit *discordgo.MessageEdit) (*discordgo.Message, error) {
+	return s.inner.ChannelMessageEditComplex(edit)
+}
+
+func (s *Session) AddReaction(channelID, messageID, emoji string) error {
+	return s.inner.MessageReactionAdd(channelID, messageID, emoji)
+}
+
+func (s *Session) RespondInteraction(i *discordgo.Interaction, resp *discordgo.InteractionResponse) error {
+	return s.inner.InteractionRespond(i, resp)
+}
+
+func (s *Session) EditInteractionResponse(i *discordgo.Interaction, edit *discordgo.WebhookEdit) (*discordgo.Message, error) {
+	return s.inner.InteractionResponseEdit(i, edit)
+}
+
+func (s *Session) GuildMembers(guildID, after string, limit int) ([]*discordgo.Member, error) {
+	return s.inner.GuildMembers(guildID, after, limit)
+}
@@ -0,0 +1,325 @@
+// Package discordtest provides an in-memory Discord client for tests.
+package discordtest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cezarmathe/stevebot/internal/discord"
+)
+
+// EventKind is the kind of an operation performed on a client.
+type EventKind string
+
+const (
+	Send  EventKind = "send"
+	Edit  EventKind = "edit"
+	React EventKind = "react"
+
+	Respond      EventKind = "respond"
+	EditResponse EventKind = "edit-response"
+)
+
+// Event is an operation performed on a client. Failed operations are recorded
+// too, with their error.
+type Event struct {
+	Kind      EventKind
+	ChannelID string
+	// MessageID is the id of the interaction for interaction responses.
+	MessageID string
+	// Content is the content of the message for sends and edits, the emoji
+	// for reactions and the content of the response, if any, for interaction
+	// responses.
+	Content string
+	// Components are the components of the message for sends and edits that
+	// set them.
+	Components []discordgo.MessageComponent
+	// Embeds are the embeds of the message for sends and edits that set them.
+	Embeds []*discordgo.MessageEmbed
+	// Files are the files attached by sends and edits.
+	Files []*discordgo.File
+	// AllowedMentions are the mentions allowed to ping by sends that set
+	// them.
+	AllowedMentions *discordgo.MessageAllowedMentions
+	// Response is the initial response to an interaction.
+	Response *discordgo.InteractionResponse
+	Err      error
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%s %s/%s %q", e.Kind, e.ChannelID, e.MessageID, e.Content)
+}
+
+// Client is an in-memory discord.Client that records the timeline of the
+// operations performed on it.
+type Client struct {
+	botUserID string
+
+	mu       sync.Mutex
+	events   []Event
+	messages map[string]*discordgo.Message
+	lastID   int
+	failures map[EventKind][]error
+	// responses holds the id of the message created or updated by the
+	// initial response to an interaction, by interaction id. Responses that
+	// do not create a message, like autocomplete results, map to "".
+	responses map[string]string
+	// members holds the members of the guilds, by guild id.
+	members map[string][]*discordgo.Member
+}
+
+var (
+	_ discord.Client = (*Client)(nil)
+)
+
+// NewClient creates a client for the bot user with the given id.
+func NewClient(botUserID string) *Client {
+	return &Client{
+		botUserID: botUserID,
+		messages:  make(map[string]*discordgo.Message),
+		failures:  make(map[EventKind][]error),
+		responses: make(map[string]string),
+		members:   make(map[string][]*discordgo.Member),
+	}
+}
+
+// SetMembers replaces the members of a guild. Reading them is not an
+// operation recorded in the timeline.
+func (c *Client) SetMembers(guildID string, members ...*discordgo.Member) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sorted := append([]*discordgo.Member(nil), members...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].User.ID < sorted[j].User.ID })
+	c.members[guildID] = sorted
+}
+
+// FailNext makes the next operation of the given kind fail with err.
+func (c *Client) FailNext(kind EventKind, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures[kind] = append(c.failures[kind], err)
+}
+
+// Timeline returns the operations performed so far, in order.
+func (c *Client) Timeline() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Event(nil), c.events...)
+}
+
+// Message returns the current state of a message sent through the client,
+// including the messages created by interaction responses.
+func (c *Client) Message(id string) (*discordgo.Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, ok := c.messages[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *m
+	return &copied, true
+}
+
+// Response returns the current state of the message created by the initial
+// response to an interaction.
+func (c *Client) Response(interactionID string) (*discordgo.Message, bool) {
+	c.mu.Lock()
+	messageID := c.responses[interactionID]
+	c.mu.Unlock()
+
+	return c.Message(messageID)
+}
+
+func (c *Client) UserID() string {
+	return c.botUserID
+}
+
+func (c *Client) SendMessage(channelID, content string) (*discordgo.Message, error) {
+	return c.SendMessageComplex(channelID, &discordgo.MessageSend{Content: content})
+}
+
+func (c *Client) SendMessageComplex(channelID string, data *discordgo.MessageSend) (*discordgo.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	event := Event{Kind: Send, ChannelID: channelID, Content: data.Content, Components: data.Components, Embeds: data.Embeds, Files: data.Files, AllowedMentions: data.AllowedMentions}
+	if err := c.fail(event); err != nil {
+		return nil, err
+	}
+	m := c.newMessage(channelID, data.Content, data.Components)
+	event.MessageID = m.ID
+	c.events = append(c.events, event)
+	copied := *m
+	return &copied, nil
+}
+
+func (c *Client) EditMessage(channelID, messageID, content string) (*discordgo.Message, error) {
+	edit := discordgo.NewMessageEdit(channelID, messageID)
+	edit.SetContent(content)
+	return c.EditMessageComplex(edit)
+}
+
+func (c *Client) EditMessageComplex(edit *discordgo.MessageEdit) (*discordgo.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	event := Event{Kind: Edit, ChannelID: edit.Channel, MessageID: edit.ID, Components: edit.Components, Embeds: edit.Embeds, Files: edit.Files}
+	if edit.Content != nil {
+		event.Content = *edit.Content
+	}
+	if err := c.fail(event); err != nil {
+		return nil, err
+	}
+	m, ok := c.messages[edit.ID]
+	if !ok || m.ChannelID != edit.Channel {
+		event.Err = fmt.Errorf("unknown message %s/%s", edit.Channel, edit.ID)
+		c.events = append(c.events, event)
+		return nil, event.Err
+	}
+	updateMessage(m, edit.Content, edit.Components)
+	c.events = append(c.events, event)
+	copied := *m
+	return &copied, nil
+}
+
+func (c *Client) AddReaction(channelID, messageID, emoji string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	event := Event{Kind: React, ChannelID: channelID, MessageID: messageID, Content: emoji}
+	if err := c.fail(event); err != nil {
+		return err
+	}
+	c.events = append(c.events, event)
+	return nil
+}
+
+func (c *Client) RespondInteraction(i *discordgo.Interaction, resp *discordgo.InteractionResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	event := Event{Kind: Respond, ChannelID: i.ChannelID, MessageID: i.ID, Response: resp}
+	if resp.Data != nil {
+		event.Content = resp.Data.Content
+		event.Components = resp.Data.Components
+		event.Embeds = resp.Data.Embeds
+	}
+	if err := c.fail(event); err != nil {
+		return err
+	}
+	if _, ok := c.responses[i.ID]; ok {
+		event.Err = fmt.Errorf("interaction %s has already been acknowledged", i.ID)
+		c.events = append(c.events, event)
+		return event.Err
+	}
+	switch resp.Type {
+	case discordgo.InteractionResponseChannelMessageWithSource,
+		discordgo.InteractionResponseDeferredChannelMessageWithSource:
+		m := c.newMessage(i.ChannelID, event.Content, event.Components)
+		c.responses[i.ID] = m.ID
+	case discordgo.InteractionResponseUpdateMessage,
+		discordgo.InteractionResponseDeferredMessageUpdate:
+		if i.Message == nil || c.messages[i.Message.ID] == nil {
+			event.Err = fmt.Errorf("interaction %s has no message to update", i.ID)
+			c.events = append(c.events, event)
+			return event.Err
+		}
+		if resp.Type == discordgo.InteractionResponseUpdateMessage && resp.Data != nil {
+			updateMessage(c.messages[i.Message.ID], &resp.Data.Content, resp.Data.Components)
+		}
+		c.responses[i.ID] = i.Message.ID
+	default:
+		c.responses[i.ID] = ""
+	}
+	c.events = append(c.events, event)
+	return nil
+}
+
+func (c *Client) EditInteractionResponse(i *discordgo.Interaction, edit *discordgo.WebhookEdit) (*discordgo.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	event := Event{Kind: EditResponse, ChannelID: i.ChannelID, MessageID: i.ID, Files: edit.Files}
+	if edit.Content != nil {
+		event.Content = *edit.Content
+	}
+	if edit.Components != nil {
+		event.Components = *edit.Components
+	}
+	if edit.Embeds != nil {
+		event.Embeds = *edit.Embeds
+	}
+	if err := c.fail(event); err != nil {
+		return nil, err
+	}
+	m, ok := c.messages[c.responses[i.ID]]
+	if !ok {
+		event.Err = fmt.Errorf("unknown interaction %s", i.ID)
+		c.events = append(c.events, event)
+		return nil, event.Err
+	}
+	updateMessage(m, edit.Content, event.Components)
+	c.events = append(c.events, event)
+	copied := *m
+	return &copied, nil
+}
+
+// newMessage creates a message sent by the bot user. Must be called with mu
+// held.
+func (c *Client) newMessage(channelID, content string, components []discordgo.MessageComponent) *discordgo.Message {
+	c.lastID++
+	m := &discordgo.Message{
+		ID:         fmt.Sprint(c.lastID),
+		ChannelID:  channelID,
+		Content:    content,
+		Components: components,
+		Author:     &discordgo.User{ID: c.botUserID},
+	}
+	c.messages[m.ID] = m
+	return m
+}
+
+// updateMessage replaces the content of a message, if set, and its
+// components, if not nil.
+func updateMessage(m *discordgo.Message, content *string, components []discordgo.MessageComponent) {
+	if content != nil {
+		m.Content = *content
+	}
+	if components != nil {
+		m.Components = components
+	}
+}
+
+func (c *Client) GuildMembers(guildID, after string, limit int) ([]*discordgo.Member, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	members := c.members[guildID]
+	if after != "" {
+		i := sort.Search(len(members), func(i int) bool { return members[i].User.ID > after })
+		members = members[i:]
+	}
+	if len(members) > limit {
+		members = members[:limit]
+	}
+	return append([]*discordgo.Member(nil), members...), nil
+}
+
+// fail records event as failed and returns an error if a failure was queued
+// for its kind. Must be called with mu held.
+func (c *Client) fail(event Event) error {
+	failures := c.failures[event.Kind]
+	if len(failures) == 0 {
+		return nil
+	}
+	event.Err = failures[0]
+	c.failures[event.Kind] = failures[1:]
+	c.events = append(c.events, event)
+	return event.Err
+}
@@ -0,0 +1,150 @@
+package discord
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MessageLimit is the maximum length of the content of a message.
+	MessageLimit = 2000
+
+	codeFence = "```"
+)
+
+var (
+	ansiEscapeRegex = regexp.MustCompile("\x1b\\[[0-9;]*m")
+)
+
+// Split splits content into pages of at most limit bytes, cutting at line
+// breaks when possible. Code blocks cut by a page break are closed at the end
+// of the page and opened again, with the same language, on the next one.
+func Split(content string, limit int) []string {
+	if len(content) <= limit {
+		return []string{content}
+	}
+	s := splitter{limit: limit, empty: true}
+	for _, line := range strings.SplitAfter(content, "\n") {
+		s.add(line)
+	}
+	if !s.empty {
+		s.flush()
+	}
+	return s.pages
+}
+
+// PlainText returns content without code fences and ANSI escape codes, e.g.
+// to attach it as a text file.
+func PlainText(content string) string {
+	lines := strings.Split(content, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), codeFence) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return ansiEscapeRegex.ReplaceAllString(strings.Join(kept, "\n"), "")
+}
+
+type splitter struct {
+	limit int
+	pages []string
+	page  strings.Builder
+	// fence is the opening line of the code block open at the end of the
+	// page, "" if none.
+	fence string
+	// empty is whether the page holds nothing but the reopened code block.
+	empty bool
+}
+
+func (s *splitter) add(line string) {
+	next := nextFence(s.fence, line)
+	if s.fits(line, next) {
+		s.write(line, next)
+		return
+	}
+	if !s.empty {
+		s.flush()
+		if s.fits(line, next) {
+			s.write(line, next)
+			return
+		}
+	}
+	// the line is longer than a page, cut it wherever it fills the page
+	for {
+		room := s.limit - s.page.Len() - len("\n"+codeFence)
+		if room >= len(line) {
+			break
+		}
+		cut := cutIndex(line, room)
+		s.page.WriteString(line[:cut])
+		line = line[cut:]
+		s.flush()
+	}
+	s.write(line, next)
+}
+
+// fits returns whether line fits on the page, leaving room to close the code
+// block open after it.
+func (s *splitter) fits(line, next string) bool {
+	closing := 0
+	if next != "" {
+		closing = len("\n" + codeFence)
+	}
+	return s.page.Len()+len(line)+closing <= s.limit
+}
+
+func (s *splitter) write(line, next string) {
+	s.page.WriteString(line)
+	s.fence = next
+	s.empty = false
+}
+
+// flush ends the page, closing the open code block, and starts a new one
+// that opens it again.
+func (s *splitter) flush() {
+	page := strings.TrimSuffix(s.page.String(), "\n")
+	if s.fence != "" {
+		page += "\n" + codeFence
+	}
+	s.pages = append(s.pages, page)
+	s.page.Reset()
+	if s.fence != "" {
+		s.page.WriteString(s.fence + "\n")
+	}
+	s.empty = true
+}
+
+// nextFence returns the opening line of the code block open after line, given
+// the one open before it.
+func nextFence(fence, line string) string {
+	if strings.Count(line, codeFence)%2 == 0 {
+		return fence
+	}
+	if fence != "" {
+		return ""
+	}
+	// the block opens with the last fence of the line, followed by its
+	// language, if any
+	opening := line[strings.LastIndex(line, codeFence):]
+	return strings.TrimSpace(opening)
+}
+
+// cutIndex returns the largest index of s, up to n, that does not cut a rune,
+// and at least the length of the first rune so that cutting makes progress.
+func cutIndex(s string, n int) int {
+	if n <= 0 {
+		_, size := utf8.DecodeRuneInString(s)
+		return size
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	if n == 0 {
+		_, size := utf8.DecodeRuneInString(s)
+		return size
+	}
+	return n
+}
@@ -0,0 +1,194 @@
+package discord
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitShort(t *testing.T) {
+	pages := Split("hello", 10)
+	if len(pages) != 1 || pages[0] != "hello" {
+		t.Errorf("got %q", pages)
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	pages := Split("one\ntwo\nthree\nfour", 10)
+	want := []string{"one\ntwo", "three\nfour"}
+	if strings.Join(pages, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", pages, want)
+	}
+}
+
+func TestSplitCodeBlock(t *testing.T) {
+	content := "Output:\n```ansi\n" + strings.Repeat("0123456789\n", 6) + "```\ndone"
+	pages := Split(content, 40)
+	if len(pages) < 2 {
+		t.Fatalf("got %q, want several pages", pages)
+	}
+	var joined []string
+	for i, page := range pages {
+		if len(page) > 40 {
+			t.Errorf("page %d is %d bytes long", i, len(page))
+		}
+		if strings.Count(page, "```")%2 != 0 {
+			t.Errorf("page %d leaves a code block open: %q", i, page)
+		}
+		if i > 0 && !strings.HasPrefix(page, "```ansi\n") && page != "done" {
+			t.Errorf("page %d does not reopen the code block: %q", i, page)
+		}
+		joined = append(joined, PlainText(page))
+	}
+	got := strings.Join(strings.Fields(strings.Join(joined, "\n")), " ")
+	want := strings.Join(strings.Fields(PlainText(content)), " ")
+	if got != want {
+		t.Errorf("pages hold %q, want %q", got, want)
+	}
+}
+
+func TestSplitLongLine(t *testing.T) {
+	content := "```\n" + strings.Repeat("é", 30) + "\n```"
+	pages := Split(content, 20)
+	var text string
+	for i, page := range pages {
+		if len(page) > 20 {
+			t.Errorf("page %d is %d bytes long", i, len(page))
+		}
+		text += PlainText(page)
+	}
+	if got := strings.Replace(text, "\n", "", -1); got != strings.Repeat("é", 30) {
+		t.Errorf("pages hold %q", got)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	got := PlainText("```ansi\n\x1b[0;31mred\x1b[0m text\n```")
+	if got != "red text" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestSplitReopensLanguage(t *testing.T) {
+	content := "```ansi\n" + strings.Repeat("line\n", 6) + "```\n```json\n" + strings.Repeat("{}\n", 9) + "```"
+	pages := Split(content, 30)
+	want := []string{
+		"```ansi\nline\nline\nline\n```",
+		"```ansi\nline\nline\nline\n```",
+		"```json\n{}\n{}\n{}\n{}\n{}\n{}\n```",
+		"```json\n{}\n{}\n{}\n```",
+	}
+	if strings.Join(pages, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", pages, want)
+	}
+}
+
+func TestSplitLongLineOutsideCodeBlock(t *testing.T) {
+	line := strings.Repeat("a", 25)
+	pages := Split("short\n"+line+"\nend", 10)
+	want := []string{"short", "aaaaaa", "aaaaaa", "aaaaaa", "aaaaaa", "a\nend"}
+	if strings.Join(pages, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", pages, want)
+	}
+}
+
+func TestSplitMultiByteRunes(t *testing.T) {
+	// 1, 2, 3 and 4 byte runes, so that every cut lands at a different offset
+	// within a rune
+	line := strings.Repeat("aé€😀", 50)
+	for limit := 10; limit < 20; limit++ {
+		pages := Split(line, limit)
+		var text string
+		for i, page := range pages {
+			if len(page) > limit {
+				t.Errorf("limit %d: page %d is %d bytes long", limit, i, len(page))
+			}
+			if !utf8.ValidString(page) {
+				t.Errorf("limit %d: page %d cuts a rune: %q", limit, i, page)
+			}
+			text += page
+		}
+		if text != line {
+			t.Errorf("limit %d: pages hold %q", limit, text)
+		}
+	}
+}
+
+func TestSplitMessageLimit(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("Output:\n```ansi\n")
+	for i := 0; i < 400; i++ {
+		b.WriteString(strings.Repeat("\x1b[0;32mé", i%40))
+		b.WriteString("\n")
+		if i%97 == 0 {
+			// a line longer than a whole message
+			b.WriteString(strings.Repeat("x", 2*MessageLimit) + "\n")
+		}
+	}
+	b.WriteString("```\nSome text after the block.")
+	content := b.String()
+
+	pages := Split(content, MessageLimit)
+	if len(pages) < 2 {
+		t.Fatalf("got %d pages, want several", len(pages))
+	}
+	var joined []string
+	for i, page := range pages {
+		if len(page) > MessageLimit {
+			t.Errorf("page %d is %d bytes long", i, len(page))
+		}
+		if !utf8.ValidString(page) {
+			t.Errorf("page %d is not valid UTF-8", i)
+		}
+		if strings.Count(page, "```")%2 != 0 {
+			t.Errorf("page %d leaves a code block open", i)
+		}
+		joined = append(joined, PlainText(page))
+	}
+	got := strings.Join(strings.Fields(strings.Join(joined, "")), "")
+	want := strings.Join(strings.Fields(PlainText(content)), "")
+	if got != want {
+		t.Error("pages don't hold the whole content")
+	}
+}
+
+func TestNextFence(t *testing.T) {
+	tests := []struct {
+		fence, line, want string
+	}{
+		{"", "text\n", ""},
+		{"", "```\n", "```"},
+		{"", "```ansi\n", "```ansi"},
+		{"", "before ```go\n", "```go"},
+		{"```ansi", "text\n", "```ansi"},
+		{"```ansi", "```\n", ""},
+		{"", "```inline``` text\n", ""},
+		{"```ansi", "``` ``` ```json\n", ""},
+	}
+	for _, test := range tests {
+		if got := nextFence(test.fence, test.line); got != test.want {
+			t.Errorf("nextFence(%q, %q) = %q, want %q", test.fence, test.line, got, test.want)
+		}
+	}
+}
+
+func TestCutIndex(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want int
+	}{
+		{"abcdef", 3, 3},
+		{"aé", 2, 1},
+		{"a€", 3, 1},
+		{"😀a", 2, 4},
+		{"😀a", 0, 4},
+		{"😀a", 4, 4},
+		{"é", -1, 2},
+	}
+	for _, test := range tests {
+		if got := cutIndex(test.s, test.n); got != test.want {
+			t.Errorf("cutIndex(%q, %d) = %d, want %d", test.s, test.n, got, test.want)
+		}
+	}
+}
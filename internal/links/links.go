@@ -0,0 +1,205 @@
+// Package links stores which Minecraft account belongs to which Discord user,
+// in a durable local store.
+//
+// Links are one to one: a Discord user has at most one Minecraft account and
+// a Minecraft account belongs to at most one Discord user. Minecraft names
+// are matched case-insensitively, like the game does.
+package links
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	ErrNotFound = errors.New("link not found")
+)
+
+var (
+	// usersBucket holds the links by Discord user id.
+	usersBucket = []byte("users")
+	// playersBucket holds the Discord user ids by lowercase Minecraft name.
+	playersBucket = []byte("players")
+)
+
+// Link is a Minecraft account linked to a Discord user.
+type Link struct {
+	UserID string `json:"user_id"`
+	Player string `json:"player"`
+	// Server is the server the account was verified on.
+	Server string `json:"server,omitempty"`
+	// Unverified is set for accounts the user only gave the name of,
+	// without proving it is theirs in the game.
+	Unverified bool `json:"unverified,omitempty"`
+	// Whitelisted are the servers the whitelist sync added the account to.
+	// The sync only removes accounts from these, never from whitelists they
+	// were added to by hand.
+	Whitelisted []string  `json:"whitelisted,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// Store is a link store backed by a bbolt database.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens (or creates) the link store stored at path.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open link store: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(usersBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(playersBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open link store: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the store.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put stores a link, replacing the links of its user and of its player.
+func (s *Store) Put(l *Link) error {
+	if l.Time.IsZero() {
+		l.Time = time.Now()
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := deleteUser(tx, l.UserID); err != nil {
+			return err
+		}
+		players := tx.Bucket(playersBucket)
+		if userID := players.Get(playerKey(l.Player)); userID != nil {
+			if err := deleteUser(tx, string(userID)); err != nil {
+				return err
+			}
+		}
+		if err := tx.Bucket(usersBucket).Put([]byte(l.UserID), data); err != nil {
+			return err
+		}
+		return players.Put(playerKey(l.Player), []byte(l.UserID))
+	})
+}
+
+// ByUser returns the link of a Discord user, or ErrNotFound.
+func (s *Store) ByUser(userID string) (Link, error) {
+	var l Link
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		l, err = getUser(tx, userID)
+		return err
+	})
+	return l, err
+}
+
+// ByPlayer returns the link of a Minecraft account, or ErrNotFound.
+func (s *Store) ByPlayer(player string) (Link, error) {
+	var l Link
+	err := s.db.View(func(tx *bolt.Tx) error {
+		userID := tx.Bucket(playersBucket).Get(playerKey(player))
+		if userID == nil {
+			return ErrNotFound
+		}
+		var err error
+		l, err = getUser(tx, string(userID))
+		return err
+	})
+	return l, err
+}
+
+// SetWhitelisted replaces the servers the account of a Discord user was
+// whitelisted on by the whitelist sync. It returns ErrNotFound if the user is
+// no longer linked to player.
+func (s *Store) SetWhitelisted(userID, player string, servers []string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		l, err := getUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(l.Player, player) {
+			return ErrNotFound
+		}
+		l.Whitelisted = servers
+		data, err := json.Marshal(l)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(usersBucket).Put([]byte(userID), data)
+	})
+}
+
+// Delete removes the link of a Discord user and returns it, or ErrNotFound.
+func (s *Store) Delete(userID string) (Link, error) {
+	var l Link
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		if l, err = getUser(tx, userID); err != nil {
+			return err
+		}
+		return deleteUser(tx, userID)
+	})
+	return l, err
+}
+
+// List returns every link, ordered by Discord user id.
+func (s *Store) List() ([]Link, error) {
+	links := make([]Link, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(usersBucket).ForEach(func(k, v []byte) error {
+			var l Link
+			if err := json.Unmarshal(v, &l); err != nil {
+				return err
+			}
+			links = append(links, l)
+			return nil
+		})
+	})
+	return links, err
+}
+
+func getUser(tx *bolt.Tx, userID string) (Link, error) {
+	var l Link
+	data := tx.Bucket(usersBucket).Get([]byte(userID))
+	if data == nil {
+		return l, ErrNotFound
+	}
+	err := json.Unmarshal(data, &l)
+	return l, err
+}
+
+// deleteUser removes the link of a Discord user, if any.
+func deleteUser(tx *bolt.Tx, userID string) error {
+	l, err := getUser(tx, userID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(playersBucket).Delete(playerKey(l.Player)); err != nil {
+		return err
+	}
+	return tx.Bucket(usersBucket).Delete([]byte(userID))
+}
+
+func playerKey(player string) []byte {
+	return []byte(strings.ToLower(player))
+}
@@ -0,0 +1,171 @@
+package links
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	store, err := Open(filepath.Join(t.TempDir(), "links.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func put(t *testing.T, store *Store, userID, player string) {
+	t.Helper()
+
+	if err := store.Put(&Link{UserID: userID, Player: player}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertLinks checks that the store holds exactly the given links, as
+// user id and player pairs, and that they can be found both ways.
+func assertLinks(t *testing.T, store *Store, want ...[2]string) {
+	t.Helper()
+
+	all, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(want) {
+		t.Fatalf("got links %+v, want %q", all, want)
+	}
+	for i, w := range want {
+		if all[i].UserID != w[0] || all[i].Player != w[1] {
+			t.Errorf("link %d: got %+v, want %q", i, all[i], w)
+		}
+		if l, err := store.ByUser(w[0]); err != nil || l.Player != w[1] {
+			t.Errorf("by user %s: got %+v (%v), want %s", w[0], l, err, w[1])
+		}
+		if l, err := store.ByPlayer(w[1]); err != nil || l.UserID != w[0] {
+			t.Errorf("by player %s: got %+v (%v), want %s", w[1], l, err, w[0])
+		}
+	}
+}
+
+func TestPut(t *testing.T) {
+	store := newTestStore(t)
+
+	put(t, store, "1", "Steve")
+	put(t, store, "2", "Alex")
+	assertLinks(t, store, [2]string{"1", "Steve"}, [2]string{"2", "Alex"})
+
+	l, err := store.ByUser("1")
+	if err != nil || l.Time.IsZero() {
+		t.Errorf("got %+v (%v), want the link time set", l, err)
+	}
+}
+
+func TestPutReplacesUserLink(t *testing.T) {
+	store := newTestStore(t)
+
+	put(t, store, "1", "Steve")
+	put(t, store, "1", "Notch")
+
+	assertLinks(t, store, [2]string{"1", "Notch"})
+	if _, err := store.ByPlayer("Steve"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want the old player unlinked", err)
+	}
+}
+
+func TestPutReplacesPlayerLink(t *testing.T) {
+	store := newTestStore(t)
+
+	put(t, store, "1", "Steve")
+	put(t, store, "2", "Alex")
+	// the player of user 2 goes to user 1, who loses theirs
+	put(t, store, "1", "ALEX")
+
+	assertLinks(t, store, [2]string{"1", "ALEX"})
+	if _, err := store.ByUser("2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want the old user unlinked", err)
+	}
+	if _, err := store.ByPlayer("steve"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want the old player unlinked", err)
+	}
+}
+
+func TestByPlayerCaseInsensitive(t *testing.T) {
+	store := newTestStore(t)
+
+	put(t, store, "1", "Steve")
+
+	for _, player := range []string{"Steve", "steve", "STEVE", "sTeVe"} {
+		l, err := store.ByPlayer(player)
+		if err != nil || l.UserID != "1" || l.Player != "Steve" {
+			t.Errorf("%s: got %+v (%v), want the link of Steve", player, l, err)
+		}
+	}
+	if _, err := store.ByPlayer("Steve2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	store := newTestStore(t)
+
+	put(t, store, "1", "Steve")
+	put(t, store, "2", "Alex")
+
+	l, err := store.Delete("1")
+	if err != nil || l.Player != "Steve" {
+		t.Errorf("got %+v (%v), want the deleted link", l, err)
+	}
+	assertLinks(t, store, [2]string{"2", "Alex"})
+	if _, err := store.ByPlayer("steve"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want %v", err, ErrNotFound)
+	}
+	if _, err := store.Delete("1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want %v", err, ErrNotFound)
+	}
+	if _, err := store.Delete("3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.db")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(&Link{UserID: "1", Player: "Steve", Unverified: true}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if l, err := store.ByPlayer("steve"); err != nil || l.UserID != "1" || !l.Unverified {
+		t.Errorf("got %+v (%v), want the link kept", l, err)
+	}
+}
+
+func TestSetWhitelisted(t *testing.T) {
+	store := newTestStore(t)
+
+	put(t, store, "1", "Steve")
+	if err := store.SetWhitelisted("1", "steve", []string{"survival"}); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := store.ByPlayer("Steve"); err != nil || len(l.Whitelisted) != 1 || l.Whitelisted[0] != "survival" {
+		t.Errorf("got %+v (%v), want the server recorded", l, err)
+	}
+	// the user changed accounts in the meantime
+	if err := store.SetWhitelisted("1", "Alex", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want %v", err, ErrNotFound)
+	}
+	if err := store.SetWhitelisted("2", "Alex", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,223 @@
+// Package mcformat converts the § formatting codes found in Minecraft output
+// into something Discord can display.
+//
+// Colours are rendered with the ANSI escape codes Discord supports in ansi
+// code blocks, which only know 8 colours, so the 16 Minecraft colours are
+// mapped to their closest match. Bold and underline are kept, italic,
+// strikethrough and obfuscated text are rendered as plain text.
+package mcformat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Mode is how formatting codes are rendered.
+type Mode string
+
+const (
+	// ModeANSI renders formatted output in an ansi code block.
+	ModeANSI Mode = "ansi"
+	// ModeStrip removes formatting codes.
+	ModeStrip Mode = "strip"
+	// ModeRaw leaves the output untouched.
+	ModeRaw Mode = "raw"
+)
+
+const (
+	codePrefix = '§'
+	// hexPrefix starts a hex colour, written by Paper and Spigot as
+	// §x§r§r§g§g§b§b.
+	hexPrefix = 'x'
+)
+
+// Discord ansi foreground colours.
+const (
+	ansiGray   = 30
+	ansiRed    = 31
+	ansiGreen  = 32
+	ansiYellow = 33
+	ansiBlue   = 34
+	ansiPink   = 35
+	ansiCyan   = 36
+	ansiWhite  = 37
+)
+
+var (
+	colors = map[rune]int{
+		'0': ansiGray,   // black
+		'1': ansiBlue,   // dark blue
+		'2': ansiGreen,  // dark green
+		'3': ansiCyan,   // dark aqua
+		'4': ansiRed,    // dark red
+		'5': ansiPink,   // dark purple
+		'6': ansiYellow, // gold
+		'7': ansiWhite,  // gray
+		'8': ansiGray,   // dark gray
+		'9': ansiBlue,   // blue
+		'a': ansiGreen,  // green
+		'b': ansiCyan,   // aqua
+		'c': ansiRed,    // red
+		'd': ansiPink,   // light purple
+		'e': ansiYellow, // yellow
+		'f': ansiWhite,  // white
+	}
+	formats = map[rune]int{
+		'l': 1, // bold
+		'n': 4, // underline
+		'k': 0, // obfuscated
+		'm': 0, // strikethrough
+		'o': 0, // italic
+	}
+
+	// palette holds the colours Discord uses for the ansi foreground codes,
+	// to find the closest match of hex colours.
+	palette = []struct {
+		code    int
+		r, g, b int
+	}{
+		{ansiGray, 0x4f, 0x54, 0x5c},
+		{ansiRed, 0xdc, 0x32, 0x2f},
+		{ansiGreen, 0x85, 0x99, 0x00},
+		{ansiYellow, 0xb5, 0x89, 0x00},
+		{ansiBlue, 0x26, 0x8b, 0xd2},
+		{ansiPink, 0xd3, 0x36, 0x82},
+		{ansiCyan, 0x2a, 0xa1, 0x98},
+		{ansiWhite, 0xff, 0xff, 0xff},
+	}
+)
+
+// ParseMode parses the name of a mode.
+func ParseMode(s string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(s)); mode {
+	case ModeANSI, ModeStrip, ModeRaw:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown output format %q", s)
+}
+
+// HasCodes returns whether s contains formatting codes.
+func HasCodes(s string) bool {
+	return strings.ContainsRune(s, codePrefix)
+}
+
+// Format renders the formatting codes of s. In ansi mode, output with
+// formatting codes is wrapped in an ansi code block, output without any is
+// left as is. Unknown modes strip the codes.
+func Format(s string, mode Mode) string {
+	switch {
+	case mode == ModeRaw || !HasCodes(s):
+		return s
+	case mode == ModeANSI:
+		return "```ansi\n" + ToANSI(s) + "\n```"
+	default:
+		return Strip(s)
+	}
+}
+
+// Strip removes the formatting codes of s.
+func Strip(s string) string {
+	if !HasCodes(s) {
+		return s
+	}
+	var b strings.Builder
+	walk(s, func(text string) { b.WriteString(text) }, func(rune) {}, func(string) {})
+	return b.String()
+}
+
+// ToANSI replaces the formatting codes of s with ANSI escape codes.
+func ToANSI(s string) string {
+	var b strings.Builder
+	styled := false
+	walk(s,
+		func(text string) { b.WriteString(text) },
+		func(code rune) {
+			if color, ok := colors[code]; ok {
+				// colours reset the formatting in Minecraft
+				fmt.Fprintf(&b, "\x1b[0;%dm", color)
+				styled = true
+			} else if format := formats[code]; format != 0 {
+				fmt.Fprintf(&b, "\x1b[%dm", format)
+				styled = true
+			} else if code == 'r' && styled {
+				b.WriteString("\x1b[0m")
+				styled = false
+			}
+		},
+		func(hex string) {
+			fmt.Fprintf(&b, "\x1b[0;%dm", closestColor(hex))
+			styled = true
+		})
+	if styled {
+		b.WriteString("\x1b[0m")
+	}
+	return b.String()
+}
+
+// walk splits s into text, formatting codes and hex colours. Unknown and
+// incomplete codes are dropped.
+func walk(s string, text func(string), code func(rune), hex func(string)) {
+	runes := []rune(s)
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != codePrefix {
+			continue
+		}
+		if i > start {
+			text(string(runes[start:i]))
+		}
+		if i+1 >= len(runes) {
+			start = len(runes)
+			break
+		}
+		c := []rune(strings.ToLower(string(runes[i+1])))[0]
+		if c == hexPrefix {
+			if digits, ok := hexDigits(runes[i+2:]); ok {
+				hex(digits)
+				i += 1 + 12
+				start = i + 1
+				continue
+			}
+		}
+		_, isColor := colors[c]
+		_, isFormat := formats[c]
+		if isColor || isFormat || c == 'r' {
+			code(c)
+		}
+		i++
+		start = i + 1
+	}
+	if start < len(runes) {
+		text(string(runes[start:]))
+	}
+}
+
+// hexDigits returns the 6 digits of a hex colour written as §r§r§g§g§b§b.
+func hexDigits(runes []rune) (string, bool) {
+	if len(runes) < 12 {
+		return "", false
+	}
+	digits := make([]rune, 0, 6)
+	for i := 0; i < 12; i += 2 {
+		if runes[i] != codePrefix || !strings.ContainsRune("0123456789abcdefABCDEF", runes[i+1]) {
+			return "", false
+		}
+		digits = append(digits, runes[i+1])
+	}
+	return string(digits), true
+}
+
+// closestColor returns the ansi colour closest to a hex colour.
+func closestColor(hex string) int {
+	rgb, _ := strconv.ParseUint(hex, 16, 32)
+	r, g, b := int(rgb>>16&0xff), int(rgb>>8&0xff), int(rgb&0xff)
+	best, bestDistance := ansiWhite, -1
+	for _, c := range palette {
+		distance := (r-c.r)*(r-c.r) + (g-c.g)*(g-c.g) + (b-c.b)*(b-c.b)
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = c.code, distance
+		}
+	}
+	return best
+}
@@ -0,0 +1,49 @@
+package mcformat
+
+import (
+	"testing"
+)
+
+func TestStrip(t *testing.T) {
+	for in, want := range map[string]string{
+		"no codes":                         "no codes",
+		"§6Gold §lbold§r plain":            "Gold bold plain",
+		"§x§f§f§0§0§0§0hex red":            "hex red",
+		"unknown §zcode and trailing §":    "unknown code and trailing ",
+		"§aThere are §c1§a players online": "There are 1 players online",
+	} {
+		if got := Strip(in); got != want {
+			t.Errorf("Strip(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestToANSI(t *testing.T) {
+	for in, want := range map[string]string{
+		"plain":                 "plain",
+		"§cred":                 "\x1b[0;31mred\x1b[0m",
+		"§lbold§r plain":        "\x1b[1mbold\x1b[0m plain",
+		"§oitalic":              "italic",
+		"§x§f§f§5§5§5§5hex red": "\x1b[0;31mhex red\x1b[0m",
+		"§6gold §lbold":         "\x1b[0;33mgold \x1b[1mbold\x1b[0m",
+	} {
+		if got := ToANSI(in); got != want {
+			t.Errorf("ToANSI(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	if got := Format("plain", ModeANSI); got != "plain" {
+		t.Errorf("output without codes wrapped as %q", got)
+	}
+	if got, want := Format("§cred", ModeANSI), "```ansi\n\x1b[0;31mred\x1b[0m\n```"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := Format("§cred", ModeStrip); got != "red" {
+		t.Errorf("got %q, want %q", got, "red")
+	}
+	if got := Format("§cred", ModeRaw); got != "§cred" {
+		t.Errorf("got %q, want %q", got, "§cred")
+	}
+}
@@ -0,0 +1,237 @@
+// Package mclog parses the log of a Minecraft server into events, like players
+// joining, chatting or dying, and follows the log as the server writes it.
+//
+// Both the vanilla layout, "[12:34:56] [Server thread/INFO]: message", and the
+// Paper layout, "[12:34:56 INFO]: message", are understood.
+package mclog
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Levels of log lines.
+const (
+	LevelInfo  = "INFO"
+	LevelWarn  = "WARN"
+	LevelError = "ERROR"
+	LevelFatal = "FATAL"
+)
+
+// Line is a line of the log.
+type Line struct {
+	// Time is the time of the line. The log only has the time of day, the
+	// date is the one of the day the line was read on.
+	Time time.Time
+	// Thread is the thread that wrote the line, e.g. "Server thread", empty
+	// in the Paper layout.
+	Thread string
+	Level  string
+	Text   string
+}
+
+// Log returns the line of an event.
+func (l Line) Log() Line {
+	return l
+}
+
+// Event is an event parsed from a line of the log: a Join, Leave, Chat,
+// Death, Advancement, Started, Stopping, Crash or Warning.
+type Event interface {
+	Log() Line
+}
+
+// Join is a player joining the game.
+type Join struct {
+	Line
+	Player string
+}
+
+// Leave is a player leaving the game.
+type Leave struct {
+	Line
+	Player string
+}
+
+// Chat is a chat message sent by a player.
+type Chat struct {
+	Line
+	Player  string
+	Message string
+}
+
+// Death is a player dying.
+type Death struct {
+	Line
+	Player string
+	// Message is the whole death message, e.g. "Steve was slain by Zombie".
+	Message string
+}
+
+// Kinds of advancements.
+const (
+	KindAdvancement = "advancement"
+	KindChallenge   = "challenge"
+	KindGoal        = "goal"
+)
+
+// Advancement is a player making an advancement.
+type Advancement struct {
+	Line
+	Player string
+	// Kind is KindAdvancement, KindChallenge or KindGoal.
+	Kind  string
+	Title string
+}
+
+// Started is the server being done starting.
+type Started struct {
+	Line
+	// Took is how long the server took to start.
+	Took time.Duration
+}
+
+// Stopping is the server starting to stop.
+type Stopping struct {
+	Line
+}
+
+// Crash is the server crashing or freezing.
+type Crash struct {
+	Line
+	// Report is the path of the crash report, if one was saved.
+	Report string
+}
+
+// Warning is a line logged as a warning or an error, which is not an event of
+// its own.
+type Warning struct {
+	Line
+}
+
+var (
+	vanillaLineRegexp = regexp.MustCompile(`^\[(\d{2}:\d{2}:\d{2})\] \[([^\]/]+)/([A-Z]+)\](?: \[[^\]]*\])?: (.*)$`)
+	paperLineRegexp   = regexp.MustCompile(`^\[(\d{2}:\d{2}:\d{2}) ([A-Z]+)\]: (.*)$`)
+
+	// Bedrock players joining through Floodgate have a "." prefix.
+	playerPattern = `([.]?\w{1,16})`
+
+	joinRegexp        = regexp.MustCompile(`^` + playerPattern + ` (?:\(formerly known as \w+\) )?joined the game$`)
+	leaveRegexp       = regexp.MustCompile(`^` + playerPattern + ` left the game$`)
+	chatRegexp        = regexp.MustCompile(`^(?:\[Not Secure\] )?<` + playerPattern + `> (.*)$`)
+	advancementRegexp = regexp.MustCompile(`^` + playerPattern + ` has (made the advancement|completed the challenge|reached the goal) \[(.+)\]$`)
+	startedRegexp     = regexp.MustCompile(`^Done \((\d+(?:\.\d+)?)s\)! For help, type "help"`)
+	stoppingRegexp    = regexp.MustCompile(`^Stopping (?:the )?server$`)
+	crashRegexp       = regexp.MustCompile(`^This crash report has been saved to: (.+)$`)
+	deathRegexp       = regexp.MustCompile(`^` + playerPattern + ` (?:` + strings.Join(deathPhrases, "|") + `)(?: |$)`)
+
+	// deathPhrases are the beginnings of the vanilla death messages, after
+	// the name of the player.
+	deathPhrases = []string{
+		"was slain by", "was shot by", "was fireballed by", "was pummeled by",
+		"was killed", "was blown up by", "blew up", "was squashed by",
+		"was squished", "was struck by lightning", "was pricked to death",
+		"was poked to death", "was stung to death", "was impaled",
+		"was skewered", "was speared", "was obliterated", "was roasted",
+		"was frozen to death", "was doomed to fall", "was burnt to a crisp",
+		"was smashed by", "was stomped by", "burned to death",
+		"went up in flames", "went off with a bang", "walked into",
+		"tried to swim in lava", "discovered the floor was lava", "drowned",
+		"died", "starved to death", "suffocated in a wall",
+		"experienced kinetic energy", "hit the ground too hard", "fell",
+		"left the confines of this world", "withered away", "froze to death",
+		"didn't want to live",
+	}
+)
+
+// ParseLine parses a line of the log, read at now.
+func ParseLine(text string, now time.Time) (Line, bool) {
+	text = strings.TrimRight(text, "\r\n")
+	var clock string
+	var line Line
+	if m := vanillaLineRegexp.FindStringSubmatch(text); m != nil {
+		clock, line.Thread, line.Level, line.Text = m[1], m[2], m[3], m[4]
+	} else if m := paperLineRegexp.FindStringSubmatch(text); m != nil {
+		clock, line.Level, line.Text = m[1], m[2], m[3]
+	} else {
+		return Line{}, false
+	}
+	t, err := time.ParseInLocation("15:04:05", clock, now.Location())
+	if err != nil {
+		return Line{}, false
+	}
+	year, month, day := now.Date()
+	line.Time = time.Date(year, month, day, t.Hour(), t.Minute(), t.Second(), 0, now.Location())
+	// a line from just before midnight read just after it
+	if line.Time.After(now.Add(time.Hour)) {
+		line.Time = line.Time.AddDate(0, 0, -1)
+	}
+	return line, true
+}
+
+// Parse parses a line of the log, read at now, into an event. It returns false
+// if the line is not a line of the log or not an event.
+func Parse(text string, now time.Time) (Event, bool) {
+	line, ok := ParseLine(text, now)
+	if !ok {
+		return nil, false
+	}
+	return ParseEvent(line)
+}
+
+// ParseEvent parses a line of the log into an event. It returns false if the
+// line is not an event.
+func ParseEvent(line Line) (Event, bool) {
+	if line.Level != LevelInfo {
+		if m := crashRegexp.FindStringSubmatch(line.Text); m != nil {
+			return Crash{Line: line, Report: m[1]}, true
+		}
+		// the watchdogs of vanilla and Paper
+		if strings.HasPrefix(line.Text, "A single server tick took") ||
+			strings.HasPrefix(line.Text, "The server has stopped responding!") {
+			return Crash{Line: line}, true
+		}
+		if line.Level == LevelWarn || line.Level == LevelError || line.Level == LevelFatal {
+			return Warning{Line: line}, true
+		}
+		return nil, false
+	}
+
+	text := line.Text
+	if m := chatRegexp.FindStringSubmatch(text); m != nil {
+		return Chat{Line: line, Player: m[1], Message: m[2]}, true
+	}
+	if m := joinRegexp.FindStringSubmatch(text); m != nil {
+		return Join{Line: line, Player: m[1]}, true
+	}
+	if m := leaveRegexp.FindStringSubmatch(text); m != nil {
+		return Leave{Line: line, Player: m[1]}, true
+	}
+	if m := advancementRegexp.FindStringSubmatch(text); m != nil {
+		kind := KindAdvancement
+		switch m[2] {
+		case "completed the challenge":
+			kind = KindChallenge
+		case "reached the goal":
+			kind = KindGoal
+		}
+		return Advancement{Line: line, Player: m[1], Kind: kind, Title: m[3]}, true
+	}
+	if m := startedRegexp.FindStringSubmatch(text); m != nil {
+		seconds, _ := strconv.ParseFloat(m[1], 64)
+		return Started{Line: line, Took: time.Duration(seconds * float64(time.Second))}, true
+	}
+	if stoppingRegexp.MatchString(text) {
+		return Stopping{Line: line}, true
+	}
+	// only the server thread logs deaths, this keeps the lines of other
+	// threads from passing for them
+	if line.Thread == "" || line.Thread == "Server thread" {
+		if m := deathRegexp.FindStringSubmatch(text); m != nil {
+			return Death{Line: line, Player: m[1], Message: text}, true
+		}
+	}
+	return nil, false
+}
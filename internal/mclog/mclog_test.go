@@ -0,0 +1,178 @@
+package mclog
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var testNow = time.Date(2026, 10, 18, 18, 0, 0, 0, time.UTC)
+
+// line returns a line of testNow's day.
+func line(clock, thread, level, text string) Line {
+	t, _ := time.Parse("15:04:05", clock)
+	return Line{
+		Time:   time.Date(2026, 10, 18, t.Hour(), t.Minute(), t.Second(), 0, time.UTC),
+		Thread: thread,
+		Level:  level,
+		Text:   text,
+	}
+}
+
+// parseFixture returns the events of the lines of a file in testdata.
+func parseFixture(t *testing.T, name string) []Event {
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if event, ok := Parse(scanner.Text(), testNow); ok {
+			events = append(events, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func compareEvents(t *testing.T, got, want []Event) {
+	t.Helper()
+	for i := 0; i < len(got) || i < len(want); i++ {
+		switch {
+		case i >= len(got):
+			t.Errorf("missing event %#v", want[i])
+		case i >= len(want):
+			t.Errorf("unexpected event %#v", got[i])
+		case !reflect.DeepEqual(got[i], want[i]):
+			t.Errorf("event %d: got %#v, want %#v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseVanilla(t *testing.T) {
+	const server = "Server thread"
+	want := []Event{
+		Warning{line("12:00:03", server, LevelWarn, "Failed to load properties from file: server.properties")},
+		Started{line("12:00:09", server, LevelInfo, `Done (5.892s)! For help, type "help"`), 5892 * time.Millisecond},
+		Join{line("12:01:15", server, LevelInfo, "Steve joined the game"), "Steve"},
+		Join{line("12:01:20", server, LevelInfo, "Alex (formerly known as alex_old) joined the game"), "Alex"},
+		Chat{line("12:01:42", server, LevelInfo, "<Steve> hello there"), "Steve", "hello there"},
+		Chat{line("12:01:50", server, LevelInfo, "[Not Secure] <Alex> hi <3"), "Alex", "hi <3"},
+		Advancement{line("12:02:10", server, LevelInfo, "Steve has made the advancement [Stone Age]"), "Steve", KindAdvancement, "Stone Age"},
+		Advancement{line("12:02:30", server, LevelInfo, "Alex has completed the challenge [Monsters Hunted]"), "Alex", KindChallenge, "Monsters Hunted"},
+		Advancement{line("12:02:31", server, LevelInfo, "Alex has reached the goal [The End?]"), "Alex", KindGoal, "The End?"},
+		Death{line("12:03:00", server, LevelInfo, "Steve was slain by Zombie"), "Steve", "Steve was slain by Zombie"},
+		Death{line("12:03:05", server, LevelInfo, "Alex fell from a high place"), "Alex", "Alex fell from a high place"},
+		Death{line("12:03:06", server, LevelInfo, "Steve drowned"), "Steve", "Steve drowned"},
+		Warning{line("12:03:30", server, LevelWarn, "Can't keep up! Is the server overloaded? Running 2034ms or 40 ticks behind")},
+		Leave{line("12:04:00", server, LevelInfo, "Steve left the game"), "Steve"},
+		Stopping{line("12:05:00", server, LevelInfo, "Stopping the server")},
+		Stopping{line("12:05:00", server, LevelInfo, "Stopping server")},
+	}
+	compareEvents(t, parseFixture(t, "vanilla.log"), want)
+}
+
+func TestParsePaper(t *testing.T) {
+	want := []Event{
+		Warning{line("13:00:06", "", LevelWarn, "[EssentialsX] Version mismatch! Please update all Essentials jars to the same version.")},
+		Started{line("13:00:09", "", LevelInfo, `Done (7.01s)! For help, type "help"`), 7010 * time.Millisecond},
+		Join{line("13:01:00", "", LevelInfo, ".Steve joined the game"), ".Steve"},
+		Chat{line("13:01:05", "", LevelInfo, "<.Steve> gg"), ".Steve", "gg"},
+		Death{line("13:01:10", "", LevelInfo, ".Steve was shot by Skeleton"), ".Steve", ".Steve was shot by Skeleton"},
+		Death{line("13:01:11", "", LevelInfo, ".Steve hit the ground too hard whilst trying to escape Creeper"), ".Steve",
+			".Steve hit the ground too hard whilst trying to escape Creeper"},
+		Advancement{line("13:01:12", "", LevelInfo, ".Steve has made the advancement [Getting an Upgrade]"), ".Steve", KindAdvancement, "Getting an Upgrade"},
+		Leave{line("13:02:00", "", LevelInfo, ".Steve left the game"), ".Steve"},
+		Warning{line("13:03:00", "", LevelError, "Could not pass event PlayerJoinEvent to SomePlugin v1.0")},
+		Warning{line("13:04:00", "", LevelError, "--- DO NOT REPORT THIS TO PAPER - THIS IS NOT A BUG OR A CRASH  - git-Paper-196 ---")},
+		Crash{line("13:04:01", "", LevelError, "The server has stopped responding! This is (probably) not a Paper bug."), ""},
+		Crash{line("13:05:00", "", LevelError, "This crash report has been saved to: /srv/minecraft/crash-reports/crash-2026-10-18_13.05.00-server.txt"),
+			"/srv/minecraft/crash-reports/crash-2026-10-18_13.05.00-server.txt"},
+		Stopping{line("13:05:01", "", LevelInfo, "Stopping server")},
+	}
+	compareEvents(t, parseFixture(t, "paper.log"), want)
+}
+
+func TestParseLineMidnight(t *testing.T) {
+	now := time.Date(2026, 10, 18, 0, 0, 2, 0, time.UTC)
+	got, ok := ParseLine("[23:59:59] [Server thread/INFO]: Steve joined the game", now)
+	if !ok {
+		t.Fatal("line not parsed")
+	}
+	if want := time.Date(2026, 10, 17, 23, 59, 59, 0, time.UTC); !got.Time.Equal(want) {
+		t.Errorf("got time %v, want %v", got.Time, want)
+	}
+}
+
+// nextEvent waits for the next event published on events.
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+		return nil
+	}
+}
+
+func appendLog(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(strings.Join(lines, "")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latest.log")
+	appendLog(t, path, "[12:00:00] [Server thread/INFO]: Alex joined the game\n")
+	tailer := NewTailer(path, 5*time.Millisecond, zap.NewNop())
+	defer tailer.Close()
+	events := tailer.Subscribe()
+	time.Sleep(20 * time.Millisecond)
+
+	// lines already in the log are skipped, and partial lines held back
+	appendLog(t, path, "[12:00:01] [Server thread/INFO]: Steve joined", "")
+	time.Sleep(20 * time.Millisecond)
+	appendLog(t, path, " the game\n", "[12:00:02] [Server thread/INFO]: Steve drowned\n")
+	if event, ok := nextEvent(t, events).(Join); !ok || event.Player != "Steve" {
+		t.Errorf("got %#v, want Steve joining", event)
+	}
+	if _, ok := nextEvent(t, events).(Death); !ok {
+		t.Error("want Steve dying")
+	}
+
+	// the server compresses the log and starts a new one
+	appendLog(t, path, "[12:00:03] [Server thread/INFO]: Stopping server\n")
+	if err := os.Rename(path, filepath.Join(filepath.Dir(path), "2026-10-18-1.log.gz")); err != nil {
+		t.Fatal(err)
+	}
+	appendLog(t, path, "[12:01:00] [Server thread/INFO]: Alex left the game\n")
+	if _, ok := nextEvent(t, events).(Stopping); !ok {
+		t.Error("want the server stopping")
+	}
+	if event, ok := nextEvent(t, events).(Leave); !ok || event.Player != "Alex" {
+		t.Errorf("got %#v, want Alex leaving", event)
+	}
+
+	tailer.Close()
+	if _, ok := <-events; ok {
+		t.Error("events not closed")
+	}
+}
@@ -0,0 +1,226 @@
+package mclog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// DefaultPollInterval is how often the log is checked for new lines by
+	// tailers created with a zero interval.
+	DefaultPollInterval = time.Second
+	// SubscriptionBuffer is the number of events buffered for every
+	// subscriber. Events are dropped for subscribers that fall further
+	// behind, so that they can't hold up the others.
+	SubscriptionBuffer = 64
+)
+
+// Tailer follows the log of a server, usually logs/latest.log, and publishes
+// the events of the lines appended to it.
+//
+// The log is polled rather than watched. When the server rotates it, i.e.
+// compresses it to a .log.gz and starts a new one, the tailer reads what is
+// left of the old log and moves to the new one from its start. A log that is
+// truncated is read again from its start too.
+type Tailer struct {
+	path     string
+	interval time.Duration
+	logger   *zap.Logger
+
+	mu          sync.Mutex
+	subscribers []chan Event
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewTailer creates a tailer and starts following the log at path from its
+// end, lines that are already in it are not published.
+func NewTailer(path string, interval time.Duration, logger *zap.Logger) *Tailer {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	t := &Tailer{
+		path:     path,
+		interval: interval,
+		logger:   logger.With(zap.String("path", path)),
+
+		cancel: cancel,
+	}
+	t.wg.Add(1)
+	go t.tail(ctx)
+	return t
+}
+
+// Subscribe returns a channel on which every following event is published.
+// The channel is closed when the tailer is closed.
+func (t *Tailer) Subscribe() <-chan Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ch := make(chan Event, SubscriptionBuffer)
+	t.subscribers = append(t.subscribers, ch)
+	return ch
+}
+
+// Close stops following the log and closes the channels of the subscribers.
+func (t *Tailer) Close() error {
+	t.cancel()
+	t.wg.Wait()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, ch := range t.subscribers {
+		close(ch)
+	}
+	t.subscribers = nil
+	return nil
+}
+
+// publish sends an event to every subscriber.
+func (t *Tailer) publish(event Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, ch := range t.subscribers {
+		select {
+		case ch <- event:
+		default:
+			t.logger.Warn("subscriber too slow, event dropped", zap.String("text", event.Log().Text))
+		}
+	}
+}
+
+// tail follows the log until ctx is canceled.
+func (t *Tailer) tail(ctx context.Context) {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	var f *logFile
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	// the log that is there when the tailer starts is followed from its
+	// end, the ones that replace it from their start
+	fromStart := false
+	for {
+		if f == nil {
+			var err error
+			f, err = openLogFile(t.path, fromStart)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				t.logger.Warn("open log", zap.Error(err))
+			}
+			if err != nil {
+				fromStart = true
+			}
+		}
+		if f != nil {
+			t.readLines(f)
+			if rotated, err := f.rotated(t.path); rotated {
+				// what is left of the old log was just read
+				t.logger.Debug("log rotated", zap.NamedError("reason", err))
+				f.Close()
+				f = nil
+				fromStart = true
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// readLines publishes the events of the complete lines appended to the log
+// since it was last read.
+func (t *Tailer) readLines(f *logFile) {
+	for {
+		text, err := f.ReadLine()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.logger.Warn("read log", zap.Error(err))
+			}
+			return
+		}
+		if event, ok := Parse(text, time.Now()); ok {
+			t.publish(event)
+		}
+	}
+}
+
+// logFile is an open log, read line by line.
+type logFile struct {
+	*os.File
+	r *bufio.Reader
+	// offset is the offset of the end of the last complete line read.
+	offset int64
+	// partial is the start of a line that is still being written.
+	partial []byte
+}
+
+func openLogFile(path string, fromStart bool) (*logFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &logFile{File: file, r: bufio.NewReader(file)}
+	if !fromStart {
+		f.offset, err = file.Seek(0, io.SeekEnd)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// ReadLine returns the next complete line of the log, or io.EOF if there is
+// none yet.
+func (f *logFile) ReadLine() (string, error) {
+	b, err := f.r.ReadBytes('\n')
+	f.partial = append(f.partial, b...)
+	if err != nil {
+		return "", err
+	}
+	line := string(f.partial)
+	f.offset += int64(len(f.partial))
+	f.partial = f.partial[:0]
+	return line, nil
+}
+
+// rotated reports whether the log at path is not this file anymore, because
+// it was moved, deleted or truncated.
+func (f *logFile) rotated(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return true, err
+	}
+	current, err := f.Stat()
+	if err != nil {
+		return true, err
+	}
+	if !os.SameFile(info, current) {
+		return true, errors.New("log replaced")
+	}
+	if info.Size() < f.offset {
+		return true, errors.New("log truncated")
+	}
+	return false, nil
+}
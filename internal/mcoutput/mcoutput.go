@@ -0,0 +1,113 @@
+// Package mcoutput parses the output of common Minecraft commands into typed
+// values.
+//
+// Parsers are looked up by command in a Registry. The output of a command
+// without a parser, or that its parser does not recognize, e.g. because the
+// server runs a version or a mod that words it differently, is left as raw
+// text.
+package mcoutput
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cezarmathe/stevebot/internal/mcformat"
+)
+
+var (
+	ErrUnrecognizedOutput = errors.New("unrecognized output")
+)
+
+// Parser parses the output of a command into a typed value, e.g. a
+// PlayerList. The arguments of the command are the words that follow the
+// command the parser is registered for.
+type Parser func(args []string, out string) (interface{}, error)
+
+// Registry holds output parsers by command.
+type Registry struct {
+	parsers map[string]Parser
+}
+
+// Create a new empty registry.
+func NewRegistry() *Registry {
+	return &Registry{parsers: make(map[string]Parser)}
+}
+
+// Default creates a registry with the parsers of this package.
+func Default() *Registry {
+	r := NewRegistry()
+	r.parsers["list"] = ParseList
+	r.parsers["whitelist list"] = ParseWhitelist
+	r.parsers["banlist"] = ParseBanlist
+	r.parsers["time query"] = ParseTimeQuery
+	r.parsers["seed"] = ParseSeed
+	r.parsers["difficulty"] = ParseDifficulty
+	r.parsers["scoreboard objectives list"] = ParseObjectives
+	return r
+}
+
+// Add a parser for a command, e.g. "whitelist list".
+func (r *Registry) Add(cmd string, parser Parser) error {
+	cmd = strings.Join(strings.Fields(strings.ToLower(cmd)), " ")
+	if _, ok := r.parsers[cmd]; ok {
+		return fmt.Errorf("parser for %q already registered", cmd)
+	}
+	r.parsers[cmd] = parser
+	return nil
+}
+
+// Commands returns the commands with a parser, sorted.
+func (r *Registry) Commands() []string {
+	cmds := make([]string, 0, len(r.parsers))
+	for cmd := range r.parsers {
+		cmds = append(cmds, cmd)
+	}
+	sort.Strings(cmds)
+	return cmds
+}
+
+// Parse parses the output of a command with the parser registered for the
+// longest run of its first words, and returns false if there is no such
+// parser or it does not recognize the output. Formatting codes are removed
+// from the output before parsing it.
+func (r *Registry) Parse(cmd, out string) (interface{}, bool) {
+	argv := strings.Fields(strings.ToLower(strings.TrimPrefix(strings.TrimSpace(cmd), "/")))
+	for n := len(argv); n > 0; n-- {
+		parser, ok := r.parsers[strings.Join(argv[:n], " ")]
+		if !ok {
+			continue
+		}
+		value, err := parser(argv[n:], strings.TrimSpace(mcformat.Strip(out)))
+		if err != nil {
+			return nil, false
+		}
+		return value, true
+	}
+	return nil, false
+}
+
+// splitNames splits a list of names separated by commas, spaces, new lines or
+// "and", as written by the different versions of the server.
+func splitNames(s string) []string {
+	var names []string
+	for _, name := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n'
+	}) {
+		if name != "and" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// cutList splits output like "There are 2 whitelisted players: alex, steve"
+// at the first colon, and returns false if there is none.
+func cutList(out string) (string, string, bool) {
+	i := strings.Index(out, ":")
+	if i < 0 {
+		return out, "", false
+	}
+	return out[:i], strings.TrimSpace(out[i+1:]), true
+}
@@ -0,0 +1,91 @@
+package mcoutput
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	registry := Default()
+	tests := []struct {
+		cmd  string
+		out  string
+		want interface{}
+	}{
+		{"list", "There are 3 of a max of 20 players online: alex, steve, §cnotch",
+			PlayerList{Online: 3, Max: 20, Players: []string{"alex", "steve", "notch"}}},
+		{"list", "There are 0 of a max of 20 players online: ", PlayerList{Max: 20}},
+		{"list", "There are 2/10 players online:\nalex, steve", PlayerList{Online: 2, Max: 10, Players: []string{"alex", "steve"}}},
+		{"list", "There are 2/10 players online:alex, steve", PlayerList{Online: 2, Max: 10, Players: []string{"alex", "steve"}}},
+		{"list uuids", "There are 1 of a max of 20 players online: steve (069a79f4-44e9-4726-a5be-fca90e38aaf5)",
+			PlayerList{Online: 1, Max: 20, Players: []string{"steve"}}},
+		{"list", "There are 2 out of maximum 20 players online.\ndefault: alex, steve",
+			PlayerList{Online: 2, Max: 20, Players: []string{"alex", "steve"}}},
+		{"whitelist list", "There are 2 whitelisted players: alex, steve", Whitelist{Players: []string{"alex", "steve"}}},
+		{"whitelist list", "There are 2 (out of 3 seen) whitelisted players:\nalex and steve", Whitelist{Players: []string{"alex", "steve"}}},
+		{"whitelist list", "There are 2 (out of 3 seen) whitelisted players:alex and steve", Whitelist{Players: []string{"alex", "steve"}}},
+		{"whitelist list", "There are no whitelisted players", Whitelist{}},
+		{"banlist", "There are 2 ban(s):\nsteve was banned by Server: Banned by an operator.\n1.2.3.4 was banned by alex: griefing",
+			Banlist{Bans: []Ban{{"steve", "Server", "Banned by an operator."}, {"1.2.3.4", "alex", "griefing"}}}},
+		// vanilla RCON joins messages without new lines
+		{"banlist", "There are 3 ban(s):steve was banned by Server: Banned by an operator.1.2.3.4 was banned by alex: griefing, again!notch was banned by Rcon: spam",
+			Banlist{Bans: []Ban{{"steve", "Server", "Banned by an operator."}, {"1.2.3.4", "alex", "griefing, again!"}, {"notch", "Rcon", "spam"}}}},
+		{"banlist players", "There are 1 ban(s):steve was banned by Server: Banned by an operator.",
+			Banlist{Bans: []Ban{{"steve", "Server", "Banned by an operator."}}}},
+		{"banlist ips", "There are no bans", Banlist{}},
+		{"time query daytime", "The time is 6000", Time{Query: "daytime", Value: 6000}},
+		{"/seed", "Seed: [-4172144997902289642]", Seed{Value: -4172144997902289642}},
+		{"difficulty", "The difficulty is Normal", Difficulty{Name: "Normal"}},
+		{"difficulty hard", "The difficulty has been set to Hard", Difficulty{Name: "Hard", Changed: true}},
+		{"scoreboard objectives list", "There are 2 objective(s): [Deaths], [Kills]",
+			Objectives{Objectives: []Objective{{DisplayName: "Deaths"}, {DisplayName: "Kills"}}}},
+		{"scoreboard objectives list", "Showing 1 objective(s) on scoreboard:\n- deaths: displays as 'Deaths' and is type 'deathCount'",
+			Objectives{Objectives: []Objective{{Name: "deaths", DisplayName: "Deaths", Criteria: "deathCount"}}}},
+		{"scoreboard objectives list", "Showing 2 objective(s) on scoreboard:- deaths: displays as 'Deaths' and is type 'deathCount'- kills: displays as 'Kills' and is type 'playerKillCount'",
+			Objectives{Objectives: []Objective{{"deaths", "Deaths", "deathCount"}, {"kills", "Kills", "playerKillCount"}}}},
+	}
+	for _, test := range tests {
+		got, ok := registry.Parse(test.cmd, test.out)
+		if !ok {
+			t.Errorf("%s: %q not parsed", test.cmd, test.out)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.cmd, got, test.want)
+		}
+	}
+}
+
+func TestParseFallback(t *testing.T) {
+	registry := Default()
+	tests := []struct {
+		cmd string
+		out string
+	}{
+		{"say hello", "hello"},
+		{"list", "Unknown command"},
+		{"time query", "The time is 6000"},
+		{"banlist", "There are 1 ban(s):\nsomething unexpected"},
+		// where the reason stops and the next name starts can't be told
+		{"banlist", "There are 2 ban(s):steve was banned by alex: griefingnotch was banned by alex: spam"},
+		{"scoreboard objectives list", "Showing 1 objective(s) on scoreboard:- deaths: displays as 'Deaths'"},
+	}
+	for _, test := range tests {
+		if got, ok := registry.Parse(test.cmd, test.out); ok {
+			t.Errorf("%s: %q parsed as %+v", test.cmd, test.out, got)
+		}
+	}
+}
+
+func TestRegistryAdd(t *testing.T) {
+	registry := Default()
+	if err := registry.Add("list", ParseList); err == nil {
+		t.Error("added a second parser for list")
+	}
+	if err := registry.Add("Whitelist  Reload", ParseWhitelist); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := registry.Parse("whitelist reload", "There are no whitelisted players"); !ok {
+		t.Error("added parser not used")
+	}
+}
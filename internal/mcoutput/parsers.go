@@ -0,0 +1,258 @@
+package mcoutput
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// "There are 2 of a max of 20 players online: alex, steve" since 1.13,
+	// "There are 2 out of maximum 20 players online." on Paper and
+	// "There are 2/20 players online:" before 1.13
+	listRegex = regexp.MustCompile(`^There are (\d+)(?: of a max of | out of maximum |/)(\d+) players online[.:]?`)
+	// "There are 2 whitelisted players: alex, steve" since 1.13 and "There
+	// are 2 (out of 5 seen) whitelisted players:" before
+	whitelistRegex = regexp.MustCompile(`^There are (\d+)(?: \(out of \d+ seen\))? whitelisted player(?:s|\(s\))?:`)
+	bansRegex      = regexp.MustCompile(`^There are (\d+) ban(?:s|\(s\))?:`)
+	// the target of a ban, a player name or an IPv4 address
+	banTargetRegex = regexp.MustCompile(`^(?:\d{1,3}(?:\.\d{1,3}){3}|\w{1,16})$`)
+	// the target of the next ban, at the end of the reason of a ban
+	nextBanTargetRegex = regexp.MustCompile(`(?:\d{1,3}(?:\.\d{1,3}){3}|\w{1,16})$`)
+	banSourceRegex     = regexp.MustCompile(`^(\S+?): `)
+	timeRegex          = regexp.MustCompile(`^The time is (-?\d+)$`)
+	seedRegex          = regexp.MustCompile(`^Seed: \[?(-?\d+)\]?$`)
+	// "The difficulty is Normal", "The difficulty has been set to Hard" and
+	// "The difficulty did not change; it is already set to Hard"
+	difficultyRegex = regexp.MustCompile(`^The difficulty (?:is|has been set to|did not change; it is already set to) (\w+)$`)
+	// "There are 2 objective(s): [Deaths], [Kills]" since 1.13
+	objectivesRegex = regexp.MustCompile(`^There are (\d+) objectives?(?:\(s\))?:`)
+	// "- deaths: displays as 'Deaths' and is type 'deathCount'" before 1.13
+	legacyObjectiveRegex = regexp.MustCompile(`- (.+?): displays as '(.*?)' and is type '([^']+)'`)
+	bracketsRegex        = regexp.MustCompile(`\[([^\]]*)\]`)
+)
+
+// PlayerList is the output of the list command.
+type PlayerList struct {
+	Online  int
+	Max     int
+	Players []string
+}
+
+// ParseList parses the output of the list command.
+func ParseList(args []string, out string) (interface{}, error) {
+	match := listRegex.FindStringSubmatch(out)
+	if match == nil {
+		return nil, ErrUnrecognizedOutput
+	}
+	list := PlayerList{}
+	list.Online, _ = strconv.Atoi(match[1])
+	list.Max, _ = strconv.Atoi(match[2])
+	for _, line := range strings.Split(out[len(match[0]):], "\n") {
+		// Paper lists players by group, e.g. "default: alex, steve"
+		if _, names, ok := cutList(line); ok {
+			line = names
+		}
+		for _, name := range splitNames(line) {
+			// list uuids follows names with their uuid in parentheses
+			if !strings.HasPrefix(name, "(") {
+				list.Players = append(list.Players, name)
+			}
+		}
+	}
+	return list, nil
+}
+
+// Whitelist is the output of the whitelist list command.
+type Whitelist struct {
+	Players []string
+}
+
+// ParseWhitelist parses the output of the whitelist list command.
+func ParseWhitelist(args []string, out string) (interface{}, error) {
+	if out == "There are no whitelisted players" {
+		return Whitelist{}, nil
+	}
+	if !whitelistRegex.MatchString(out) {
+		return nil, ErrUnrecognizedOutput
+	}
+	_, names, _ := cutList(out)
+	return Whitelist{Players: splitNames(names)}, nil
+}
+
+// Ban is an entry of the ban list.
+type Ban struct {
+	// Target is the banned player or IP address.
+	Target string
+	// Source is who banned the target, "Server" for the console.
+	Source string
+	Reason string
+}
+
+// Banlist is the output of the banlist command.
+type Banlist struct {
+	Bans []Ban
+}
+
+// ParseBanlist parses the output of the banlist command.
+//
+// Vanilla servers send every ban as its own message, and RCON joins them
+// without new lines: "There are 2 ban(s):steve was banned by Server: Banned by
+// an operator.alex was banned by steve: griefing". Bans are split at " was
+// banned by ", and the target of a ban is the name or address at the end of
+// the reason of the previous one. If the reason ends with a letter, a digit or
+// an underscore, where it stops and the name starts can't be told, and the
+// output is not recognized.
+func ParseBanlist(args []string, out string) (interface{}, error) {
+	if out == "There are no bans" {
+		return Banlist{}, nil
+	}
+	match := bansRegex.FindStringSubmatch(out)
+	if match == nil {
+		return nil, ErrUnrecognizedOutput
+	}
+	list := Banlist{}
+	parts := strings.Split(out[len(match[0]):], " was banned by ")
+	target := strings.TrimSpace(parts[0])
+	if len(parts) == 1 {
+		if target != "" {
+			return nil, fmt.Errorf("%w: ban %q", ErrUnrecognizedOutput, target)
+		}
+		return list, nil
+	}
+	if !banTargetRegex.MatchString(target) {
+		return nil, fmt.Errorf("%w: ban target %q", ErrUnrecognizedOutput, target)
+	}
+	for i, part := range parts[1:] {
+		source := banSourceRegex.FindStringSubmatch(part)
+		if source == nil {
+			return nil, fmt.Errorf("%w: ban %q", ErrUnrecognizedOutput, part)
+		}
+		reason, next := part[len(source[0]):], ""
+		if i < len(parts)-2 {
+			loc := nextBanTargetRegex.FindStringIndex(reason)
+			if loc == nil || loc[0] == 0 || isWordByte(reason[loc[0]-1]) {
+				return nil, fmt.Errorf("%w: ambiguous ban %q", ErrUnrecognizedOutput, part)
+			}
+			reason, next = reason[:loc[0]], reason[loc[0]:]
+		}
+		list.Bans = append(list.Bans, Ban{Target: target, Source: source[1], Reason: strings.TrimSpace(reason)})
+		target = next
+	}
+	return list, nil
+}
+
+// isWordByte returns whether b may be part of a player name.
+func isWordByte(b byte) bool {
+	return b == '_' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+// Time is the output of the time query command.
+type Time struct {
+	// Query is what was queried: daytime, gametime or day.
+	Query string
+	// Value is a number of ticks for daytime and gametime, and a number of
+	// days for day.
+	Value int64
+}
+
+// ParseTimeQuery parses the output of the time query command.
+func ParseTimeQuery(args []string, out string) (interface{}, error) {
+	match := timeRegex.FindStringSubmatch(out)
+	if match == nil || len(args) != 1 {
+		return nil, ErrUnrecognizedOutput
+	}
+	value, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnrecognizedOutput, err)
+	}
+	return Time{Query: args[0], Value: value}, nil
+}
+
+// Seed is the output of the seed command.
+type Seed struct {
+	Value int64
+}
+
+// ParseSeed parses the output of the seed command.
+func ParseSeed(args []string, out string) (interface{}, error) {
+	match := seedRegex.FindStringSubmatch(out)
+	if match == nil {
+		return nil, ErrUnrecognizedOutput
+	}
+	value, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnrecognizedOutput, err)
+	}
+	return Seed{Value: value}, nil
+}
+
+// Difficulty is the output of the difficulty command.
+type Difficulty struct {
+	Name string
+	// Changed is whether the command set the difficulty.
+	Changed bool
+}
+
+// ParseDifficulty parses the output of the difficulty command.
+func ParseDifficulty(args []string, out string) (interface{}, error) {
+	match := difficultyRegex.FindStringSubmatch(out)
+	if match == nil {
+		return nil, ErrUnrecognizedOutput
+	}
+	return Difficulty{Name: match[1], Changed: strings.Contains(out, "has been set")}, nil
+}
+
+// Objective is a scoreboard objective.
+type Objective struct {
+	// Name is only known before 1.13, which lists objectives with their
+	// name, display name and criteria.
+	Name        string
+	DisplayName string
+	Criteria    string
+}
+
+// Objectives is the output of the scoreboard objectives list command.
+type Objectives struct {
+	Objectives []Objective
+}
+
+// ParseObjectives parses the output of the scoreboard objectives list
+// command.
+func ParseObjectives(args []string, out string) (interface{}, error) {
+	if out == "There are no objectives" || out == "There are no objectives on the scoreboard" {
+		return Objectives{}, nil
+	}
+	list := Objectives{}
+	if objectivesRegex.MatchString(out) {
+		_, names, _ := cutList(out)
+		for _, match := range bracketsRegex.FindAllStringSubmatch(names, -1) {
+			list.Objectives = append(list.Objectives, Objective{DisplayName: match[1]})
+		}
+		return list, nil
+	}
+	if !strings.HasPrefix(out, "Showing ") {
+		return nil, ErrUnrecognizedOutput
+	}
+	// the objectives follow the header with or without new lines, depending
+	// on how the server joins messages
+	_, rest, _ := cutList(out)
+	matches := legacyObjectiveRegex.FindAllStringSubmatchIndex(rest, -1)
+	end := 0
+	for _, match := range matches {
+		if between := strings.TrimSpace(rest[end:match[0]]); between != "" {
+			return nil, fmt.Errorf("%w: objective %q", ErrUnrecognizedOutput, between)
+		}
+		end = match[1]
+		list.Objectives = append(list.Objectives, Objective{
+			Name:        rest[match[2]:match[3]],
+			DisplayName: rest[match[4]:match[5]],
+			Criteria:    rest[match[6]:match[7]],
+		})
+	}
+	if leftover := strings.TrimSpace(rest[end:]); leftover != "" {
+		return nil, fmt.Errorf("%w: objective %q", ErrUnrecognizedOutput, leftover)
+	}
+	return list, nil
+}
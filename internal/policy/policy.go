@@ -0,0 +1,336 @@
+// Package policy decides which Minecraft commands may be run, based on an
+// ordered list of allow and deny rules. The first rule that matches a command
+// decides, commands that match no rule get the default action.
+//
+// Commands are matched the way the server reads them: a leading slash and the
+// namespace of the command name are ignored, so "/minecraft:op x" is matched
+// as "op x", and so is "bukkit:op x", as plugins register namespaced aliases
+// of the commands. The commands run by execute must be allowed too.
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrDenied is matched by DeniedError, use errors.Is to check for it.
+	ErrDenied = errors.New("command is not allowed")
+)
+
+// Action is what happens to a command matched by a rule.
+type Action string
+
+const (
+	Allow Action = "allow"
+	Deny  Action = "deny"
+)
+
+// Rule matches commands and decides whether they are allowed.
+type Rule struct {
+	// Name identifies the rule in decisions. Defaults to the pattern of the
+	// rule.
+	Name   string `json:"name,omitempty"`
+	Action Action `json:"action"`
+
+	// Command is a pattern matched against the words of a command, one word
+	// of the pattern for one word of the command:
+	//  * a word enclosed in slashes, like /^(day|night)$/, is a regular
+	//    expression
+	//  * any other word is a glob, where * matches any run of characters and
+	//    ? matches a single character
+	//  * a trailing ** matches all remaining words, including none
+	// Without a trailing **, the command must have as many words as the
+	// pattern. E.g. "gamemode survival *" matches "gamemode survival steve".
+	Command string `json:"command,omitempty"`
+
+	// Regex is a regular expression matched against the whole command.
+	Regex string `json:"regex,omitempty"`
+
+	words []*regexp.Regexp
+	rest  bool
+	regex *regexp.Regexp
+}
+
+// Policy is an ordered list of rules.
+type Policy struct {
+	Rules   []Rule `json:"rules"`
+	Default Action `json:"default"`
+}
+
+// Decision is the outcome of evaluating a command against a policy.
+type Decision struct {
+	Allowed bool
+	// Rule is the rule that matched the command, nil if no rule matched and
+	// the default action was applied.
+	Rule *Rule
+}
+
+// Reason explains the decision.
+func (d Decision) Reason() string {
+	verb := "denied"
+	if d.Allowed {
+		verb = "allowed"
+	}
+	if d.Rule == nil {
+		return fmt.Sprintf("%s by default", verb)
+	}
+	return fmt.Sprintf("%s by rule %q", verb, d.Rule.Name)
+}
+
+// DeniedError is returned for commands that are not allowed by a policy.
+type DeniedError struct {
+	Command  string
+	Decision Decision
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrDenied.Error(), e.Decision.Reason())
+}
+
+func (e *DeniedError) Unwrap() error {
+	return ErrDenied
+}
+
+// New creates a policy from a list of rules.
+func New(rules []Rule, defaultAction Action) (*Policy, error) {
+	p := &Policy{
+		Rules:   rules,
+		Default: defaultAction,
+	}
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Parse parses a policy encoded as JSON, e.g.
+//
+//	{
+//	    "default": "deny",
+//	    "rules": [
+//	        {"action": "deny", "command": "gamemode creative *"},
+//	        {"action": "allow", "command": "gamemode survival *"},
+//	        {"action": "allow", "command": "list"}
+//	    ]
+//	}
+func Parse(data []byte) (*Policy, error) {
+	p := new(Policy)
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	return p, nil
+}
+
+// UnmarshalJSON decodes and compiles a policy, so that policies can be
+// embedded in other JSON documents.
+func (p *Policy) UnmarshalJSON(data []byte) error {
+	type plain Policy
+	if err := json.Unmarshal(data, (*plain)(p)); err != nil {
+		return err
+	}
+	return p.compile()
+}
+
+// Load loads a policy from a JSON file.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load policy: %w", err)
+	}
+	return Parse(data)
+}
+
+// AllowList creates a policy that allows only commands starting with one of
+// the given commands and denies everything else. Commands are compared word
+// by word, so allowing "op" does not allow "open".
+func AllowList(commands []string) *Policy {
+	return fromList(commands, Allow, Deny)
+}
+
+// DenyList creates a policy that denies commands starting with one of the
+// given commands and allows everything else.
+func DenyList(commands []string) *Policy {
+	return fromList(commands, Deny, Allow)
+}
+
+func fromList(commands []string, action, defaultAction Action) *Policy {
+	rules := make([]Rule, 0, len(commands))
+	for _, command := range commands {
+		words := strings.Fields(command)
+		if len(words) == 0 {
+			continue
+		}
+		for i, word := range words {
+			words[i] = regexp.QuoteMeta(word)
+			words[i] = "/^" + words[i] + "$/"
+		}
+		rules = append(rules, Rule{
+			Name:    command,
+			Action:  action,
+			Command: strings.Join(append(words, "**"), " "),
+		})
+	}
+	p, err := New(rules, defaultAction)
+	if err != nil {
+		// the patterns are built from quoted words, they always compile
+		panic(err)
+	}
+	return p
+}
+
+// Evaluate decides whether a command is allowed. An execute command is only
+// allowed if the command after every run word is allowed as well: "run" may
+// also be an argument, so every tail is checked rather than guessing which
+// one the server runs.
+func (p *Policy) Evaluate(command string) Decision {
+	words := normalize(strings.Fields(command))
+	decision := p.evaluate(strings.Join(words, " "), words)
+	if !decision.Allowed || len(words) == 0 || words[0] != "execute" {
+		return decision
+	}
+	for i, word := range words {
+		if word != "run" {
+			continue
+		}
+		if d := p.Evaluate(strings.Join(words[i+1:], " ")); !d.Allowed {
+			return d
+		}
+	}
+	return decision
+}
+
+func (p *Policy) evaluate(command string, words []string) Decision {
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.matches(command, words) {
+			return Decision{Allowed: rule.Action == Allow, Rule: rule}
+		}
+	}
+	return Decision{Allowed: p.Default == Allow}
+}
+
+// normalize strips the leading slash and the namespace, e.g. minecraft: or
+// bukkit:, from the name of a command.
+func normalize(words []string) []string {
+	if len(words) == 0 {
+		return words
+	}
+	name := strings.TrimPrefix(words[0], "/")
+	if i := strings.LastIndexByte(name, ':'); i >= 0 && i < len(name)-1 {
+		name = name[i+1:]
+	}
+	if name == "" {
+		return words[1:]
+	}
+	return append([]string{name}, words[1:]...)
+}
+
+// Check returns a DeniedError if a command is not allowed.
+func (p *Policy) Check(command string) error {
+	decision := p.Evaluate(command)
+	if !decision.Allowed {
+		return &DeniedError{Command: command, Decision: decision}
+	}
+	return nil
+}
+
+func (p *Policy) compile() error {
+	switch p.Default {
+	case "":
+		p.Default = Deny
+	case Allow, Deny:
+	default:
+		return fmt.Errorf("policy: bad default action %q", p.Default)
+	}
+	for i := range p.Rules {
+		if err := p.Rules[i].compile(); err != nil {
+			return fmt.Errorf("policy: rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) compile() error {
+	if r.Action != Allow && r.Action != Deny {
+		return fmt.Errorf("bad action %q", r.Action)
+	}
+	if r.Command == "" && r.Regex == "" {
+		return errors.New("rule has neither a command nor a regex")
+	}
+	if r.Name == "" {
+		r.Name = r.Command
+		if r.Name == "" {
+			r.Name = r.Regex
+		}
+	}
+
+	r.words = nil
+	r.rest = false
+	words := strings.Fields(r.Command)
+	if n := len(words); n > 0 && words[n-1] == "**" {
+		r.rest = true
+		words = words[:n-1]
+	}
+	for _, word := range words {
+		re, err := compileWord(word)
+		if err != nil {
+			return err
+		}
+		r.words = append(r.words, re)
+	}
+
+	r.regex = nil
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return err
+		}
+		r.regex = re
+	}
+	return nil
+}
+
+// compileWord compiles a word of a command pattern into a regular expression
+// that must match a whole word of a command.
+func compileWord(word string) (*regexp.Regexp, error) {
+	if len(word) > 1 && strings.HasPrefix(word, "/") && strings.HasSuffix(word, "/") {
+		return regexp.Compile(word[1 : len(word)-1])
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for _, c := range word {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func (r *Rule) matches(command string, words []string) bool {
+	if r.Command != "" {
+		if len(words) < len(r.words) || (!r.rest && len(words) != len(r.words)) {
+			return false
+		}
+		for i, re := range r.words {
+			if !re.MatchString(words[i]) {
+				return false
+			}
+		}
+	}
+	if r.regex != nil && !r.regex.MatchString(command) {
+		return false
+	}
+	return true
+}
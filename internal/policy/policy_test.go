@@ -0,0 +1,137 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	rules, err := New([]Rule{
+		{Action: Deny, Command: "gamemode creative *"},
+		{Action: Allow, Command: "gamemode /^(survival|adventure)$/ *"},
+		{Action: Allow, Command: "time set /^(day|night)$/"},
+		{Action: Allow, Command: "tp? * *"},
+		{Action: Allow, Command: "say **"},
+		{Name: "execute", Action: Allow, Command: "execute **"},
+		{Action: Deny, Regex: `^ban-ip `},
+		{Action: Allow, Command: "ban-ip **"},
+	}, Deny)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy  *Policy
+		command string
+		allowed bool
+		rule    string
+	}{
+		// globs
+		{rules, "gamemode creative steve", false, "gamemode creative *"},
+		{rules, "gamemode creative", false, ""},
+		{rules, "tp steve alex", false, ""},
+		{rules, "tpa steve alex", true, "tp? * *"},
+		{rules, "tpall steve alex", false, ""},
+		{rules, "tp steve", false, ""},
+		// regular expression words
+		{rules, "gamemode survival steve", true, "gamemode /^(survival|adventure)$/ *"},
+		{rules, "gamemode spectator steve", false, ""},
+		{rules, "time set day", true, "time set /^(day|night)$/"},
+		{rules, "time set noon", false, ""},
+		// trailing **
+		{rules, "say", true, "say **"},
+		{rules, "say hello there", true, "say **"},
+		{rules, "saying hello", false, ""},
+		// whole command regular expressions
+		{rules, "ban-ip 127.0.0.1", false, "^ban-ip "},
+		{rules, "ban-ip", true, "ban-ip **"},
+		// prefixed command names
+		{rules, "/gamemode creative steve", false, "gamemode creative *"},
+		{rules, "minecraft:gamemode creative steve", false, "gamemode creative *"},
+		{rules, "/minecraft:gamemode creative steve", false, "gamemode creative *"},
+		{rules, "/say hi", true, "say **"},
+		{rules, "/minecraft:ban-ip 127.0.0.1", false, "^ban-ip "},
+		{rules, "bukkit:gamemode creative steve", false, "gamemode creative *"},
+		{rules, "/essentials:ban-ip 127.0.0.1", false, "^ban-ip "},
+		{rules, "execute as @a run bukkit:gamemode creative @s", false, "gamemode creative *"},
+		// commands run by execute
+		{rules, "execute as @a run say hi", true, "execute"},
+		{rules, "execute as @a run gamemode creative @s", false, "gamemode creative *"},
+		{rules, "execute as @a run execute at @s run gamemode creative @s", false, "gamemode creative *"},
+		{rules, "execute as @a run minecraft:gamemode creative @s", false, "gamemode creative *"},
+		{rules, "minecraft:execute run stop", false, ""},
+		{rules, "execute as @a at @s", true, "execute"},
+
+		// lists
+		{AllowList([]string{"list", "say"}), "list", true, "list"},
+		{AllowList([]string{"list", "say"}), "list uuids", true, "list"},
+		{AllowList([]string{"list", "say"}), "listen", false, ""},
+		{AllowList([]string{"list", "say"}), "/list", true, "list"},
+		{AllowList([]string{"list", "say"}), "stop", false, ""},
+		{AllowList([]string{"whitelist add"}), "whitelist add steve", true, "whitelist add"},
+		{AllowList([]string{"whitelist add"}), "whitelist remove steve", false, ""},
+		{AllowList([]string{"execute"}), "execute as @a run op steve", false, ""},
+		{DenyList([]string{"op", "stop"}), "op steve", false, "op"},
+		{DenyList([]string{"op", "stop"}), "/op steve", false, "op"},
+		{DenyList([]string{"op", "stop"}), "minecraft:op steve", false, "op"},
+		{DenyList([]string{"op", "stop"}), "/minecraft:stop", false, "stop"},
+		{DenyList([]string{"op", "stop"}), "bukkit:stop", false, "stop"},
+		{DenyList([]string{"op", "stop"}), "/Bukkit:stop", false, "stop"},
+		{DenyList([]string{"op", "stop"}), "essentials:op steve", false, "op"},
+		{DenyList([]string{"op", "stop"}), "execute run paper:stop", false, "stop"},
+		{DenyList([]string{"op", "stop"}), "say bukkit:stop", true, ""},
+		{DenyList([]string{"op", "stop"}), "stop:", true, ""},
+		{AllowList([]string{"list"}), "bukkit:list", true, "list"},
+		{DenyList([]string{"op", "stop"}), "execute as @a run op steve", false, "op"},
+		{DenyList([]string{"op", "stop"}), "execute if entity @a run minecraft:stop", false, "stop"},
+		{DenyList([]string{"op", "stop"}), "execute as run run say hi", true, ""},
+		{DenyList([]string{"op", "stop"}), "open steve", true, ""},
+		{DenyList([]string{"op", "stop"}), "say op steve", true, ""},
+		{DenyList([]string{"op", "stop"}), "deop steve", true, ""},
+		{DenyList([]string{"op", "stop"}), "", true, ""},
+	}
+	for _, test := range tests {
+		d := test.policy.Evaluate(test.command)
+		rule := ""
+		if d.Rule != nil {
+			rule = d.Rule.Name
+		}
+		if d.Allowed != test.allowed || rule != test.rule {
+			t.Errorf("%q: got %v by %q, want %v by %q", test.command, d.Allowed, rule, test.allowed, test.rule)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p := DenyList([]string{"op"})
+	if err := p.Check("list"); err != nil {
+		t.Errorf("list: got %v, want nil", err)
+	}
+	err := p.Check("/op steve")
+	var denied *DeniedError
+	if !errors.As(err, &denied) || !errors.Is(err, ErrDenied) || denied.Decision.Rule.Name != "op" {
+		t.Errorf("got %v, want a denial by rule op", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(`{"default": "allow", "rules": [{"action": "deny", "command": "stop"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Evaluate("stop").Allowed || !p.Evaluate("list").Allowed {
+		t.Error("parsed policy does not apply its rules")
+	}
+
+	for _, data := range []string{
+		`{"default": "maybe"}`,
+		`{"rules": [{"action": "maybe", "command": "stop"}]}`,
+		`{"rules": [{"action": "deny"}]}`,
+		`{"rules": [{"action": "deny", "command": "/(/"}]}`,
+		`{"rules": [{"action": "deny", "regex": "("}]}`,
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: got no error", data)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Package query implements a client for the GameSpy4 query protocol, which
+// Minecraft servers answer over UDP when enable-query is set.
+//
+// The client first asks the server for a challenge token, then sends it back
+// with a full stat request, to which the server answers with its settings as
+// key/value pairs followed by the names of all online players. Unlike RCON,
+// the query protocol needs no credentials, and unlike the status ping, it
+// lists every online player and the plugins of the server.
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPort is the port of servers whose address has none, the query
+	// port defaults to the game port.
+	DefaultPort = 25565
+
+	packetTypeHandshake byte = 0x09
+	packetTypeStat      byte = 0x00
+
+	// sessionIDMask keeps the bits of session ids Minecraft servers keep.
+	sessionIDMask = 0x0f0f0f0f
+	// Full stat responses fit in a single datagram.
+	maxResponseLength = 65535
+)
+
+var (
+	// DefaultTimeout bounds queries whose context has no deadline.
+	DefaultTimeout = time.Second * 5
+
+	magic = []byte{0xfe, 0xfd}
+	// fullStatPadding asks for a full stat instead of a basic one.
+	fullStatPadding = []byte{0x00, 0x00, 0x00, 0x00}
+	// The key/value section of a full stat starts after "splitnum\x00\x80\x00"
+	// and the players section after "\x01player_\x00\x00".
+	keyValuesPadding = 11
+	playersPadding   = []byte("\x01player_\x00\x00")
+)
+
+var (
+	// ErrMalformedPacket is returned when the server sends a packet that
+	// can't be decoded.
+	ErrMalformedPacket = errors.New("query: malformed packet")
+	// ErrBadSessionID is returned when the server answers with a session id
+	// other than the one of the request.
+	ErrBadSessionID = errors.New("query: bad session id")
+)
+
+// Stat is the full stat of a server.
+type Stat struct {
+	// MOTD is the description of the server, with § formatting codes.
+	MOTD     string
+	GameType string
+	GameID   string
+	Version  string
+	// Software is the server software, e.g. "Paper on 1.20.1", empty for
+	// vanilla servers.
+	Software string
+	// Plugins are the names and versions of the plugins, e.g. "EssentialsX
+	// 2.20.1".
+	Plugins    []string
+	Map        string
+	NumPlayers int
+	MaxPlayers int
+	HostPort   int
+	HostIP     string
+	// Players are the names of all online players.
+	Players []string
+}
+
+// FullStat returns the full stat of the server at address, as host or
+// host:port.
+func FullStat(ctx context.Context, address string) (*Stat, error) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, strconv.Itoa(DefaultPort))
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	sessionID := rand.Int31() & sessionIDMask
+	res, err := roundTrip(conn, packetTypeHandshake, sessionID, nil)
+	if err != nil {
+		return nil, err
+	}
+	token, err := strconv.ParseInt(string(bytes.TrimRight(res, "\x00")), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%w: challenge token %q", ErrMalformedPacket, res)
+	}
+	payload := make([]byte, 4, 8)
+	binary.BigEndian.PutUint32(payload, uint32(int32(token)))
+	payload = append(payload, fullStatPadding...)
+	res, err = roundTrip(conn, packetTypeStat, sessionID, payload)
+	if err != nil {
+		return nil, err
+	}
+	return parseFullStat(res)
+}
+
+// roundTrip sends a request and returns the payload of the response.
+func roundTrip(conn net.Conn, typ byte, sessionID int32, payload []byte) ([]byte, error) {
+	req := append([]byte(nil), magic...)
+	req = append(req, typ, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(req[3:], uint32(sessionID))
+	if _, err := conn.Write(append(req, payload...)); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxResponseLength)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	res := buf[:n]
+	if len(res) < 5 || res[0] != typ {
+		return nil, ErrMalformedPacket
+	}
+	if got := int32(binary.BigEndian.Uint32(res[1:5])); got != sessionID {
+		return nil, fmt.Errorf("%w: got %d, want %d", ErrBadSessionID, got, sessionID)
+	}
+	return res[5:], nil
+}
+
+// parseFullStat parses the payload of a full stat response.
+func parseFullStat(res []byte) (*Stat, error) {
+	if len(res) < keyValuesPadding {
+		return nil, ErrMalformedPacket
+	}
+	res = res[keyValuesPadding:]
+	values := make(map[string]string)
+	for {
+		key, rest, ok := cutString(res)
+		if !ok {
+			return nil, ErrMalformedPacket
+		}
+		res = rest
+		if key == "" {
+			break
+		}
+		value, rest, ok := cutString(res)
+		if !ok {
+			return nil, ErrMalformedPacket
+		}
+		res = rest
+		values[key] = value
+	}
+	if !bytes.HasPrefix(res, playersPadding) {
+		return nil, fmt.Errorf("%w: no players section", ErrMalformedPacket)
+	}
+	res = res[len(playersPadding):]
+
+	stat := &Stat{
+		MOTD:     values["hostname"],
+		GameType: values["gametype"],
+		GameID:   values["game_id"],
+		Version:  values["version"],
+		Map:      values["map"],
+		HostIP:   values["hostip"],
+	}
+	stat.NumPlayers, _ = strconv.Atoi(values["numplayers"])
+	stat.MaxPlayers, _ = strconv.Atoi(values["maxplayers"])
+	stat.HostPort, _ = strconv.Atoi(values["hostport"])
+	stat.Software, stat.Plugins = parsePlugins(values["plugins"])
+	for {
+		name, rest, ok := cutString(res)
+		if !ok || name == "" {
+			break
+		}
+		res = rest
+		stat.Players = append(stat.Players, name)
+	}
+	return stat, nil
+}
+
+// parsePlugins parses the plugins value of a full stat, e.g. "Paper on
+// 1.20.1: EssentialsX 2.20.1; LuckPerms 5.4.102", into the server software and
+// its plugins.
+func parsePlugins(value string) (string, []string) {
+	software, list, ok := strings.Cut(value, ":")
+	if !ok {
+		return strings.TrimSpace(value), nil
+	}
+	var plugins []string
+	for _, plugin := range strings.Split(list, ";") {
+		if plugin = strings.TrimSpace(plugin); plugin != "" {
+			plugins = append(plugins, plugin)
+		}
+	}
+	return strings.TrimSpace(software), plugins
+}
+
+// cutString cuts a null-terminated string at the start of b.
+func cutString(b []byte) (string, []byte, bool) {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return "", nil, false
+	}
+	return string(b[:i]), b[i+1:], true
+}
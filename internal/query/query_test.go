@@ -0,0 +1,92 @@
+package query
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cezarmathe/stevebot/internal/query/querytest"
+)
+
+func TestFullStat(t *testing.T) {
+	srv := querytest.NewServer(querytest.Config{
+		Values: map[string]string{
+			"hostname":   "A Minecraft Server",
+			"gametype":   "SMP",
+			"game_id":    "MINECRAFT",
+			"version":    "1.20.1",
+			"plugins":    "Paper on 1.20.1: EssentialsX 2.20.1; LuckPerms 5.4.102",
+			"map":        "world",
+			"numplayers": "2",
+			"maxplayers": "20",
+			"hostport":   "25565",
+			"hostip":     "127.0.0.1",
+		},
+		Players: []string{"alex", "steve"},
+	})
+	defer srv.Close()
+
+	stat, err := FullStat(context.Background(), srv.Addr)
+	if err != nil {
+		t.Fatalf("full stat: %v", err)
+	}
+	want := &Stat{
+		MOTD:       "A Minecraft Server",
+		GameType:   "SMP",
+		GameID:     "MINECRAFT",
+		Version:    "1.20.1",
+		Software:   "Paper on 1.20.1",
+		Plugins:    []string{"EssentialsX 2.20.1", "LuckPerms 5.4.102"},
+		Map:        "world",
+		NumPlayers: 2,
+		MaxPlayers: 20,
+		HostPort:   25565,
+		HostIP:     "127.0.0.1",
+		Players:    []string{"alex", "steve"},
+	}
+	if !reflect.DeepEqual(stat, want) {
+		t.Errorf("got %+v, want %+v", stat, want)
+	}
+	if srv.Stats() != 1 {
+		t.Errorf("server answered %d full stats", srv.Stats())
+	}
+}
+
+func TestFullStatVanilla(t *testing.T) {
+	srv := querytest.NewServer(querytest.Config{
+		Values: map[string]string{"hostname": "A Minecraft Server", "plugins": "", "numplayers": "0"},
+	})
+	defer srv.Close()
+
+	stat, err := FullStat(context.Background(), srv.Addr)
+	if err != nil {
+		t.Fatalf("full stat: %v", err)
+	}
+	if stat.Software != "" || stat.Plugins != nil || stat.Players != nil {
+		t.Errorf("got %+v", stat)
+	}
+}
+
+func TestFullStatTimeout(t *testing.T) {
+	srv := querytest.NewServer(querytest.Config{Silent: true})
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := FullStat(ctx, srv.Addr); err == nil {
+		t.Fatal("got a full stat from a silent server")
+	}
+}
+
+func TestParseFullStatMalformed(t *testing.T) {
+	for _, res := range []string{
+		"",
+		"splitnum\x00\x80\x00hostname\x00A Minecraft Server",
+		"splitnum\x00\x80\x00hostname\x00A Minecraft Server\x00\x00",
+	} {
+		if stat, err := parseFullStat([]byte(res)); err == nil {
+			t.Errorf("%q parsed as %+v", res, stat)
+		}
+	}
+}
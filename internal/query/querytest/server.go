@@ -0,0 +1,146 @@
+// Package querytest provides a fake Minecraft server answering the GameSpy4
+// query protocol over UDP, for tests.
+//
+// Like a Minecraft server, it hands out challenge tokens on handshakes and
+// only answers full stat requests that carry the token it handed to their
+// address.
+package querytest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Config is the scripted full stat of a server.
+type Config struct {
+	// Values are the key/value pairs of the full stat, e.g. "hostname" or
+	// "numplayers".
+	Values  map[string]string
+	Players []string
+	// Silent makes the server never answer, like a server with query
+	// disabled.
+	Silent bool
+}
+
+// Server is a fake Minecraft server listening on a local UDP port.
+type Server struct {
+	// Addr is the address the server listens on, as host:port.
+	Addr string
+
+	config Config
+	conn   net.PacketConn
+
+	mu        sync.Mutex
+	tokens    map[string]int32
+	lastToken int32
+	stats     int
+
+	wg sync.WaitGroup
+}
+
+// NewServer starts a fake server on a random local port.
+func NewServer(config Config) *Server {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		panic("querytest: failed to listen on a port: " + err.Error())
+	}
+	s := &Server{
+		Addr:      conn.LocalAddr().String(),
+		config:    config,
+		conn:      conn,
+		tokens:    make(map[string]int32),
+		lastToken: 9513307,
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Stats returns the number of full stat requests answered so far.
+func (s *Server) Stats() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stats
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.conn.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	buf := make([]byte, 1460)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req := buf[:n]
+		if s.config.Silent || len(req) < 7 || req[0] != 0xfe || req[1] != 0xfd {
+			continue
+		}
+		typ, sessionID := req[2], req[3:7]
+		res := append([]byte{typ}, sessionID...)
+		switch typ {
+		case 0x09:
+			res = append(res, strconv.Itoa(int(s.newToken(addr)))...)
+			res = append(res, 0)
+		case 0x00:
+			if len(req) != 15 || !s.checkToken(addr, int32(binary.BigEndian.Uint32(req[7:11]))) {
+				continue
+			}
+			res = append(res, s.fullStat()...)
+		default:
+			continue
+		}
+		s.conn.WriteTo(res, addr)
+	}
+}
+
+func (s *Server) newToken(addr net.Addr) int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastToken++
+	s.tokens[addr.String()] = s.lastToken
+	return s.lastToken
+}
+
+func (s *Server) checkToken(addr net.Addr, token int32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tokens[addr.String()] != token {
+		return false
+	}
+	s.stats++
+	return true
+}
+
+// fullStat returns the payload of a full stat response.
+func (s *Server) fullStat() []byte {
+	var b bytes.Buffer
+	b.WriteString("splitnum\x00\x80\x00")
+	keys := make([]string, 0, len(s.config.Values))
+	for key := range s.config.Values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b.WriteString(key + "\x00" + s.config.Values[key] + "\x00")
+	}
+	b.WriteString("\x00\x01player_\x00\x00")
+	for _, player := range s.config.Players {
+		b.WriteString(player + "\x00")
+	}
+	b.WriteByte(0)
+	return b.Bytes()
+}
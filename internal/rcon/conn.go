@@ -0,0 +1,377 @@
+// Package rcon implements a client for the Source RCON protocol, as spoken by
+// Minecraft servers.
+//
+// Responses longer than a single packet are reassembled by following every
+// command with an empty packet: the server handles packets in order, so the
+// reply to the empty packet marks the end of the command's response.
+//
+// Minecraft reads a single packet per read and drops the connection if a read
+// returns more than one, so packets are never written back to back: the empty
+// packet is only sent once the first packet of the response arrived, and
+// requests are sent one at a time. Concurrent callers wait for their turn, so
+// commands that should run in parallel need several connections. A request
+// abandoned by its caller keeps the connection busy until its response
+// arrives, for at most AbandonTimeout, after which the connection is closed.
+package rcon
+
+import (
+	"context"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultTimeout bounds requests whose context has no deadline.
+	DefaultTimeout = time.Second * 5
+
+	// AbandonTimeout bounds how long a request abandoned by its caller waits
+	// for its response. A server that does not answer in time leaves the
+	// connection in an unknown state, so it is closed with
+	// ErrAbandonTimeout.
+	AbandonTimeout = time.Second * 5
+)
+
+// Conn is an authenticated RCON connection. It is safe for concurrent use.
+type Conn struct {
+	conn net.Conn
+
+	wmu sync.Mutex // serializes writes
+
+	// slot is held by the request in flight, from the moment it is sent
+	// until its response is complete
+	slot chan struct{}
+
+	mu     sync.Mutex
+	lastID int32
+	cur    *request // the request in flight, if any
+	err    error    // set once the connection is no longer usable
+
+	done       chan struct{} // closed once the connection is no longer usable
+	readerDone chan struct{}
+}
+
+// request is a command waiting for its response.
+type request struct {
+	id           int32 // zero for pings, they consist of a sentinel only
+	sentinel     int32
+	sentinelSent bool
+	out          strings.Builder
+	result       chan result
+	abandoned    *time.Timer // closes the connection if the response is late
+}
+
+type result struct {
+	out string
+	err error
+}
+
+// Dial connects to the RCON server at address and authenticates with
+// password.
+func Dial(ctx context.Context, address, password string) (*Conn, error) {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{
+		conn:       nc,
+		slot:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		readerDone: make(chan struct{}),
+	}
+	if err := c.auth(ctx, password); err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	go c.read()
+
+	return c, nil
+}
+
+// Execute sends a command and returns the full response of the server.
+//
+// If ctx is canceled before the response arrives, Execute returns right away
+// and the response is discarded once it arrives.
+func (c *Conn) Execute(ctx context.Context, cmd string) (string, error) {
+	if len(cmd) > MaxCommandLength {
+		return "", ErrCommandTooLong
+	}
+
+	return c.roundTrip(ctx, true, cmd)
+}
+
+// Ping checks that the server still answers, by sending a lone empty packet
+// and waiting for the reply.
+func (c *Conn) Ping(ctx context.Context) error {
+	_, err := c.roundTrip(ctx, false, "")
+	return err
+}
+
+// newRequest makes the request in flight, once the slot is held. Requests
+// without a command only have a sentinel, which is sent right away.
+func (c *Conn) newRequest(withCommand bool) (*request, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	req := &request{result: make(chan result, 1)}
+	if withCommand {
+		req.id = c.nextID()
+	} else {
+		req.sentinelSent = true
+	}
+	req.sentinel = c.nextID()
+	c.cur = req
+
+	return req, nil
+}
+
+// roundTrip waits for the connection to be free, sends a command (or only a
+// sentinel packet) and waits for the response. The reader sends the sentinel
+// of a command once the first packet of its response arrives.
+func (c *Conn) roundTrip(ctx context.Context, withCommand bool, cmd string) (string, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+
+	select {
+	case c.slot <- struct{}{}:
+	case <-c.done:
+		return "", c.Err()
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	req, err := c.newRequest(withCommand)
+	if err != nil {
+		<-c.slot
+		return "", err
+	}
+
+	p := packet{req.sentinel, packetTypeResponseValue, ""}
+	if withCommand {
+		p = packet{req.id, packetTypeExecCommand, cmd}
+	}
+	if err := c.write(ctx, p); err != nil {
+		c.shutdown(err)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", err
+	}
+
+	select {
+	case <-ctx.Done():
+		// note 18/10/2026: the request stays in flight, the reader drops the
+		//                  response when it arrives and frees the slot
+		c.abandon(req)
+		return "", ctx.Err()
+	case res := <-req.result:
+		return res.out, res.err
+	}
+}
+
+// abandon closes the connection if the response to a request whose caller
+// gave up does not arrive within AbandonTimeout.
+func (c *Conn) abandon(req *request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cur != req {
+		return
+	}
+	req.abandoned = time.AfterFunc(AbandonTimeout, func() {
+		c.mu.Lock()
+		late := c.cur == req
+		c.mu.Unlock()
+		if late {
+			c.shutdown(ErrAbandonTimeout)
+		}
+	})
+}
+
+// Done returns a channel that is closed once the connection can no longer be
+// used, either because it was closed or because it broke.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason the connection can no longer be used, or nil if it
+// is still usable.
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close closes the connection. Pending requests fail with ErrClosed.
+func (c *Conn) Close() error {
+	c.shutdown(ErrClosed)
+	<-c.readerDone
+	return nil
+}
+
+// write sends a packet, without interleaving other writers.
+func (c *Conn) write(ctx context.Context, p packet) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	deadline, _ := ctx.Deadline()
+	_ = c.conn.SetWriteDeadline(deadline)
+
+	return writePacket(c.conn, p)
+}
+
+// read is the goroutine that reads packets and adds them to the response of
+// the request in flight. It sends the sentinel of a command after the first
+// packet of its response, and frees the slot once the reply to the sentinel
+// arrives.
+func (c *Conn) read() {
+	defer close(c.readerDone)
+
+	for {
+		p, err := readPacket(c.conn)
+		if err != nil {
+			c.shutdown(err)
+			return
+		}
+
+		c.mu.Lock()
+		req := c.cur
+		if req == nil || (p.id != req.id && p.id != req.sentinel) {
+			c.mu.Unlock()
+			want := int32(-1)
+			if req != nil {
+				want = req.id
+			}
+			c.shutdown(&RequestIDError{Want: want, Got: p.id})
+			return
+		}
+		if p.id == req.sentinel {
+			c.cur = nil
+			if req.abandoned != nil {
+				req.abandoned.Stop()
+			}
+			req.result <- result{req.out.String(), nil}
+			c.mu.Unlock()
+			<-c.slot
+			continue
+		}
+		req.out.WriteString(p.body)
+		sendSentinel := !req.sentinelSent
+		req.sentinelSent = true
+		c.mu.Unlock()
+
+		if sendSentinel {
+			ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+			err := c.write(ctx, packet{req.sentinel, packetTypeResponseValue, ""})
+			cancel()
+			if err != nil {
+				c.shutdown(err)
+				return
+			}
+		}
+	}
+}
+
+// shutdown marks the connection as unusable, closes it and fails all pending
+// requests with err. Only the first call has any effect.
+func (c *Conn) shutdown(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+	c.conn.Close()
+
+	if c.cur != nil {
+		c.cur.result <- result{"", err}
+		c.cur = nil
+	}
+}
+
+// auth performs the authentication handshake.
+func (c *Conn) auth(ctx context.Context, password string) error {
+	stop := c.watch(ctx)
+	defer stop()
+
+	id := c.nextID()
+	if err := writePacket(c.conn, packet{id, packetTypeAuth, password}); err != nil {
+		return err
+	}
+
+	for {
+		p, err := readPacket(c.conn)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		// some servers send an empty response value before the actual auth
+		// response
+		if p.typ == packetTypeResponseValue {
+			continue
+		}
+		if p.typ != packetTypeAuthResponse {
+			return ErrMalformedPacket
+		}
+		if p.id == -1 {
+			return ErrAuthFailed
+		}
+		if p.id != id {
+			return &RequestIDError{Want: id, Got: p.id}
+		}
+		return nil
+	}
+}
+
+// watch applies the deadline of ctx (or DefaultTimeout) to the underlying
+// connection and interrupts pending I/O if ctx is canceled. The returned
+// function must be called once the I/O is done.
+func (c *Conn) watch(ctx context.Context) func() {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultTimeout)
+	}
+	_ = c.conn.SetDeadline(deadline)
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			_ = c.conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+		_ = c.conn.SetDeadline(time.Time{})
+	}
+}
+
+// nextID returns a new request id. Ids are always positive, -1 is used by the
+// server to signal failed authentication. Must be called with mu held.
+func (c *Conn) nextID() int32 {
+	if c.lastID == math.MaxInt32 {
+		c.lastID = 0
+	}
+	c.lastID++
+	return c.lastID
+}
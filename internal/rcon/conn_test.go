@@ -0,0 +1,241 @@
+package rcon_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cezarmathe/stevebot/internal/rcon"
+	"github.com/cezarmathe/stevebot/internal/rcon/rcontest"
+)
+
+func dial(t *testing.T, srv *rcontest.Server) *rcon.Conn {
+	t.Helper()
+
+	conn, err := rcon.Dial(context.Background(), srv.Addr, srv.Password)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestExecute(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Script(map[string]rcontest.Response{
+		"list": {Body: "There are 0 of a max of 20 players online: "},
+	}))
+	defer srv.Close()
+	conn := dial(t, srv)
+
+	out, err := conn.Execute(context.Background(), "list")
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if want := "There are 0 of a max of 20 players online: "; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+	if got := srv.Commands(); len(got) != 1 || got[0] != "list" {
+		t.Errorf("server received %q, want [list]", got)
+	}
+}
+
+func TestExecuteFragmented(t *testing.T) {
+	long := strings.Repeat("0123456789", 1000)
+	srv := rcontest.NewServer("secret", rcontest.Script(map[string]rcontest.Response{
+		"help":       {Body: long},
+		"help small": {Body: long, FragmentSize: 7},
+	}))
+	defer srv.Close()
+	conn := dial(t, srv)
+
+	for _, cmd := range []string{"help", "help small"} {
+		out, err := conn.Execute(context.Background(), cmd)
+		if err != nil {
+			t.Fatalf("%s: execute: %v", cmd, err)
+		}
+		if out != long {
+			t.Errorf("%s: got %d bytes, want %d", cmd, len(out), len(long))
+		}
+	}
+}
+
+func TestExecuteEmptyResponse(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Script(map[string]rcontest.Response{
+		"save-all": {Body: ""},
+	}))
+	defer srv.Close()
+	conn := dial(t, srv)
+
+	out, err := conn.Execute(context.Background(), "save-all")
+	if err != nil || out != "" {
+		t.Errorf("got %q, %v, want empty output", out, err)
+	}
+}
+
+func TestExecuteConcurrent(t *testing.T) {
+	srv := rcontest.NewServer("secret", func(cmd string) rcontest.Response {
+		return rcontest.Response{Body: strings.Repeat(cmd, 2000), FragmentSize: 1000}
+	})
+	defer srv.Close()
+	conn := dial(t, srv)
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cmd := fmt.Sprintf("say %02d", i)
+			out, err := conn.Execute(context.Background(), cmd)
+			if err != nil {
+				t.Errorf("%s: execute: %v", cmd, err)
+				return
+			}
+			if out != strings.Repeat(cmd, 2000) {
+				t.Errorf("%s: got a response for another command", cmd)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := srv.Accepted(); got != 1 {
+		t.Errorf("server accepted %d connections, want 1", got)
+	}
+}
+
+func TestDialBadPassword(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Echo())
+	defer srv.Close()
+
+	_, err := rcon.Dial(context.Background(), srv.Addr, "wrong")
+	if !errors.Is(err, rcon.ErrAuthFailed) {
+		t.Errorf("got %v, want %v", err, rcon.ErrAuthFailed)
+	}
+}
+
+func TestExecuteDropped(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Script(map[string]rcontest.Response{
+		"stop": {Drop: true},
+	}))
+	defer srv.Close()
+	conn := dial(t, srv)
+
+	defer func(timeout time.Duration) { rcon.AbandonTimeout = timeout }(rcon.AbandonTimeout)
+	rcon.AbandonTimeout = 50 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := conn.Execute(ctx, "stop")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// the response never arrives, the connection must not stay busy forever
+	start := time.Now()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := conn.Execute(ctx, "list"); !errors.Is(err, rcon.ErrAbandonTimeout) {
+		t.Errorf("got %v, want %v", err, rcon.ErrAbandonTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("next command took %s to fail", elapsed)
+	}
+	if err := conn.Err(); !errors.Is(err, rcon.ErrAbandonTimeout) {
+		t.Errorf("connection error: got %v, want %v", err, rcon.ErrAbandonTimeout)
+	}
+}
+
+func TestExecuteDelayedAfterCancel(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Script(map[string]rcontest.Response{
+		"slow": {Body: "slow", Delay: 100 * time.Millisecond},
+		"fast": {Body: "fast"},
+	}))
+	defer srv.Close()
+	conn := dial(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := conn.Execute(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// the late response of the abandoned command must not be mistaken for the
+	// response of the next one
+	out, err := conn.Execute(context.Background(), "fast")
+	if err != nil || out != "fast" {
+		t.Errorf("got %q, %v, want %q", out, err, "fast")
+	}
+}
+
+func TestExecuteBadRequestID(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Script(map[string]rcontest.Response{
+		"list": {Body: "nope", WrongID: true},
+	}))
+	defer srv.Close()
+	conn := dial(t, srv)
+
+	_, err := conn.Execute(context.Background(), "list")
+	var idErr *rcon.RequestIDError
+	if !errors.As(err, &idErr) || !errors.Is(err, rcon.ErrBadRequestID) {
+		t.Fatalf("got %v, want a request id error", err)
+	}
+	select {
+	case <-conn.Done():
+	default:
+		t.Error("connection still usable after a protocol error")
+	}
+}
+
+func TestExecuteConnectionClosed(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Script(map[string]rcontest.Response{
+		"stop": {Close: true},
+	}))
+	defer srv.Close()
+	conn := dial(t, srv)
+
+	if _, err := conn.Execute(context.Background(), "stop"); err == nil {
+		t.Fatal("got no error after the server closed the connection")
+	}
+	<-conn.Done()
+	if conn.Err() == nil {
+		t.Error("broken connection reports no error")
+	}
+}
+
+func TestExecuteAfterClose(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Echo())
+	defer srv.Close()
+	conn := dial(t, srv)
+
+	conn.Close()
+	if _, err := conn.Execute(context.Background(), "list"); !errors.Is(err, rcon.ErrClosed) {
+		t.Errorf("got %v, want %v", err, rcon.ErrClosed)
+	}
+}
+
+func TestExecuteCommandTooLong(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Echo())
+	defer srv.Close()
+	conn := dial(t, srv)
+
+	cmd := "say " + strings.Repeat("a", rcon.MaxCommandLength)
+	if _, err := conn.Execute(context.Background(), cmd); !errors.Is(err, rcon.ErrCommandTooLong) {
+		t.Errorf("got %v, want %v", err, rcon.ErrCommandTooLong)
+	}
+}
+
+func TestPing(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Echo())
+	defer srv.Close()
+	conn := dial(t, srv)
+
+	if err := conn.Ping(context.Background()); err != nil {
+		t.Errorf("ping: %v", err)
+	}
+	if got := srv.Commands(); len(got) != 0 {
+		t.Errorf("ping sent commands %q", got)
+	}
+}
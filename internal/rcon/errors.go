@@ -0,0 +1,44 @@
+package rcon
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrAuthFailed is returned when the server rejects the password.
+	ErrAuthFailed = errors.New("rcon: authentication failed")
+	// ErrCommandTooLong is returned for commands longer than MaxCommandLength.
+	ErrCommandTooLong = errors.New("rcon: command too long")
+	// ErrMalformedPacket is returned when the server sends a packet that can't
+	// be decoded.
+	ErrMalformedPacket = errors.New("rcon: malformed packet")
+	// ErrBadRequestID is matched by RequestIDError, use errors.Is to check
+	// for it.
+	ErrBadRequestID = errors.New("rcon: bad request id")
+	// ErrClosed is returned when using a connection that has been closed.
+	ErrClosed = errors.New("rcon: connection closed")
+	// ErrAbandonTimeout is returned once a connection was closed because the
+	// response to an abandoned request did not arrive within AbandonTimeout.
+	ErrAbandonTimeout = errors.New("rcon: no response to an abandoned request")
+)
+
+// RequestIDError is returned when the server answers with a request id that
+// does not belong to any request in flight.
+type RequestIDError struct {
+	// Want is the expected id, or -1 if any of the pending ids was expected.
+	Want int32
+	Got  int32
+}
+
+func (e *RequestIDError) Error() string {
+	if e.Want == -1 {
+		return fmt.Sprintf("rcon: bad request id: got %d, no such request", e.Got)
+	}
+	return fmt.Sprintf("rcon: bad request id: got %d, want %d", e.Got, e.Want)
+}
+
+// Is reports whether target is ErrBadRequestID.
+func (e *RequestIDError) Is(target error) bool {
+	return target == ErrBadRequestID
+}
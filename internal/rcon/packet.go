@@ -0,0 +1,86 @@
+package rcon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Packet types, as defined by the Source RCON protocol.
+//
+// Note that the exec command and auth response types share the same value,
+// the direction of the packet is what tells them apart.
+const (
+	packetTypeResponseValue int32 = 0
+	packetTypeExecCommand   int32 = 2
+	packetTypeAuthResponse  int32 = 2
+	packetTypeAuth          int32 = 3
+)
+
+const (
+	// MaxCommandLength is the longest command body accepted by a Minecraft
+	// server. Longer commands make the server drop the connection.
+	MaxCommandLength = 1446
+
+	// packetHeaderSize is the size of the request id, the packet type and the
+	// two null bytes that terminate the body.
+	packetHeaderSize = 4 + 4 + 2
+
+	// maxPacketSize bounds the size of a packet sent by the server. Minecraft
+	// splits responses into 4096 byte bodies, the extra room is there for
+	// servers that are more generous than vanilla.
+	maxPacketSize = 1 << 16
+)
+
+// packet is a single RCON packet.
+type packet struct {
+	id   int32
+	typ  int32
+	body string
+}
+
+// writePacket encodes p and writes it to w in a single write.
+func writePacket(w io.Writer, p packet) error {
+	size := int32(packetHeaderSize + len(p.body))
+
+	buf := bytes.NewBuffer(make([]byte, 0, 4+size))
+	_ = binary.Write(buf, binary.LittleEndian, size)
+	_ = binary.Write(buf, binary.LittleEndian, p.id)
+	_ = binary.Write(buf, binary.LittleEndian, p.typ)
+	buf.WriteString(p.body)
+	buf.Write([]byte{0x0, 0x0})
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// readPacket reads and decodes a single packet from r.
+func readPacket(r io.Reader) (packet, error) {
+	var size int32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return packet{}, err
+	}
+	if size < packetHeaderSize || size > maxPacketSize {
+		return packet{}, fmt.Errorf("%w: bad packet size %d", ErrMalformedPacket, size)
+	}
+
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return packet{}, err
+	}
+
+	p := packet{
+		id:  int32(binary.LittleEndian.Uint32(buf[0:4])),
+		typ: int32(binary.LittleEndian.Uint32(buf[4:8])),
+	}
+	body := buf[8:]
+	if body[len(body)-1] != 0x0 {
+		return packet{}, fmt.Errorf("%w: body is not null terminated", ErrMalformedPacket)
+	}
+	// the body is followed by one or two null bytes depending on the server
+	// implementation, trim all of them
+	p.body = string(bytes.TrimRight(body, "\x00"))
+
+	return p, nil
+}
@@ -0,0 +1,264 @@
+// Package rcontest provides a fake RCON server for tests.
+//
+// The server behaves like a Minecraft server: it answers every command with
+// its response split in packets of at most 4096 bytes, answers any other
+// packet with "Unknown request", and handles the packets of a connection one
+// at a time. Like Minecraft, it expects exactly one packet per read of at most
+// 1460 bytes, and closes the connection if a read returns anything else, so
+// clients that write several packets back to back fail. Responses are
+// scripted, and can be fragmented, delayed, dropped or replaced with a broken
+// connection.
+package rcontest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	packetTypeResponseValue int32 = 0
+	packetTypeExecCommand   int32 = 2
+	packetTypeAuthResponse  int32 = 2
+	packetTypeAuth          int32 = 3
+
+	// DefaultFragmentSize is the largest body Minecraft puts in a packet.
+	DefaultFragmentSize = 4096
+
+	// readSize is the size of the buffer Minecraft reads packets into.
+	readSize = 1460
+)
+
+// Response is the scripted response to a command.
+type Response struct {
+	Body string
+	// FragmentSize is the largest body sent in a single packet. Defaults to
+	// DefaultFragmentSize.
+	FragmentSize int
+	// Delay is how long to wait before answering.
+	Delay time.Duration
+	// Drop makes the server never answer the command, nor the packets that
+	// follow it on the same connection.
+	Drop bool
+	// Close makes the server close the connection instead of answering.
+	Close bool
+	// WrongID makes the server answer with a request id nobody asked for.
+	WrongID bool
+}
+
+// Handler returns the response to a command.
+type Handler func(cmd string) Response
+
+// Script returns a handler that answers with the response of a command, or
+// with an unknown command message if the command is not in the script.
+func Script(responses map[string]Response) Handler {
+	return func(cmd string) Response {
+		if res, ok := responses[cmd]; ok {
+			return res
+		}
+		return Response{Body: "Unknown or incomplete command, see below for error"}
+	}
+}
+
+// Echo returns a handler that answers every command with the command itself.
+func Echo() Handler {
+	return func(cmd string) Response {
+		return Response{Body: cmd}
+	}
+}
+
+// Server is a fake RCON server listening on a local TCP port.
+type Server struct {
+	// Addr is the address the server listens on, as host:port.
+	Addr     string
+	Password string
+
+	listener net.Listener
+	handler  Handler
+
+	mu       sync.Mutex
+	commands []string
+	conns    map[net.Conn]struct{}
+	accepted int
+
+	wg sync.WaitGroup
+}
+
+// NewServer starts a fake RCON server on a random local port.
+func NewServer(password string, handler Handler) *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("rcontest: failed to listen on a port: " + err.Error())
+	}
+	s := &Server{
+		Addr:     l.Addr().String(),
+		Password: password,
+		listener: l,
+		handler:  handler,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s
+}
+
+// Commands returns the commands received so far, in order.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.commands...)
+}
+
+// Accepted returns the number of connections accepted so far.
+func (s *Server) Accepted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.accepted
+}
+
+// CloseConnections closes all open connections, like a server restart would,
+// but keeps accepting new ones.
+func (s *Server) CloseConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Close stops the server and closes all connections.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.CloseConnections()
+	s.wg.Wait()
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.accepted++
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	authenticated := false
+	dropping := false
+	for {
+		id, typ, body, err := readPacket(conn)
+		if err != nil {
+			return
+		}
+
+		if !authenticated {
+			if typ != packetTypeAuth {
+				return
+			}
+			if body != s.Password {
+				writePacket(conn, -1, packetTypeAuthResponse, "")
+				continue
+			}
+			authenticated = true
+			writePacket(conn, id, packetTypeAuthResponse, "")
+			continue
+		}
+
+		if dropping {
+			continue
+		}
+		if typ != packetTypeExecCommand {
+			writePacket(conn, id, packetTypeResponseValue, "Unknown request 0")
+			continue
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, body)
+		s.mu.Unlock()
+
+		res := s.handler(body)
+		time.Sleep(res.Delay)
+		switch {
+		case res.Close:
+			return
+		case res.Drop:
+			dropping = true
+			continue
+		case res.WrongID:
+			id = -id
+		}
+
+		size := res.FragmentSize
+		if size <= 0 {
+			size = DefaultFragmentSize
+		}
+		out := res.Body
+		for {
+			n := len(out)
+			if n > size {
+				n = size
+			}
+			if err := writePacket(conn, id, packetTypeResponseValue, out[:n]); err != nil {
+				return
+			}
+			out = out[n:]
+			if len(out) == 0 {
+				break
+			}
+		}
+	}
+}
+
+// readPacket reads a packet the way Minecraft does: a single read, which must
+// return exactly one whole packet.
+func readPacket(r io.Reader) (int32, int32, string, error) {
+	buf := make([]byte, readSize)
+	n, err := r.Read(buf)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if n < 14 {
+		return 0, 0, "", io.ErrUnexpectedEOF
+	}
+	if size := int(int32(binary.LittleEndian.Uint32(buf[0:4]))); size != n-4 {
+		return 0, 0, "", errors.New("rcontest: read returned more or less than one packet")
+	}
+	id := int32(binary.LittleEndian.Uint32(buf[4:8]))
+	typ := int32(binary.LittleEndian.Uint32(buf[8:12]))
+	return id, typ, string(bytes.TrimRight(buf[12:n], "\x00")), nil
+}
+
+func writePacket(w io.Writer, id, typ int32, body string) error {
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, int32(10+len(body)))
+	_ = binary.Write(buf, binary.LittleEndian, id)
+	_ = binary.Write(buf, binary.LittleEndian, typ)
+	buf.WriteString(body)
+	buf.Write([]byte{0x0, 0x0})
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,92 @@
+package slp
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+var (
+	// chatColors maps the colours of chat components to formatting codes.
+	chatColors = map[string]string{
+		"black":        "§0",
+		"dark_blue":    "§1",
+		"dark_green":   "§2",
+		"dark_aqua":    "§3",
+		"dark_red":     "§4",
+		"dark_purple":  "§5",
+		"gold":         "§6",
+		"gray":         "§7",
+		"dark_gray":    "§8",
+		"blue":         "§9",
+		"green":        "§a",
+		"aqua":         "§b",
+		"red":          "§c",
+		"light_purple": "§d",
+		"yellow":       "§e",
+		"white":        "§f",
+	}
+)
+
+// chatComponent is a JSON chat component, as used in descriptions.
+type chatComponent struct {
+	Text          string            `json:"text"`
+	Translate     string            `json:"translate"`
+	Color         string            `json:"color"`
+	Bold          bool              `json:"bold"`
+	Italic        bool              `json:"italic"`
+	Underlined    bool              `json:"underlined"`
+	Strikethrough bool              `json:"strikethrough"`
+	Obfuscated    bool              `json:"obfuscated"`
+	Extra         []json.RawMessage `json:"extra"`
+}
+
+// chatText flattens a chat component, which is either a string, a list of
+// components or an object, into text with formatting codes.
+func chatText(raw json.RawMessage) string {
+	var b strings.Builder
+	writeChatText(&b, raw)
+	return b.String()
+}
+
+func writeChatText(b *strings.Builder, raw json.RawMessage) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		b.WriteString(s)
+		return
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err == nil {
+		for _, c := range list {
+			writeChatText(b, c)
+		}
+		return
+	}
+	var c chatComponent
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return
+	}
+	b.WriteString(chatColors[c.Color])
+	for _, f := range []struct {
+		set  bool
+		code string
+	}{
+		{c.Bold, "§l"},
+		{c.Italic, "§o"},
+		{c.Underlined, "§n"},
+		{c.Strikethrough, "§m"},
+		{c.Obfuscated, "§k"},
+	} {
+		if f.set {
+			b.WriteString(f.code)
+		}
+	}
+	if c.Text != "" {
+		b.WriteString(c.Text)
+	} else {
+		// translations are left untranslated
+		b.WriteString(c.Translate)
+	}
+	for _, extra := range c.Extra {
+		writeChatText(b, extra)
+	}
+}
@@ -0,0 +1,129 @@
+package slp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	legacyPingPacket   = 0xfe
+	legacyPluginPacket = 0xfa
+	legacyKickPacket   = 0xff
+	legacyChannel      = "MC|PingHost"
+	// legacyProtocolVersion is the protocol of 1.6.4, the last version
+	// pinged with the legacy ping.
+	legacyProtocolVersion = 78
+)
+
+// PingLegacy returns the status of a server with the ping of 1.6, which
+// servers down to 1.4 understand, and which servers older than that answer
+// with a status without version. Newer servers answer it too.
+func PingLegacy(ctx context.Context, address string) (*Status, error) {
+	conn, host, port, err := dial(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	if _, err := conn.Write(legacyPing(host, port)); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	kind, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if kind != legacyKickPacket {
+		return nil, fmt.Errorf("%w: got packet %#x, want a kick", ErrUnexpectedPacket, kind)
+	}
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	units := make([]uint16, length)
+	if err := binary.Read(r, binary.BigEndian, units); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrMalformedPacket
+		}
+		return nil, err
+	}
+	status, err := parseLegacyStatus(string(utf16.Decode(units)))
+	if err != nil {
+		return nil, err
+	}
+	status.Latency = time.Since(start)
+	return status, nil
+}
+
+// legacyPing returns the ping of 1.6: a server list ping packet followed by
+// a plugin message telling the host and port the client connects to.
+func legacyPing(host string, port uint16) []byte {
+	b := []byte{legacyPingPacket, 0x01, legacyPluginPacket}
+	b = appendUTF16(b, legacyChannel)
+	hostUnits := utf16.Encode([]rune(host))
+	b = appendUint16(b, uint16(7+2*len(hostUnits)))
+	b = append(b, legacyProtocolVersion)
+	b = appendUTF16(b, host)
+	return append(b, 0, 0, byte(port>>8), byte(port))
+}
+
+// appendUTF16 appends a string as UTF-16BE prefixed with its length in code
+// units.
+func appendUTF16(b []byte, s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b = appendUint16(b, uint16(len(units)))
+	for _, u := range units {
+		b = appendUint16(b, u)
+	}
+	return b
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+// parseLegacyStatus parses the reason of the kick a server answers the
+// legacy ping with: "§1", protocol, version, MOTD, online and max players
+// separated by null characters since 1.4, and MOTD, online and max players
+// separated by § before.
+func parseLegacyStatus(reason string) (*Status, error) {
+	status := &Status{Legacy: true}
+	var online, maxPlayers string
+	if strings.HasPrefix(reason, "§1\x00") {
+		fields := strings.Split(reason, "\x00")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("%w: %d fields in the status", ErrMalformedPacket, len(fields))
+		}
+		protocol, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: protocol %q", ErrMalformedPacket, fields[1])
+		}
+		status.Version = Version{Name: fields[2], Protocol: protocol}
+		status.Description = fields[3]
+		online, maxPlayers = fields[4], fields[5]
+	} else {
+		fields := strings.Split(reason, "§")
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%w: %d fields in the status", ErrMalformedPacket, len(fields))
+		}
+		// the MOTD may contain § itself
+		status.Description = strings.Join(fields[:len(fields)-2], "§")
+		online, maxPlayers = fields[len(fields)-2], fields[len(fields)-1]
+	}
+	var err error
+	if status.Players.Online, err = strconv.Atoi(online); err != nil {
+		return nil, fmt.Errorf("%w: online players %q", ErrMalformedPacket, online)
+	}
+	if status.Players.Max, err = strconv.Atoi(maxPlayers); err != nil {
+		return nil, fmt.Errorf("%w: max players %q", ErrMalformedPacket, maxPlayers)
+	}
+	return status, nil
+}
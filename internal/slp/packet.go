@@ -0,0 +1,102 @@
+package slp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// Longest string the protocol allows, in characters, times the longest
+	// UTF-8 encoding of a character.
+	maxStringLength = 32767 * 3
+	// Status responses carry a favicon, but nothing much bigger than that.
+	maxPacketLength = 1 << 21
+)
+
+var (
+	errVarIntTooLong = errors.New("varint too long")
+)
+
+// appendVarInt appends the variable length encoding of v, 7 bits per byte,
+// least significant group first.
+func appendVarInt(b []byte, v int32) []byte {
+	u := uint32(v)
+	for u >= 0x80 {
+		b = append(b, byte(u)|0x80)
+		u >>= 7
+	}
+	return append(b, byte(u))
+}
+
+func readVarInt(r io.ByteReader) (int32, error) {
+	var u uint32
+	for i := 0; i < 5; i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		u |= uint32(c&0x7f) << (7 * i)
+		if c&0x80 == 0 {
+			return int32(u), nil
+		}
+	}
+	return 0, errVarIntTooLong
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendVarInt(b, int32(len(s)))
+	return append(b, s...)
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	n, err := readVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	if n < 0 || n > maxStringLength || int(n) > r.Len() {
+		return "", ErrMalformedPacket
+	}
+	s := make([]byte, n)
+	if _, err := io.ReadFull(r, s); err != nil {
+		return "", err
+	}
+	return string(s), nil
+}
+
+// writePacket writes a packet, prefixed with its length.
+func writePacket(w io.Writer, id int32, data []byte) error {
+	body := appendVarInt(nil, id)
+	body = append(body, data...)
+	_, err := w.Write(append(appendVarInt(nil, int32(len(body))), body...))
+	return err
+}
+
+// readPacket reads a packet and returns its id and data.
+func readPacket(r *bufio.Reader) (int32, *bytes.Reader, error) {
+	n, err := readVarInt(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n <= 0 || n > maxPacketLength {
+		return 0, nil, ErrMalformedPacket
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	data := bytes.NewReader(body)
+	id, err := readVarInt(data)
+	if err != nil {
+		return 0, nil, ErrMalformedPacket
+	}
+	return id, data, nil
+}
+
+func appendInt64(b []byte, v int64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(v))
+	return append(b, buf[:]...)
+}
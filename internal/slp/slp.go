@@ -0,0 +1,202 @@
+// Package slp implements a client for the Server List Ping protocol, which the
+// Minecraft client uses to show servers in the server list.
+//
+// Since 1.7, the client sends a handshake and a status request, framed like
+// the packets of the game protocol, and the server answers with its status as
+// JSON. The client then sends a ping with a payload that the server echoes
+// back in a pong, to measure the latency. Servers older than 1.7 only answer
+// the legacy ping, which Ping falls back to.
+//
+// Unlike RCON, the status works even if RCON is disabled, and carries the
+// version, MOTD, online players and favicon of the server.
+package slp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultPort is the port of servers whose address has none.
+	DefaultPort = 25565
+
+	// protocolVersion is sent in handshakes, -1 is what clients send when
+	// they ping without knowing the version of the server.
+	protocolVersion = -1
+	nextStateStatus = 1
+
+	packetHandshake      int32 = 0x00
+	packetStatusRequest  int32 = 0x00
+	packetStatusResponse int32 = 0x00
+	packetPing           int32 = 0x01
+	packetPong           int32 = 0x01
+)
+
+var (
+	// DefaultTimeout bounds pings whose context has no deadline.
+	DefaultTimeout = time.Second * 5
+)
+
+var (
+	// ErrMalformedPacket is returned when the server sends a packet that
+	// can't be decoded.
+	ErrMalformedPacket = errors.New("slp: malformed packet")
+	// ErrUnexpectedPacket is returned when the server sends a packet other
+	// than the one expected.
+	ErrUnexpectedPacket = errors.New("slp: unexpected packet")
+)
+
+// Status is the status of a server.
+type Status struct {
+	Version Version `json:"version"`
+	Players Players `json:"players"`
+	// Description is the MOTD, with § formatting codes.
+	Description string `json:"-"`
+	// Favicon is a 64x64 PNG image encoded as a data URI, if any.
+	Favicon string `json:"favicon"`
+	// Latency is the round trip time of the ping.
+	Latency time.Duration `json:"-"`
+	// Legacy is whether the server only answered the legacy ping, which
+	// carries neither a player sample nor a favicon.
+	Legacy bool `json:"-"`
+}
+
+type Version struct {
+	Name     string `json:"name"`
+	Protocol int    `json:"protocol"`
+}
+
+type Players struct {
+	Max    int `json:"max"`
+	Online int `json:"online"`
+	// Sample is a few of the online players, servers may leave it out or
+	// fill it with anything.
+	Sample []Player `json:"sample"`
+}
+
+type Player struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+}
+
+// statusResponse is the JSON of a status response, whose description is a
+// chat component.
+type statusResponse struct {
+	Status
+	Description json.RawMessage `json:"description"`
+}
+
+// Ping returns the status of the server at address, as host or host:port. If
+// the server does not answer the status request, but accepted the
+// connection, Ping falls back to the legacy ping.
+func Ping(ctx context.Context, address string) (*Status, error) {
+	status, err := PingModern(ctx, address)
+	if err == nil {
+		return status, nil
+	}
+	var opErr *net.OpError
+	if (errors.As(err, &opErr) && opErr.Op == "dial") || ctx.Err() != nil {
+		return nil, err
+	}
+	if status, legacyErr := PingLegacy(ctx, address); legacyErr == nil {
+		return status, nil
+	}
+	return nil, err
+}
+
+// PingModern returns the status of a server running 1.7 or newer. Servers
+// that do not answer the ping still get their status returned, with the
+// round trip time of the status request as latency.
+func PingModern(ctx context.Context, address string) (*Status, error) {
+	conn, host, port, err := dial(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	handshake := appendVarInt(nil, protocolVersion)
+	handshake = appendString(handshake, host)
+	handshake = append(handshake, byte(port>>8), byte(port))
+	handshake = appendVarInt(handshake, nextStateStatus)
+	if err := writePacket(conn, packetHandshake, handshake); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	if err := writePacket(conn, packetStatusRequest, nil); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	id, data, err := readPacket(r)
+	if err != nil {
+		return nil, err
+	}
+	if id != packetStatusResponse {
+		return nil, fmt.Errorf("%w: got packet %#x, want a status response", ErrUnexpectedPacket, id)
+	}
+	body, err := readString(data)
+	if err != nil {
+		return nil, err
+	}
+	var res statusResponse
+	if err := json.Unmarshal([]byte(body), &res); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedPacket, err)
+	}
+	status := res.Status
+	status.Description = chatText(res.Description)
+	status.Latency = time.Since(start)
+
+	start = time.Now()
+	payload := start.UnixNano()
+	if err := writePacket(conn, packetPing, appendInt64(nil, payload)); err != nil {
+		return &status, nil
+	}
+	id, data, err = readPacket(r)
+	var pong int64
+	if err != nil || id != packetPong || binary.Read(data, binary.BigEndian, &pong) != nil || pong != payload {
+		return &status, nil
+	}
+	status.Latency = time.Since(start)
+	return &status, nil
+}
+
+// dial connects to a server, and returns the connection along with the host
+// and port the client says it connects to in its handshake.
+func dial(ctx context.Context, address string) (net.Conn, string, uint16, error) {
+	host, port, err := splitHostPort(address)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		return nil, "", 0, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultTimeout)
+	}
+	conn.SetDeadline(deadline)
+	return conn, host, port, nil
+}
+
+// splitHostPort splits an address into a host and a port, the default port
+// if it has none.
+func splitHostPort(address string) (string, uint16, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		// no port
+		return address, DefaultPort, nil
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("slp: bad port in address %q", address)
+	}
+	return host, uint16(port), nil
+}
@@ -0,0 +1,124 @@
+package slp
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/cezarmathe/stevebot/internal/slp/slptest"
+)
+
+const testStatus = `{
+	"version": {"name": "1.20.1", "protocol": 763},
+	"players": {"max": 20, "online": 2, "sample": [{"name": "alex", "id": "ec561538-f3fd-461d-aff5-086b22154bce"}]},
+	"description": {"text": "A ", "extra": [{"text": "Minecraft", "color": "green", "bold": true}, " Server"]},
+	"favicon": "data:image/png;base64,iVBORw0KGgo="
+}`
+
+func TestPing(t *testing.T) {
+	srv := slptest.NewServer(slptest.Config{Status: testStatus})
+	defer srv.Close()
+
+	status, err := Ping(context.Background(), srv.Addr)
+	if err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	if status.Version.Name != "1.20.1" || status.Version.Protocol != 763 {
+		t.Errorf("got version %+v", status.Version)
+	}
+	if status.Players.Online != 2 || status.Players.Max != 20 ||
+		len(status.Players.Sample) != 1 || status.Players.Sample[0].Name != "alex" {
+		t.Errorf("got players %+v", status.Players)
+	}
+	if status.Description != "A §a§lMinecraft Server" {
+		t.Errorf("got description %q", status.Description)
+	}
+	if status.Favicon != "data:image/png;base64,iVBORw0KGgo=" || status.Legacy || status.Latency <= 0 {
+		t.Errorf("got status %+v", status)
+	}
+
+	hs := srv.Handshakes()
+	if len(hs) != 1 || hs[0].Host != "127.0.0.1" || hs[0].NextState != nextStateStatus || hs[0].Protocol != protocolVersion {
+		t.Errorf("server received handshakes %+v", hs)
+	}
+	if srv.LegacyPings() != 0 {
+		t.Error("server received a legacy ping")
+	}
+}
+
+func TestPingNoPong(t *testing.T) {
+	srv := slptest.NewServer(slptest.Config{Status: testStatus, NoPong: true})
+	defer srv.Close()
+
+	status, err := Ping(context.Background(), srv.Addr)
+	if err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	if status.Players.Online != 2 || status.Latency <= 0 {
+		t.Errorf("got status %+v", status)
+	}
+}
+
+func TestPingLegacyFallback(t *testing.T) {
+	srv := slptest.NewServer(slptest.Config{Legacy: "§1\x0078\x001.6.4\x00§cOld §rserver\x003\x0010"})
+	defer srv.Close()
+
+	status, err := Ping(context.Background(), srv.Addr)
+	if err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	want := Status{
+		Version:     Version{Name: "1.6.4", Protocol: 78},
+		Players:     Players{Online: 3, Max: 10},
+		Description: "§cOld §rserver",
+		Legacy:      true,
+	}
+	status.Latency = 0
+	if !reflect.DeepEqual(*status, want) {
+		t.Errorf("got status %+v, want %+v", status, want)
+	}
+	if srv.LegacyPings() != 1 {
+		t.Errorf("server received %d legacy pings", srv.LegacyPings())
+	}
+}
+
+func TestPingLegacyBeta(t *testing.T) {
+	srv := slptest.NewServer(slptest.Config{Legacy: "A §6beta§ server§1§8"})
+	defer srv.Close()
+
+	status, err := PingLegacy(context.Background(), srv.Addr)
+	if err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	if status.Description != "A §6beta§ server" || status.Players.Online != 1 || status.Players.Max != 8 {
+		t.Errorf("got status %+v", status)
+	}
+}
+
+func TestPingUnreachable(t *testing.T) {
+	srv := slptest.NewServer(slptest.Config{})
+	addr := srv.Addr
+	srv.Close()
+
+	if _, err := Ping(context.Background(), addr); err == nil {
+		t.Fatal("pinged a closed server")
+	}
+}
+
+func TestSplitHostPort(t *testing.T) {
+	for address, want := range map[string]string{
+		"mc.example.com":       "mc.example.com:25565",
+		"mc.example.com:25566": "mc.example.com:25566",
+		"[::1]:25566":          "::1:25566",
+	} {
+		host, port, err := splitHostPort(address)
+		if err != nil {
+			t.Errorf("%s: %v", address, err)
+			continue
+		}
+		if got := host + ":" + strconv.Itoa(int(port)); got != want {
+			t.Errorf("%s: got %s, want %s", address, got, want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Package slptest provides a fake Minecraft server answering status pings,
+// for tests.
+//
+// The server answers the status request of 1.7 and newer with a scripted
+// JSON status, and the legacy ping with a scripted kick reason. Either can be
+// left out to play a server that does not understand it.
+package slptest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"unicode/utf16"
+)
+
+const (
+	legacyPingPacket = 0xfe
+	legacyKickPacket = 0xff
+)
+
+// Config is the scripted behaviour of a server.
+type Config struct {
+	// Status is the JSON answered to status requests. If empty, the server
+	// closes connections that send a handshake, like servers older than 1.7.
+	Status string
+	// Legacy is the kick reason answered to legacy pings, e.g.
+	// "§1\x0078\x001.6.4\x00A Minecraft Server\x000\x0020". If empty, the
+	// server closes connections that send a legacy ping.
+	Legacy string
+	// NoPong makes the server close the connection instead of answering
+	// pings.
+	NoPong bool
+}
+
+// Server is a fake Minecraft server listening on a local TCP port.
+type Server struct {
+	// Addr is the address the server listens on, as host:port.
+	Addr string
+
+	config   Config
+	listener net.Listener
+
+	mu         sync.Mutex
+	handshakes []Handshake
+	legacy     int
+
+	wg sync.WaitGroup
+}
+
+// Handshake is a handshake received by the server.
+type Handshake struct {
+	Protocol  int32
+	Host      string
+	Port      uint16
+	NextState int32
+}
+
+// NewServer starts a fake server on a random local port.
+func NewServer(config Config) *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("slptest: failed to listen on a port: " + err.Error())
+	}
+	s := &Server{
+		Addr:     l.Addr().String(),
+		config:   config,
+		listener: l,
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s
+}
+
+// Handshakes returns the handshakes received so far, in order.
+func (s *Server) Handshakes() []Handshake {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Handshake(nil), s.handshakes...)
+}
+
+// LegacyPings returns the number of legacy pings received so far.
+func (s *Server) LegacyPings() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.legacy
+}
+
+// Close stops the server and waits for the connections to be served.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	first, err := r.Peek(1)
+	if err != nil {
+		return
+	}
+	if first[0] == legacyPingPacket {
+		s.mu.Lock()
+		s.legacy++
+		s.mu.Unlock()
+		if s.config.Legacy != "" {
+			writeKick(conn, s.config.Legacy)
+		}
+		return
+	}
+
+	id, data, err := readPacket(r)
+	if err != nil || id != 0x00 {
+		return
+	}
+	var hs Handshake
+	hs.Protocol, data = readVarInt(data)
+	var host []byte
+	n, data := readVarInt(data)
+	if int(n) > len(data) || len(data)-int(n) < 2 {
+		return
+	}
+	host, data = data[:n], data[n:]
+	hs.Host = string(host)
+	hs.Port = binary.BigEndian.Uint16(data)
+	hs.NextState, _ = readVarInt(data[2:])
+	s.mu.Lock()
+	s.handshakes = append(s.handshakes, hs)
+	s.mu.Unlock()
+	if s.config.Status == "" {
+		return
+	}
+
+	if id, _, err := readPacket(r); err != nil || id != 0x00 {
+		return
+	}
+	status := appendVarInt(nil, int32(len(s.config.Status)))
+	status = append(status, s.config.Status...)
+	writePacket(conn, 0x00, status)
+
+	id, data, err = readPacket(r)
+	if err != nil || id != 0x01 || s.config.NoPong {
+		return
+	}
+	writePacket(conn, 0x01, data)
+}
+
+// writeKick writes the kick packet a server answers legacy pings with.
+func writeKick(w io.Writer, reason string) {
+	units := utf16.Encode([]rune(reason))
+	b := []byte{legacyKickPacket, byte(len(units) >> 8), byte(len(units))}
+	for _, u := range units {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	w.Write(b)
+}
+
+func appendVarInt(b []byte, v int32) []byte {
+	u := uint32(v)
+	for u >= 0x80 {
+		b = append(b, byte(u)|0x80)
+		u >>= 7
+	}
+	return append(b, byte(u))
+}
+
+// readVarInt decodes a varint at the start of b and returns the rest of b.
+func readVarInt(b []byte) (int32, []byte) {
+	var u uint32
+	for i := 0; i < 5 && i < len(b); i++ {
+		u |= uint32(b[i]&0x7f) << (7 * i)
+		if b[i]&0x80 == 0 {
+			return int32(u), b[i+1:]
+		}
+	}
+	return 0, nil
+}
+
+func readPacket(r *bufio.Reader) (int32, []byte, error) {
+	var u uint32
+	for i := 0; ; i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		u |= uint32(c&0x7f) << (7 * i)
+		if c&0x80 == 0 {
+			break
+		}
+		if i == 4 {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+	}
+	body := make([]byte, u)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	id, data := readVarInt(body)
+	return id, data, nil
+}
+
+func writePacket(w io.Writer, id int32, data []byte) {
+	body := append(appendVarInt(nil, id), data...)
+	w.Write(append(appendVarInt(nil, int32(len(body))), body...))
+}
@@ -0,0 +1,55 @@
+package steve
+
+import (
+	"context"
+)
+
+// connectionState is the state of the connection between steve and the
+// Minecraft Server.
+type connectionState int
+
+const (
+	// stateReconnecting means there is no rcon client, but one is being
+	// created. Commands wait for it.
+	stateReconnecting connectionState = iota
+
+	// stateConnected means there is an rcon client ready to be used.
+	stateConnected
+
+	// stateDown means creating an rcon client failed repeatedly. Commands are
+	// rejected right away until creating a client succeeds again.
+	stateDown
+)
+
+func (s connectionState) String() string {
+	switch s {
+	case stateReconnecting:
+		return "reconnecting"
+	case stateConnected:
+		return "connected"
+	case stateDown:
+		return "down"
+	default:
+		return "unknown"
+	}
+}
+
+// connectionManager keeps steve connected to the Minecraft Server, in the
+// background.
+type connectionManager interface {
+	// Start starts the goroutine that creates rcon clients, and replaces them
+	// when they break or stop answering health checks. It runs until the
+	// context is canceled.
+	Start(context.Context)
+
+	// Client returns the current rcon client.
+	//
+	// This function must:
+	// * return the client right away if connected
+	// * wait for a client (or for the context to be canceled) if reconnecting
+	// * return errServerUnreachable right away if down
+	Client(context.Context) (rconClient, error)
+
+	// State returns the current state of the connection.
+	State() connectionState
+}
@@ -0,0 +1,175 @@
+package steve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cezarmathe/stevebot/internal/common"
+)
+
+var (
+	errServerUnreachable = errors.New("the minecraft server is unreachable")
+)
+
+var (
+	// timeout for a single attempt at creating an rcon client
+	dialTimeout = time.Second * 5
+
+	// bounds of the delay between two attempts at creating an rcon client
+	reconnectBackoffMin = time.Second
+	reconnectBackoffMax = time.Minute
+
+	// number of failed attempts after which the server is declared down
+	reconnectAttemptsBeforeDown = 3
+
+	// how often the rcon client is checked, and how long it has to answer
+	healthCheckInterval = time.Second * 30
+	healthCheckTimeout  = time.Second * 5
+)
+
+type connectionManagerImpl struct {
+	mutex   sync.Mutex
+	state   connectionState
+	client  rconClient
+	changed chan struct{} // closed and replaced on every state change
+
+	dial func(context.Context) (rconClient, error)
+}
+
+func newConnectionManager(
+	dial func(context.Context) (rconClient, error)) *connectionManagerImpl {
+
+	return &connectionManagerImpl{
+		state:   stateReconnecting,
+		client:  nil,
+		changed: make(chan struct{}),
+		dial:    dial,
+	}
+}
+
+func (m *connectionManagerImpl) Start(ctx context.Context) {
+	go m.run(ctx)
+}
+
+func (m *connectionManagerImpl) Client(ctx context.Context) (rconClient, error) {
+	for {
+		m.mutex.Lock()
+		state, client, changed := m.state, m.client, m.changed
+		m.mutex.Unlock()
+
+		switch state {
+		case stateConnected:
+			return client, nil
+		case stateDown:
+			return nil, errServerUnreachable
+		}
+
+		// wait for the reconnect to either succeed or fail
+		select {
+		case <-ctx.Done():
+			return nil, errors.New("timed out waiting for an available rcon client")
+		case <-changed:
+		}
+	}
+}
+
+func (m *connectionManagerImpl) State() connectionState {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.state
+}
+
+// run creates rcon clients until the context is canceled.
+func (m *connectionManagerImpl) run(ctx context.Context) {
+	backoff := common.Backoff{
+		Min:    reconnectBackoffMin,
+		Max:    reconnectBackoffMax,
+		Jitter: true,
+	}
+
+	for {
+		dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+		client, err := m.dial(dialCtx)
+		cancel()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			delay := backoff.Next()
+			if backoff.Attempt() >= reconnectAttemptsBeforeDown {
+				m.setState(stateDown, nil)
+			}
+			log.Warnw("connection manager: failed to get an rcon client",
+				"err", err,
+				"state", m.State().String(),
+				"retry_in", delay.String())
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+				continue
+			}
+		}
+
+		backoff.Reset()
+		m.setState(stateConnected, client)
+		log.Info("connection manager: connected")
+
+		err = m.watch(ctx, client)
+		// the other connections of the client may still be open
+		client.Close()
+		if ctx.Err() != nil {
+			return
+		}
+
+		m.setState(stateReconnecting, nil)
+		log.Warnw("connection manager: connection lost, reconnecting",
+			"err", err)
+	}
+}
+
+// watch blocks until the client breaks, fails a health check or the context
+// is canceled, and returns the reason the client can't be used anymore.
+func (m *connectionManagerImpl) watch(ctx context.Context,
+	client rconClient) error {
+
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-client.Done():
+			return client.Err()
+		case <-ticker.C:
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		err := client.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("health check: %w", err)
+		}
+	}
+}
+
+// setState changes the state and wakes up everybody waiting for a client.
+func (m *connectionManagerImpl) setState(state connectionState,
+	client rconClient) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.state = state
+	m.client = client
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/cezarmathe/stevebot/internal/audit"
 	"github.com/cezarmathe/stevebot/internal/common"
+	"github.com/cezarmathe/stevebot/internal/policy"
 	"go.uber.org/zap"
 )
 
@@ -14,6 +16,9 @@ var (
 	rconPasswordKey      = fmt.Sprintf("%s_RCON_PASSWORD", common.EnvVarKeyPrefix)
 	allowedCommandsKey   = fmt.Sprintf("%s_ALLOWED_COMMANDS", common.EnvVarKeyPrefix)
 	forbiddenCommandsKey = fmt.Sprintf("%s_FORBIDDEN_COMMANDS", common.EnvVarKeyPrefix)
+	policyFileKey        = fmt.Sprintf("%s_POLICY_FILE", common.EnvVarKeyPrefix)
+	auditDBKey           = fmt.Sprintf("%s_AUDIT_DB", common.EnvVarKeyPrefix)
+	rconConnectionsKey   = fmt.Sprintf("%s_RCON_CONNECTIONS", common.EnvVarKeyPrefix)
 )
 
 var (
@@ -22,10 +27,14 @@ var (
 	rconHost     string
 	rconPort     int
 	rconPassword string
+	// number of rcon connections, and so of commands that run in parallel
+	rconConnections = 4
 
 	allowedCommands   []string
 	forbiddenCommands []string
-	commandFilter     func(string) error
+	commandPolicy     *policy.Policy
+
+	auditLog *audit.Log
 )
 
 func init() {
@@ -5,8 +5,23 @@ import (
 )
 
 // rconClient is the interface between steve and the Minecraft Server (via
-// RCON). An rcon client is NOT thread safe!
+// RCON). An rcon client is safe for concurrent use, it runs commands in
+// parallel over several connections, one command per connection at a time.
 type rconClient interface {
 	// SendCommand sends a command via RCON.
 	SendCommand(context.Context, rconCommandInput) rconCommandOutput
+
+	// Ping checks that the Minecraft Server still answers. The client can no
+	// longer be used if it does not.
+	Ping(context.Context) error
+
+	// Done returns a channel that is closed once the client can no longer be
+	// used for sending commands.
+	Done() <-chan struct{}
+
+	// Err returns the reason the client can no longer be used.
+	Err() error
+
+	// Close closes the client.
+	Close() error
 }
@@ -3,82 +3,148 @@ package steve
 import (
 	"context"
 	"fmt"
+	"net"
+	"strconv"
+	"sync"
 
-	"github.com/bearbin/mcgorcon"
+	"github.com/cezarmathe/stevebot/internal/rcon"
 )
 
+// rconClientImpl runs commands over a fixed set of rcon connections, one
+// command per connection at a time, so commands submitted concurrently run in
+// parallel. If any connection breaks, the whole client is done and the
+// connection manager replaces it.
 type rconClientImpl struct {
-	inner *mcgorcon.Client
+	conns []*rcon.Conn
+	idle  chan *rcon.Conn // connections not running a command
+
+	mutex sync.Mutex
+	err   error
+	done  chan struct{}
 }
 
 func newRconClientImpl(ctx context.Context) (rconClient, error) {
-	// data returned after dialing a minecraft server
-	type out struct {
-		client *mcgorcon.Client
-		err    error
-	}
+	address := net.JoinHostPort(rconHost, strconv.Itoa(rconPort))
 
-	outChan := make(chan out, 1)
-	go func() {
-		client, err := mcgorcon.Dial(rconHost, rconPort, rconPassword)
-		outChan <- out{&client, err}
-	}()
-
-	select {
-	case <-ctx.Done():
-		// create a goroutine that actually waits for the operation to finish
-		// this happens in order to log a potential error (or it's absence)
-		go func() {
-			out := <-outChan
-			if out.err != nil {
-				log.Warnf("rcon client: new: %w", out.err)
-			} else {
-				log.Warn("rcon client: new: ok after context canceled")
+	c := &rconClientImpl{
+		idle: make(chan *rcon.Conn, rconConnections),
+		done: make(chan struct{}),
+	}
+	for i := 0; i < rconConnections; i++ {
+		conn, err := rcon.Dial(ctx, address, rconPassword)
+		if err != nil {
+			c.Close()
+			if ctx.Err() != nil {
+				log.Warn("rcon client: new: context canceled")
+				return nil, fmt.Errorf("timed out waiting for a new rcon client")
 			}
-		}()
-		log.Warn("rcon client: new: context canceled")
-		return nil, fmt.Errorf("timed out waiting for a new rcon client")
-	case out := <-outChan:
-		if out.err != nil {
-			return nil, out.err
+			return nil, err
 		}
-		return &rconClientImpl{out.client}, nil
+		c.conns = append(c.conns, conn)
+		c.idle <- conn
+	}
+	for _, conn := range c.conns {
+		go c.watch(conn)
 	}
+	return c, nil
 }
 
 func (c *rconClientImpl) SendCommand(ctx context.Context,
 	input rconCommandInput) rconCommandOutput {
 
-	outChan := make(chan rconCommandOutput, 1)
-
-	go func() {
-		out, err := c.inner.SendCommand(input.Command())
-		outChan <- newRconCommandOutput(out, err)
-	}()
-
+	var conn *rcon.Conn
 	select {
+	case conn = <-c.idle:
+	case <-c.done:
+		return newRconCommandOutput("", c.Err())
 	case <-ctx.Done():
-		// create a goroutine that actually waits for the operation to finish
-		// this happens in order to log a potential error (or it's absence)
-		go func() {
-			out := <-outChan
-			if out.Success() {
-				log.Warnw(
-					"rcon client: send command: ok after context canceled",
-					"out", out.Out())
-			} else {
-				log.Warnf("rcon client: send command: %w", out)
-			}
-		}()
 		log.Warn("rcon client: send command: context canceled")
-		err := fmt.Errorf("timed out waiting to send a command")
+		err := fmt.Errorf("timed out waiting for an idle rcon connection")
 		return newRconCommandOutput("", err)
-	case out := <-outChan:
-		if !out.Success() {
-			log.Warnf("rcon client: send command: %w", out)
-			err := fmt.Errorf("encountered an error while sending the command")
+	}
+	defer func() { c.idle <- conn }()
+
+	out, err := conn.Execute(ctx, input.Command())
+	if err != nil {
+		if ctx.Err() != nil {
+			log.Warn("rcon client: send command: context canceled")
+			err = fmt.Errorf("timed out waiting to send a command")
 			return newRconCommandOutput("", err)
 		}
-		return newRconCommandOutput(out.Out(), nil)
+		// note 18/10/2026: protocol errors are passed through as they are,
+		//                  they are typed and describe the failure better
+		//                  than a generic message
+		log.Warnf("rcon client: send command: %v", err)
+		return newRconCommandOutput("", err)
+	}
+	return newRconCommandOutput(out, nil)
+}
+
+func (c *rconClientImpl) Ping(ctx context.Context) error {
+	// connections running a command are left alone, a long command must not
+	// fail the health check
+	var idle []*rcon.Conn
+	defer func() {
+		for _, conn := range idle {
+			c.idle <- conn
+		}
+	}()
+	for len(idle) < len(c.conns) {
+		select {
+		case conn := <-c.idle:
+			idle = append(idle, conn)
+			continue
+		default:
+		}
+		break
+	}
+
+	for _, conn := range idle {
+		if err := conn.Ping(ctx); err != nil {
+			c.fail(err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *rconClientImpl) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *rconClientImpl) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.err
+}
+
+func (c *rconClientImpl) Close() error {
+	c.fail(rcon.ErrClosed)
+	for _, conn := range c.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+// watch marks the client as done once a connection breaks.
+func (c *rconClientImpl) watch(conn *rcon.Conn) {
+	select {
+	case <-conn.Done():
+		c.fail(conn.Err())
+	case <-c.done:
+	}
+}
+
+// fail marks the client as done because of err. Only the first call has any
+// effect.
+func (c *rconClientImpl) fail(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.err != nil {
+		return
 	}
+	c.err = err
+	close(c.done)
 }
@@ -17,15 +17,11 @@ type Steve interface {
 	//
 	// This function starts a goroutine that actually handles the command and
 	// waits for it to be "ready" - that means it got access to an rcon client
-	// and it is ready to send the command.
+	// and it is ready to send the command. Commands submitted concurrently run
+	// in parallel, each over its own rcon connection, up to the number of
+	// connections of the rcon client. If the Minecraft Server is down, the
+	// returned output reports so right away.
 	SubmitCommand(context.Context, []string) SteveCommandOutput
-
-	// getRconClient returns a rcon client.
-	//
-	// This function must:
-	// * lock the mutex
-	// * if the client is nil, attempt to get a new client
-	getRconClient(ctx context.Context) (rconClient, error)
 }
 
 // NewSteve creates a new steve instance.
@@ -7,21 +7,18 @@ import (
 	"os"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
-)
 
-var (
-	steve *steveImpl
+	"github.com/cezarmathe/stevebot/internal/audit"
+	"github.com/cezarmathe/stevebot/internal/policy"
 )
 
 var (
-	getInitialRconClientTimeout = time.Second * 5
+	steve *steveImpl
 )
 
 type steveImpl struct {
-	clientLock sync.Locker
-	client     rconClient
+	conn connectionManager
 }
 
 func newSteve() error {
@@ -61,42 +58,40 @@ func newSteve() error {
 		shouldExit = true
 	}
 
-	allowedCommandsStr, ok := os.LookupEnv(allowedCommandsKey)
-	if !ok {
-		allowedCommands = make([]string, 0)
-	} else {
-		allowedCommands = strings.Split(allowedCommandsStr, ",")
+	if rconConnectionsTmp, ok := os.LookupEnv(rconConnectionsKey); ok && rconConnectionsTmp != "" {
+		rconConnections, err = strconv.Atoi(rconConnectionsTmp)
+		if err != nil || rconConnections < 1 {
+			log.Warnf("new steve: bad environment variable %s: expected positive integer, found: %s",
+				rconConnectionsKey,
+				rconConnectionsTmp)
+			shouldExit = true
+		}
 	}
 
-	forbiddenCommandsStr, ok := os.LookupEnv(forbiddenCommandsKey)
-	if !ok {
-		forbiddenCommands = make([]string, 0)
-	} else {
-		forbiddenCommands = strings.Split(forbiddenCommandsStr, ",")
-	}
+	allowedCommands = splitCommandList(os.Getenv(allowedCommandsKey))
+	forbiddenCommands = splitCommandList(os.Getenv(forbiddenCommandsKey))
 
-	// allowed commands have a higher priority than forbidden commands
-	if len(allowedCommands) > 0 {
-		commandFilter = func(command string) error {
-			for _, allowedCommand := range allowedCommands {
-				if command == allowedCommand {
-					return nil
-				}
-			}
-			return errors.New("command not allowed")
+	// a policy file takes precedence over the allowed and forbidden commands
+	// lists, allowed commands have a higher priority than forbidden commands
+	if policyFile, ok := os.LookupEnv(policyFileKey); ok && policyFile != "" {
+		commandPolicy, err = policy.Load(policyFile)
+		if err != nil {
+			log.Warnf("new steve: %v", err)
+			shouldExit = true
 		}
+	} else if len(allowedCommands) > 0 {
+		commandPolicy = policy.AllowList(allowedCommands)
 	} else if len(forbiddenCommands) > 0 {
-		commandFilter = func(command string) error {
-			for _, forbiddenCommand := range forbiddenCommands {
-				if command == forbiddenCommand {
-					return nil
-				}
-			}
-			return errors.New("forbidden command")
-		}
+		commandPolicy = policy.DenyList(forbiddenCommands)
 	} else {
-		commandFilter = func(_ string) error {
-			return nil
+		commandPolicy, _ = policy.New(nil, policy.Allow)
+	}
+
+	if auditDB, ok := os.LookupEnv(auditDBKey); ok && auditDB != "" {
+		auditLog, err = audit.Open(auditDB)
+		if err != nil {
+			log.Warnf("new steve: %v", err)
+			shouldExit = true
 		}
 	}
 
@@ -108,14 +103,7 @@ func newSteve() error {
 
 	steve = new(steveImpl)
 
-	// note 26/05/2021: mutex was an arbitraty choice, this could have been
-	//                  a rwlock
-	steve.clientLock = new(sync.Mutex)
-	steve.client = nil
-
-	// lock the mutex until the client is initialized
-	// unlocking happens in Start() only if starting is successful
-	steve.clientLock.Lock()
+	steve.conn = newConnectionManager(newRconClientImpl)
 
 	return nil
 }
@@ -125,74 +113,30 @@ func (s *steveImpl) Start(ctx context.Context) error {
 	// idea 23/05/2021: if address is domain, set periodic resolve
 	//                  othwerise, pass ip
 
-	ctx, cancel := context.WithTimeout(ctx, getInitialRconClientTimeout)
-	client, err := newRconClientImpl(ctx)
-	if err != nil {
-		log.Warnf("steve: start: failed to get initial rcon client: %w", err)
-	} else {
-		// note 24/05/2021: it is expected for the mutex to be locked here, it was
-		//                  locked by the newSteve func
-		steve.client = client
-	}
-	cancel()
-
-	// unlock the mutex that guards rconClient
-	steve.clientLock.Unlock()
+	// note 18/10/2026: the connection manager creates the rcon client in the
+	//                  background, commands submitted before it is ready
+	//                  wait for it
+	s.conn.Start(ctx)
 
 	return nil
 }
 
-func (s *steveImpl) getRconClient(ctx context.Context) (rconClient, error) {
-	locked := make(chan struct{}, 1)
-
-	// lock the rcon client
-	// note 11/06/2021: the lock will be unlocked either by `handleCommand` or
-	//                  by a goroutine that gets started if the context is
-	//                  canceled
-	go func() {
-		s.clientLock.Lock()
-		locked <- struct{}{}
-	}()
-
-	// wait for the lock or return on timeout
-	select {
-	case <-ctx.Done():
-		// note 11/06/2021: create a goroutine that unlocks the client if the
-		//                  context gets canceled
-		go func() {
-			<-locked
-			s.clientLock.Unlock()
-			log.Warn("steve: get rcon client: unlocked after context canceled")
-		}()
-		err := errors.New("timed out waiting for an available rcon client")
-		return nil, err
-	case <-locked:
-		break
-	}
-
-	// if there is a client, return it
-	if s.client != nil {
-		return s.client, nil
-	}
-
-	// otherwise, create a new rcon client
-	client, err := newRconClientImpl(ctx)
-	s.client = client
-	if err != nil {
-		log.Warnf("steve: get rcon client: %w", err)
-		errMsg := "failed to get an rcon client for the mineraft server"
-		return nil, errors.New(errMsg)
-	}
-	return client, nil
-}
-
 func (s *steveImpl) SubmitCommand(ctx context.Context,
 	command []string) SteveCommandOutput {
 
-	// if this command does not pass the filter, return an error
-	if err := commandFilter(command[0]); err != nil {
+	// every command that reaches steve is recorded in the audit log
+	entry := &audit.Entry{Command: strings.Join(command, " ")}
+	entry.Origin, _ = audit.OriginFrom(ctx)
+
+	// if this command is not allowed by the policy, return an error
+	decision := commandPolicy.Evaluate(entry.Command)
+	entry.Allowed, entry.Decision = decision.Allowed, decision.Reason()
+	if !decision.Allowed {
+		recordAuditEntry(entry, time.Time{}, "", nil)
+		err := &policy.DeniedError{Command: entry.Command, Decision: decision}
 		return newSteveCommandOutput(err)
 	}
+	start := time.Now()
 
 	// create a channel for getting the steve output from the goroutine
 	outChan := make(chan SteveCommandOutput)
@@ -200,12 +144,9 @@ func (s *steveImpl) SubmitCommand(ctx context.Context,
 	// start the command handler
 	go func() {
 		// get an rcon client
-		client, err := s.getRconClient(ctx)
-
-		// unlock client mutex previously locked by getRconClient
-		defer s.clientLock.Unlock()
-
+		client, err := s.conn.Client(ctx)
 		if err != nil {
+			recordAuditEntry(entry, start, "", err)
 			outChan <- newSteveCommandOutput(err)
 			return
 		}
@@ -220,13 +161,15 @@ func (s *steveImpl) SubmitCommand(ctx context.Context,
 		rconIn := newRconCommandInput(strings.Join(steveIn.Command(), " "))
 
 		// sent the command and get it's output
+		// note 18/10/2026: there is no need to reset the rcon client when the
+		//                  command fails, the connection manager replaces
+		//                  clients that break
 		rconOut := client.SendCommand(ctx, rconIn)
 
-		// note 11/06/2021: if the command is unsuccessful, reset the rcon client
-		//                  this should ideally happen only when steve can't reach
-		//                  the minecraft server
-		if !rconOut.Success() {
-			s.client = nil
+		if rconOut.Success() {
+			recordAuditEntry(entry, start, rconOut.Out(), nil)
+		} else {
+			recordAuditEntry(entry, start, "", rconOut)
 		}
 
 		// send result
@@ -235,3 +178,31 @@ func (s *steveImpl) SubmitCommand(ctx context.Context,
 
 	return <-outChan
 }
+
+// splitCommandList splits a comma-separated list of commands, ignoring empty
+// entries.
+func splitCommandList(list string) []string {
+	commands := make([]string, 0)
+	for _, command := range strings.Split(list, ",") {
+		if command = strings.TrimSpace(command); command != "" {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
+
+// recordAuditEntry completes an audit entry and appends it to the audit log.
+func recordAuditEntry(entry *audit.Entry, start time.Time, out string,
+	err error) {
+
+	if !start.IsZero() {
+		entry.Latency = time.Since(start)
+	}
+	entry.Output = out
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if err := auditLog.Record(entry); err != nil {
+		log.Warnf("steve: record audit entry: %v", err)
+	}
+}
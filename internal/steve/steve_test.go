@@ -0,0 +1,258 @@
+package steve
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cezarmathe/stevebot/internal/policy"
+	"github.com/cezarmathe/stevebot/internal/rcon/rcontest"
+)
+
+func init() {
+	reconnectBackoffMin = time.Millisecond
+	reconnectBackoffMax = 10 * time.Millisecond
+	healthCheckInterval = 10 * time.Millisecond
+	healthCheckTimeout = 50 * time.Millisecond
+}
+
+// newTestSteve creates a steve connected to the server at address.
+func newTestSteve(t *testing.T, address, password string) *steveImpl {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rconHost = host
+	rconPort, _ = strconv.Atoi(port)
+	rconPassword = password
+	commandPolicy, _ = policy.New(nil, policy.Allow)
+	auditLog = nil
+
+	s := &steveImpl{conn: newConnectionManager(newRconClientImpl)}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := s.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// submit submits a command and waits for its output.
+func submit(s *steveImpl, command string) (string, error) {
+	return submitTimeout(s, command, time.Second)
+}
+
+// submitTimeout submits a command and waits for its output for at most
+// timeout.
+func submitTimeout(s *steveImpl, command string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	steveOut := s.SubmitCommand(ctx, strings.Fields(command))
+	if !steveOut.Success() {
+		return "", steveOut.(*steveCommandOutputImpl).err
+	}
+	rconOut := <-steveOut.OutChan()
+	if !rconOut.Success() {
+		return "", rconOut.(*rconCommandOutputImpl).err
+	}
+	return rconOut.Out(), nil
+}
+
+func TestSubmitCommand(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Script(map[string]rcontest.Response{
+		"time query daytime": {Body: "The time is 1000"},
+	}))
+	defer srv.Close()
+	s := newTestSteve(t, srv.Addr, srv.Password)
+
+	out, err := submit(s, "time query daytime")
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if out != "The time is 1000" {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestSubmitCommandFragmented(t *testing.T) {
+	long := strings.Repeat("/help ", 2000)
+	srv := rcontest.NewServer("secret", rcontest.Script(map[string]rcontest.Response{
+		"help": {Body: long},
+	}))
+	defer srv.Close()
+	s := newTestSteve(t, srv.Addr, srv.Password)
+
+	out, err := submit(s, "help")
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if out != long {
+		t.Errorf("got %d bytes, want %d", len(out), len(long))
+	}
+}
+
+func TestSubmitCommandDenied(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Echo())
+	defer srv.Close()
+	s := newTestSteve(t, srv.Addr, srv.Password)
+	commandPolicy = policy.AllowList([]string{"op"})
+
+	if _, err := submit(s, "open sesame"); !errors.Is(err, policy.ErrDenied) {
+		t.Errorf("got %v, want %v", err, policy.ErrDenied)
+	}
+	if _, err := submit(s, "op steve"); err != nil {
+		t.Errorf("allowed command: %v", err)
+	}
+	if got := srv.Commands(); len(got) != 1 || got[0] != "op steve" {
+		t.Errorf("server received %q, want [op steve]", got)
+	}
+}
+
+func TestSubmitCommandConcurrent(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Echo())
+	defer srv.Close()
+	s := newTestSteve(t, srv.Addr, srv.Password)
+
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func(i int) {
+			command := "say " + strconv.Itoa(i)
+			out, err := submit(s, command)
+			if err == nil && out != command {
+				err = errors.New("got the output of another command: " + out)
+			}
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSubmitCommandParallel(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	srv := rcontest.NewServer("secret", rcontest.Script(map[string]rcontest.Response{
+		"slow": {Body: "slow", Delay: delay},
+	}))
+	defer srv.Close()
+	s := newTestSteve(t, srv.Addr, srv.Password)
+
+	start := time.Now()
+	errs := make(chan error, rconConnections)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := submit(s, "slow")
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	// one after the other, they would take delay each
+	if elapsed := time.Since(start); elapsed > 2*delay {
+		t.Errorf("%d slow commands took %s", rconConnections, elapsed)
+	}
+}
+
+func TestSubmitCommandReconnect(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Echo())
+	defer srv.Close()
+	s := newTestSteve(t, srv.Addr, srv.Password)
+
+	if _, err := submit(s, "list"); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	srv.CloseConnections()
+
+	// the first command may race with noticing the broken connection
+	deadline := time.Now().Add(time.Second)
+	for {
+		out, err := submit(s, "list")
+		if err == nil && out == "list" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("not reconnected: %v", err)
+		}
+	}
+	if got := srv.Accepted(); got != 2*rconConnections {
+		t.Errorf("server accepted %d connections, want %d", got, 2*rconConnections)
+	}
+}
+
+func TestSubmitCommandDroppedReply(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Script(map[string]rcontest.Response{
+		"stop": {Drop: true},
+		"list": {Body: "list"},
+	}))
+	defer srv.Close()
+	s := newTestSteve(t, srv.Addr, srv.Password)
+
+	// every connection waits for a reply that never comes
+	errs := make(chan error, rconConnections)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := submitTimeout(s, "stop", 50*time.Millisecond)
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err == nil {
+			t.Fatal("got a reply to a dropped command")
+		}
+	}
+
+	// the health check replaces the client long before the connections give
+	// up on their own
+	deadline := time.Now().Add(time.Second)
+	for {
+		out, err := submitTimeout(s, "list", 100*time.Millisecond)
+		if err == nil && out == "list" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("not reconnected: %v", err)
+		}
+	}
+	if got := srv.Accepted(); got != 2*rconConnections {
+		t.Errorf("server accepted %d connections, want %d", got, 2*rconConnections)
+	}
+}
+
+func TestSubmitCommandServerDown(t *testing.T) {
+	// reserve a port nobody listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	s := newTestSteve(t, address, "secret")
+	deadline := time.Now().Add(time.Second)
+	for s.conn.State() != stateDown {
+		if time.Now().After(deadline) {
+			t.Fatalf("state is %s, want %s", s.conn.State(), stateDown)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	if _, err := submit(s, "list"); !errors.Is(err, errServerUnreachable) {
+		t.Errorf("got %v, want %v", err, errServerUnreachable)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("command took %s to fail", elapsed)
+	}
+}
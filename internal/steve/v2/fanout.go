@@ -0,0 +1,35 @@
+package stevev2i
+
+import (
+	"context"
+	"sync"
+)
+
+// FanOutResult is the result of a command executed on one server.
+type FanOutResult struct {
+	Server string
+	Out    string
+	Err    error
+}
+
+// FanOut executes a command concurrently on the given servers and waits for
+// all of them. Results are returned in the same order as the servers.
+func (r *Registry) FanOut(ctx context.Context, servers []string, cmd string) []FanOutResult {
+	results := make([]FanOutResult, len(servers))
+	wg := new(sync.WaitGroup)
+	for i, server := range servers {
+		results[i].Server = server
+		steve, err := r.Get(server)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		wg.Add(1)
+		go func(res *FanOutResult, steve SteveV2) {
+			defer wg.Done()
+			res.Out, res.Err = steve.Execute(ctx, cmd)
+		}(&results[i], steve)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,230 @@
+package stevev2i
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cezarmathe/stevebot/internal/common"
+	"github.com/cezarmathe/stevebot/internal/rcon"
+	"go.uber.org/zap"
+)
+
+const (
+	// minPoolBackoff bounds the delay between dials, so that a failing dial
+	// can't retry in a tight loop if PoolBackoffMin is not set.
+	minPoolBackoff = 10 * time.Millisecond
+)
+
+var (
+	ErrNoConnection = errors.New("no rcon connection available")
+)
+
+// Pool keeps a fixed number of authenticated RCON connections and hands them
+// out round-robin. Connections are pinged periodically, broken or idle ones
+// are evicted and redialed with exponential backoff.
+//
+// Health check pings don't count as use: a connection that ran no command for
+// PoolIdleTimeout is replaced by a fresh one even if it is healthy, so a bot
+// that is rarely used redials every slot once per PoolIdleTimeout. Set it to
+// zero to keep connections until they break.
+type Pool struct {
+	config *StandardServiceConfig
+	logger *zap.Logger
+
+	address  string
+	password string
+
+	mu    sync.Mutex
+	conns []*pooledConn // nil entries are being (re)dialed
+	next  int           // next slot to hand out
+	ready chan struct{} // closed when a connection is added to the pool
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type pooledConn struct {
+	conn     *rcon.Conn
+	lastUsed time.Time
+}
+
+var (
+	_ RconConn = (*Pool)(nil)
+)
+
+// Create a new pool and start dialing its connections.
+func NewPool(config *StandardServiceConfig, logger *zap.Logger, address, password string) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	size := config.PoolSize
+	if size < 1 {
+		size = 1
+	}
+	p := &Pool{
+		config: config,
+		logger: logger.With(zap.String("address", address)),
+
+		address:  address,
+		password: password,
+
+		conns: make([]*pooledConn, size),
+		ready: make(chan struct{}),
+
+		cancel: cancel,
+	}
+	for i := range p.conns {
+		p.wg.Add(1)
+		go p.maintain(ctx, i)
+	}
+	return p
+}
+
+// Execute an RCON command on the next available connection. If no connection
+// is available, wait for one until ctx is done.
+func (p *Pool) Execute(ctx context.Context, cmd string) (string, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rcon.DefaultTimeout)
+		defer cancel()
+	}
+	for {
+		conn, ready := p.get()
+		if conn != nil {
+			return conn.Execute(ctx, cmd)
+		}
+		select {
+		case <-ctx.Done():
+			return "", ErrNoConnection
+		case <-ready:
+		}
+	}
+}
+
+// Close the pool and all of its connections.
+func (p *Pool) Close() error {
+	p.cancel()
+	p.wg.Wait()
+	return nil
+}
+
+// get returns the next usable connection. If there is none, it returns a
+// channel that is closed once a connection is added to the pool.
+func (p *Pool) get() (*rcon.Conn, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for range p.conns {
+		pc := p.conns[p.next]
+		p.next = (p.next + 1) % len(p.conns)
+		if pc != nil && pc.conn.Err() == nil {
+			pc.lastUsed = time.Now()
+			return pc.conn, nil
+		}
+	}
+	return nil, p.ready
+}
+
+// maintain keeps slot i of the pool filled with a healthy connection until
+// ctx is canceled.
+func (p *Pool) maintain(ctx context.Context, i int) {
+	defer p.wg.Done()
+
+	backoff := common.Backoff{
+		Min:    p.config.PoolBackoffMin,
+		Max:    p.config.PoolBackoffMax,
+		Jitter: true,
+	}
+	if backoff.Min < minPoolBackoff {
+		backoff.Min = minPoolBackoff
+	}
+	if backoff.Max < backoff.Min {
+		backoff.Max = backoff.Min
+	}
+	logger := p.logger.With(zap.Int("slot", i))
+
+	for {
+		dialCtx, cancel := context.WithTimeout(ctx, rcon.DefaultTimeout)
+		conn, err := rcon.Dial(dialCtx, p.address, p.password)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			delay := backoff.Next()
+			logger.Warn("dial rcon", zap.Error(err), zap.Duration("retry_in", delay))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+				continue
+			}
+		}
+		backoff.Reset()
+		logger.Debug("connection added")
+
+		p.put(i, conn)
+		p.watch(ctx, logger, i, conn)
+		p.put(i, nil)
+		conn.Close()
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// put sets the connection in slot i and wakes up callers waiting for one.
+func (p *Pool) put(i int, conn *rcon.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if conn == nil {
+		p.conns[i] = nil
+		return
+	}
+	p.conns[i] = &pooledConn{conn: conn, lastUsed: time.Now()}
+	close(p.ready)
+	p.ready = make(chan struct{})
+}
+
+// watch blocks until the connection in slot i has to be evicted, either
+// because it broke, it failed a health check, it was idle for too long or
+// ctx was canceled.
+func (p *Pool) watch(ctx context.Context, logger *zap.Logger, i int, conn *rcon.Conn) {
+	interval := p.config.PoolHealthCheckInterval
+	if interval <= 0 {
+		interval = rcon.DefaultTimeout
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-conn.Done():
+			logger.Warn("connection broken", zap.Error(conn.Err()))
+			return
+		case <-ticker.C:
+		}
+
+		// pings don't update lastUsed, idle means no command was run
+		p.mu.Lock()
+		idle := time.Since(p.conns[i].lastUsed)
+		p.mu.Unlock()
+		if p.config.PoolIdleTimeout > 0 && idle > p.config.PoolIdleTimeout {
+			logger.Debug("connection idle", zap.Duration("idle", idle))
+			return
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		err := conn.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			logger.Warn("health check", zap.Error(err))
+			return
+		}
+	}
+}
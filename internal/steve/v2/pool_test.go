@@ -0,0 +1,91 @@
+package stevev2i
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cezarmathe/stevebot/internal/rcon/rcontest"
+	"go.uber.org/zap"
+)
+
+func TestPoolReconnect(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Echo())
+	defer srv.Close()
+	pool := NewPool(newTestConfig(), zap.NewNop(), srv.Addr, srv.Password)
+	defer pool.Close()
+
+	if _, err := pool.Execute(context.Background(), "list"); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	srv.CloseConnections()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		out, err := pool.Execute(context.Background(), "list")
+		if err == nil && out == "list" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("not reconnected: %v", err)
+		}
+	}
+	if got := srv.Accepted(); got != 2 {
+		t.Errorf("server accepted %d connections, want 2", got)
+	}
+}
+
+func TestPoolSize(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Echo())
+	defer srv.Close()
+	config := newTestConfig()
+	config.PoolSize = 3
+	pool := NewPool(config, zap.NewNop(), srv.Addr, srv.Password)
+	defer pool.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for srv.Accepted() != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("server accepted %d connections, want 3", srv.Accepted())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Echo())
+	defer srv.Close()
+	config := newTestConfig()
+	config.PoolHealthCheckInterval = 10 * time.Millisecond
+	config.PoolIdleTimeout = 20 * time.Millisecond
+	pool := NewPool(config, zap.NewNop(), srv.Addr, srv.Password)
+	defer pool.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for srv.Accepted() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("idle connection was not replaced")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolNoConnection(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	pool := NewPool(newTestConfig(), zap.NewNop(), address, "secret")
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Execute(ctx, "list"); !errors.Is(err, ErrNoConnection) {
+		t.Errorf("got %v, want %v", err, ErrNoConnection)
+	}
+}
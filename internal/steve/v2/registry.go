@@ -0,0 +1,133 @@
+package stevev2i
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+)
+
+var (
+	ErrUnknownServer = errors.New("unknown server")
+)
+
+// ServerConfig is the configuration of a single Minecraft server.
+type ServerConfig struct {
+	RconAddress  string                `env:"RCON_ADDRESS"`
+	RconPassword string                `env:"RCON_PASSWORD"`
+	Groups       []string              `env:"GROUPS"`
+	Steve        StandardServiceConfig `envPrefix:"STEVE_"`
+
+	// Address pinged for the status of the server, as host or host:port.
+	// If empty, the host of the RCON address is pinged on the default
+	// Minecraft port.
+	StatusAddress string `env:"STATUS_ADDRESS"`
+	// Address of the query port of the server, as host or host:port, for
+	// servers with enable-query set. If empty, the server is not queried.
+	QueryAddress string `env:"QUERY_ADDRESS"`
+	// Path of the log of the server, usually logs/latest.log in its
+	// directory, followed for events like players joining. If empty, the
+	// log is not followed.
+	LogPath string `env:"LOG_PATH"`
+}
+
+// StatusAddr returns the address pinged for the status of the server.
+func (c *ServerConfig) StatusAddr() string {
+	if c.StatusAddress != "" {
+		return c.StatusAddress
+	}
+	host, _, err := net.SplitHostPort(c.RconAddress)
+	if err != nil {
+		return c.RconAddress
+	}
+	return host
+}
+
+// Registry holds the Minecraft servers stevebot talks to, by name, and the
+// groups they belong to.
+type Registry struct {
+	servers       map[string]SteveV2
+	groups        map[string][]string
+	defaultServer string
+}
+
+// Create a new empty registry. Commands that do not name a server go to
+// defaultServer.
+func NewRegistry(defaultServer string) *Registry {
+	return &Registry{
+		servers:       make(map[string]SteveV2),
+		groups:        make(map[string][]string),
+		defaultServer: defaultServer,
+	}
+}
+
+// Add a server to the registry.
+func (r *Registry) Add(name string, steve SteveV2) error {
+	if _, ok := r.servers[name]; ok {
+		return fmt.Errorf("server %q already registered", name)
+	}
+	if _, ok := r.groups[name]; ok {
+		return fmt.Errorf("server %q has the same name as a group", name)
+	}
+	r.servers[name] = steve
+	return nil
+}
+
+// AddToGroup adds a registered server to a group, creating the group if
+// needed.
+func (r *Registry) AddToGroup(group, server string) error {
+	if _, ok := r.servers[server]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownServer, server)
+	}
+	if _, ok := r.servers[group]; ok {
+		return fmt.Errorf("group %q has the same name as a server", group)
+	}
+	for _, member := range r.groups[group] {
+		if member == server {
+			return nil
+		}
+	}
+	r.groups[group] = append(r.groups[group], server)
+	sort.Strings(r.groups[group])
+	return nil
+}
+
+// Group returns the names of the servers in a group, sorted.
+func (r *Registry) Group(name string) ([]string, bool) {
+	members, ok := r.groups[name]
+	return members, ok
+}
+
+// Get the server with the given name.
+func (r *Registry) Get(name string) (SteveV2, error) {
+	steve, ok := r.servers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownServer, name)
+	}
+	return steve, nil
+}
+
+// Default returns the name of the default server.
+func (r *Registry) Default() string {
+	return r.defaultServer
+}
+
+// Names returns the names of all servers, sorted.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.servers))
+	for name := range r.servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Groups returns the names of all groups, sorted.
+func (r *Registry) Groups() []string {
+	names := make([]string, 0, len(r.groups))
+	for name := range r.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -6,3 +6,10 @@ type SteveV2 interface {
 	// Execute an RCON command.
 	Execute(context.Context, string) (string, error)
 }
+
+// RconConn is the connection used by a service to reach the RCON interface
+// of a Minecraft server.
+type RconConn interface {
+	// Execute an RCON command.
+	Execute(context.Context, string) (string, error)
+}
@@ -2,79 +2,143 @@ package stevev2i
 
 import (
 	"context"
-	"errors"
-	"strings"
+	"time"
 
-	"github.com/gorcon/rcon"
+	"github.com/cezarmathe/stevebot/internal/audit"
+	"github.com/cezarmathe/stevebot/internal/policy"
 	"go.uber.org/zap"
 )
 
 var (
-	ErrCommandNotAllowed = errors.New("command is not allowed")
+	ErrCommandNotAllowed = policy.ErrDenied
 )
 
 type StandardServiceConfig struct {
 	AllowedCommands []string `env:"ALLOWED_COMMANDS"`
+	// Path to a command policy file, takes precedence over AllowedCommands.
+	PolicyFile string `env:"POLICY_FILE"`
+	// How long to wait for the result of a command after the caller stopped
+	// waiting for it. Results that arrive in this time go to the dead letter
+	// queue handler.
+	DeadLetterTimeout time.Duration `env:"DEAD_LETTER_TIMEOUT" envDefault:"1m"`
+
+	PoolSize int `env:"POOL_SIZE" envDefault:"2"`
+	// Connections that ran no command for this long are replaced, health
+	// checks don't count. Zero keeps them until they break.
+	PoolIdleTimeout         time.Duration `env:"POOL_IDLE_TIMEOUT" envDefault:"10m"`
+	PoolHealthCheckInterval time.Duration `env:"POOL_HEALTH_CHECK_INTERVAL" envDefault:"30s"`
+	PoolBackoffMin          time.Duration `env:"POOL_BACKOFF_MIN" envDefault:"1s"`
+	PoolBackoffMax          time.Duration `env:"POOL_BACKOFF_MAX" envDefault:"1m"`
+}
+
+// Policy loads the command policy of the service.
+func (c *StandardServiceConfig) Policy() (*policy.Policy, error) {
+	if c.PolicyFile != "" {
+		return policy.Load(c.PolicyFile)
+	}
+	return policy.AllowList(c.AllowedCommands), nil
 }
 
 type StandardService struct {
-	config *StandardServiceConfig
-	logger *zap.Logger
+	name     string
+	config   *StandardServiceConfig
+	logger   *zap.Logger
+	policy   *policy.Policy
+	auditLog *audit.Log
 
-	conn       *rcon.Conn                              // rcon connection
-	dlqHandler func(cmd string, out string, err error) // dead letter queue handler
+	conn       RconConn          // rcon connection
+	dlqHandler DeadLetterHandler // dead letter queue handler
 }
 
-// Create a new standard steve v2 service.
-func NewStandard(config *StandardServiceConfig, logger *zap.Logger, conn *rcon.Conn) StandardService {
+// DeadLetterHandler handles commands that finished after the context they
+// were executed with was done. The context carries the same values as the
+// one passed to Execute.
+type DeadLetterHandler func(ctx context.Context, cmd string, out string, err error)
+
+// Create a new standard steve v2 service for the server with the given name.
+// Commands are recorded in auditLog, if not nil.
+func NewStandard(name string, config *StandardServiceConfig, logger *zap.Logger, policy *policy.Policy, auditLog *audit.Log, conn RconConn) StandardService {
 	return StandardService{
-		config: config,
-		logger: logger,
+		name:     name,
+		config:   config,
+		logger:   logger,
+		policy:   policy,
+		auditLog: auditLog,
 
 		conn: conn,
-		dlqHandler: func(cmd, out string, err error) {
+		dlqHandler: func(ctx context.Context, cmd, out string, err error) {
 			logger.Warn("dead letter queue", zap.String("out", out), zap.Error(err))
 		},
 	}
 }
 
+// OnDeadLetter replaces the dead letter queue handler, which only logs the
+// late results by default.
+func (svc *StandardService) OnDeadLetter(handler DeadLetterHandler) {
+	svc.dlqHandler = handler
+}
+
 var (
 	_ SteveV2 = (*StandardService)(nil)
 )
 
 func (svc *StandardService) Execute(ctx context.Context, cmd string) (string, error) {
 	svc.logger.Debug("execute", zap.Any("ctx", ctx), zap.String("cmd", cmd))
-	allowed := false
-	for _, c := range svc.config.AllowedCommands {
-		if strings.HasPrefix(cmd, c) {
-			allowed = true
-			break
-		}
+	entry := &audit.Entry{Server: svc.name, Command: cmd}
+	entry.Origin, _ = audit.OriginFrom(ctx)
+	if approval, ok := audit.ApprovalFrom(ctx); ok {
+		entry.Approval = &approval
 	}
-	if !allowed {
-		return "", ErrCommandNotAllowed
+	decision := svc.policy.Evaluate(cmd)
+	entry.Allowed, entry.Decision = decision.Allowed, decision.Reason()
+	if !decision.Allowed {
+		svc.record(entry, time.Time{}, "", nil)
+		return "", &policy.DeniedError{Command: cmd, Decision: decision}
 	}
 	type data struct {
 		out string
 		err error
 	}
-	ch := make(chan data, 1)
+	start := time.Now()
+	// unbuffered: a result is either received by the caller or, once the
+	// caller stopped waiting, handed to the dead letter queue, never lost in
+	// between
+	ch := make(chan data)
 	go func() {
-		defer close(ch)
-		out, err := svc.conn.Execute(cmd)
-		if ctx.Err() == nil {
-			ch <- data{out, err}
-		} else {
-			svc.dlqHandler(cmd, out, err)
+		connCtx := context.Background()
+		if svc.config.DeadLetterTimeout > 0 {
+			var cancel context.CancelFunc
+			connCtx, cancel = context.WithTimeout(connCtx, svc.config.DeadLetterTimeout)
+			defer cancel()
+		}
+		out, err := svc.conn.Execute(connCtx, cmd)
+		select {
+		case ch <- data{out, err}:
+		case <-ctx.Done():
+			// the command ran, record what it actually did
+			svc.record(entry, start, out, err)
+			svc.dlqHandler(ctx, cmd, out, err)
 		}
 	}()
 	select {
 	case <-ctx.Done():
 		return "", ctx.Err()
-	case val, ok := <-ch:
-		if !ok {
-			panic("execute channel closed unexpectedly")
-		}
+	case val := <-ch:
+		svc.record(entry, start, val.out, val.err)
 		return val.out, val.err
 	}
 }
+
+// record completes an audit entry and appends it to the audit log.
+func (svc *StandardService) record(entry *audit.Entry, start time.Time, out string, err error) {
+	if !start.IsZero() {
+		entry.Latency = time.Since(start)
+	}
+	entry.Output = out
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if err := svc.auditLog.Record(entry); err != nil {
+		svc.logger.Error("record audit entry", zap.Error(err))
+	}
+}
@@ -0,0 +1,155 @@
+package stevev2i
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cezarmathe/stevebot/internal/audit"
+	"github.com/cezarmathe/stevebot/internal/policy"
+	"github.com/cezarmathe/stevebot/internal/rcon/rcontest"
+	"go.uber.org/zap"
+)
+
+func newTestConfig() *StandardServiceConfig {
+	return &StandardServiceConfig{
+		PoolSize:                1,
+		PoolHealthCheckInterval: time.Second,
+		PoolBackoffMin:          time.Millisecond,
+		PoolBackoffMax:          10 * time.Millisecond,
+		DeadLetterTimeout:       time.Second,
+	}
+}
+
+func newTestService(t *testing.T, srv *rcontest.Server, allowed []string, auditLog *audit.Log) *StandardService {
+	t.Helper()
+
+	config := newTestConfig()
+	config.AllowedCommands = allowed
+	pool := NewPool(config, zap.NewNop(), srv.Addr, srv.Password)
+	t.Cleanup(func() { pool.Close() })
+
+	svc := NewStandard("test", config, zap.NewNop(), policy.AllowList(allowed), auditLog, pool)
+	return &svc
+}
+
+func TestExecute(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Script(map[string]rcontest.Response{
+		"seed": {Body: "Seed: [-4172144997902289642]"},
+	}))
+	defer srv.Close()
+	svc := newTestService(t, srv, []string{"seed"}, nil)
+
+	out, err := svc.Execute(context.Background(), "seed")
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if out != "Seed: [-4172144997902289642]" {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestExecuteNotAllowed(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Echo())
+	defer srv.Close()
+	svc := newTestService(t, srv, []string{"op"}, nil)
+
+	_, err := svc.Execute(context.Background(), "open")
+	if !errors.Is(err, ErrCommandNotAllowed) {
+		t.Errorf("got %v, want %v", err, ErrCommandNotAllowed)
+	}
+	if got := srv.Commands(); len(got) != 0 {
+		t.Errorf("server received %q", got)
+	}
+}
+
+func TestExecuteDeadLetter(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Script(map[string]rcontest.Response{
+		"ban steve": {Body: "Banned steve", Delay: 100 * time.Millisecond},
+	}))
+	defer srv.Close()
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+	svc := newTestService(t, srv, []string{"ban"}, auditLog)
+
+	type letter struct {
+		origin audit.Origin
+		out    string
+		err    error
+	}
+	letters := make(chan letter, 1)
+	svc.OnDeadLetter(func(ctx context.Context, cmd, out string, err error) {
+		origin, _ := audit.OriginFrom(ctx)
+		letters <- letter{origin, out, err}
+	})
+
+	ctx := audit.WithOrigin(context.Background(), audit.Origin{ChannelID: "42"})
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := svc.Execute(ctx, "ban steve"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	select {
+	case l := <-letters:
+		if l.out != "Banned steve" || l.err != nil || l.origin.ChannelID != "42" {
+			t.Errorf("got dead letter %+v", l)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no dead letter")
+	}
+	// the command ran, the audit log must say so rather than record the
+	// deadline of the caller
+	entries, err := auditLog.Query(audit.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Output != "Banned steve" || entries[0].Error != "" {
+		t.Errorf("got audit entries %+v, want the late result", entries)
+	}
+}
+
+func TestExecuteAudit(t *testing.T) {
+	srv := rcontest.NewServer("secret", rcontest.Echo())
+	defer srv.Close()
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+	svc := newTestService(t, srv, []string{"list"}, auditLog)
+
+	ctx := audit.WithOrigin(context.Background(), audit.Origin{UserID: "1"})
+	if _, err := svc.Execute(ctx, "list"); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if _, err := svc.Execute(ctx, "op steve"); err == nil {
+		t.Fatal("denied command executed")
+	}
+	approved := audit.WithApproval(ctx, audit.Approval{UserID: "2"})
+	if _, err := svc.Execute(approved, "list"); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	entries, err := auditLog.Query(audit.Query{UserID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	if e := entries[0]; e.Approval == nil || e.Approval.UserID != "2" {
+		t.Errorf("approved command recorded as %+v", e)
+	}
+	if e := entries[1]; e.Command != "op steve" || e.Allowed || e.Server != "test" {
+		t.Errorf("denied command recorded as %+v", e)
+	}
+	if e := entries[2]; e.Command != "list" || !e.Allowed || e.Output != "list" || e.Approval != nil {
+		t.Errorf("allowed command recorded as %+v", e)
+	}
+}